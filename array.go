@@ -0,0 +1,384 @@
+// Copyright 2013 The go-pgsql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgsql
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// arrayElemOIDs maps the OIDs of supported array types to the OIDs of their
+// element types.
+var arrayElemOIDs = map[int32]int32{
+	_BOOLARRAYOID:        _BOOLOID,
+	_BYTEAARRAYOID:       _BYTEAOID,
+	_CHARARRAYOID:        _CHAROID,
+	_NAMEARRAYOID:        _NAMEOID,
+	_INT2ARRAYOID:        _INT2OID,
+	_INT4ARRAYOID:        _INT4OID,
+	_INT8ARRAYOID:        _INT8OID,
+	_TEXTARRAYOID:        _TEXTOID,
+	_OIDARRAYOID:         _OIDOID,
+	_BPCHARARRAYOID:      _BPCHAROID,
+	_VARCHARARRAYOID:     _VARCHAROID,
+	_FLOAT4ARRAYOID:      _FLOAT4OID,
+	_FLOAT8ARRAYOID:      _FLOAT8OID,
+	_BOXARRAYOID:         _BOXOID,
+	_DATEARRAYOID:        _DATEOID,
+	_TIMEARRAYOID:        _TIMEOID,
+	_TIMETZARRAYOID:      _TIMETZOID,
+	_TIMESTAMPARRAYOID:   _TIMESTAMPOID,
+	_TIMESTAMPTZARRAYOID: _TIMESTAMPTZOID,
+	_NUMERICARRAYOID:     _NUMERICOID,
+	_UUIDARRAYOID:        _UUIDOID,
+}
+
+func isArrayType(oid int32) bool {
+	_, ok := arrayElemOIDs[oid]
+	return ok
+}
+
+func isVectorType(oid int32) bool {
+	return oid == _INT2VECTOROID || oid == _OIDVECTOROID
+}
+
+// vector returns the value of the int2vector or oidvector field with the
+// specified ordinal. Unlike arrays, these are space-separated lists of
+// integers without braces in text format, e.g. "1 3".
+func (rs *ResultSet) vector(ord int) (value []int, isNull bool) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.vector"))
+	}
+
+	isNull = rs.isNull(ord)
+	if isNull {
+		return
+	}
+
+	f := rs.fields[ord]
+
+	if !isVectorType(f.typeOID) {
+		panic(fmt.Sprintf("field '%s' is not of type int2vector or oidvector, OID: %d", f.name, f.typeOID))
+	}
+	if f.format != textFormat {
+		panicNotImplemented()
+	}
+
+	value = []int{}
+	for _, elem := range strings.Fields(string(rs.values[ord])) {
+		i, err := strconv.Atoi(elem)
+		panicIfErr(err)
+
+		value = append(value, i)
+	}
+
+	return
+}
+
+// Vector returns the value of the int2vector or oidvector field with the
+// specified ordinal as []int, e.g. the column numbers of an index in
+// pg_index.indkey.
+func (rs *ResultSet) Vector(ord int) (value []int, isNull bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.Vector", func() {
+		value, isNull = rs.vector(ord)
+	})
+
+	return
+}
+
+// arrayDelimiter returns the delimiter used between the elements of arrays
+// with the specified element type.
+func arrayDelimiter(elemOID int32) byte {
+	if elemOID == _BOXOID {
+		return ';'
+	}
+
+	return ','
+}
+
+// parseArray splits the text representation of a one-dimensional array into
+// its elements. Null elements are returned as nil.
+func parseArray(s []byte, delim byte) (elems [][]byte) {
+	// Skip optional dimension decoration, e.g. "[0:2]={1,2,3}".
+	if len(s) > 0 && s[0] == '[' {
+		i := bytes.IndexByte(s, '=')
+		if i == -1 {
+			panic(fmt.Sprintf("invalid array: '%s'", s))
+		}
+		s = s[i+1:]
+	}
+
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		panic(fmt.Sprintf("invalid array: '%s'", s))
+	}
+	s = s[1 : len(s)-1]
+
+	elems = [][]byte{}
+
+	if len(bytes.TrimSpace(s)) == 0 {
+		return
+	}
+
+	i := 0
+	for {
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+
+		var elem []byte
+
+		if i < len(s) && s[i] == '"' {
+			elem = []byte{}
+			for i++; ; i++ {
+				if i >= len(s) {
+					panic("invalid array: unterminated quoted element")
+				}
+				c := s[i]
+				if c == '\\' {
+					i++
+					if i >= len(s) {
+						panic("invalid array: unterminated quoted element")
+					}
+					elem = append(elem, s[i])
+				} else if c == '"' {
+					i++
+					break
+				} else {
+					elem = append(elem, c)
+				}
+			}
+			for i < len(s) && s[i] == ' ' {
+				i++
+			}
+		} else {
+			start := i
+			for i < len(s) && s[i] != delim {
+				if s[i] == '{' {
+					panic("multidimensional arrays are not supported")
+				}
+				i++
+			}
+			elem = bytes.TrimSpace(s[start:i])
+			if bytes.EqualFold(elem, []byte("NULL")) {
+				elem = nil
+			}
+		}
+
+		elems = append(elems, elem)
+
+		if i >= len(s) {
+			return
+		}
+		if s[i] != delim {
+			panic(fmt.Sprintf("invalid array: unexpected '%c'", s[i]))
+		}
+		i++
+	}
+}
+
+// formatArray returns the text representation of the slice v as a
+// one-dimensional array, e.g. {"a","b",NULL}, formatting the elements like
+// parameter values of the element type of typ, if it is an array type.
+func formatArray(typ Type, v reflect.Value) string {
+	elemTyp := typ
+	if elemOID, ok := arrayElemOIDs[int32(typ)]; ok {
+		elemTyp = Type(elemOID)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte('{')
+
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			buf.WriteByte(arrayDelimiter(int32(elemTyp)))
+		}
+
+		s, isNull := formatParamValue(elemTyp, v.Index(i).Interface())
+		if isNull {
+			buf.WriteString("NULL")
+			continue
+		}
+
+		buf.WriteByte('"')
+		for j := 0; j < len(s); j++ {
+			if c := s[j]; c == '"' || c == '\\' {
+				buf.WriteByte('\\')
+			}
+			buf.WriteByte(s[j])
+		}
+		buf.WriteByte('"')
+	}
+
+	buf.WriteByte('}')
+
+	return buf.String()
+}
+
+// arrayElements returns a ResultSet with a single row containing the elements
+// of the array in the field with the specified ordinal, so they can be decoded
+// by the same methods that decode scalar fields.
+func (rs *ResultSet) arrayElements(ord int) (elems *ResultSet, isNull bool) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.arrayElements"))
+	}
+
+	isNull = rs.isNull(ord)
+	if isNull {
+		return
+	}
+
+	f := rs.fields[ord]
+
+	elemOID, ok := arrayElemOIDs[f.typeOID]
+	if !ok {
+		panic(fmt.Sprintf("field '%s' is not of a supported array type, OID: %d", f.name, f.typeOID))
+	}
+	if f.format != textFormat {
+		panicNotImplemented()
+	}
+
+	values := parseArray(rs.values[ord], arrayDelimiter(elemOID))
+
+	elems = &ResultSet{
+		conn:          rs.conn,
+		hasCurrentRow: true,
+		rawText:       rs.rawText,
+		fields:        make([]field, len(values)),
+		values:        values,
+	}
+	for i := range elems.fields {
+		elems.fields[i] = field{name: f.name, format: textFormat, typeOID: elemOID}
+	}
+
+	return
+}
+
+func (rs *ResultSet) array(ord int) (value []interface{}, isNull bool) {
+	elems, isNull := rs.arrayElements(ord)
+	if isNull {
+		return
+	}
+
+	value = make([]interface{}, len(elems.values))
+	for i := range value {
+		v, elemIsNull := elems.any(i)
+		if !elemIsNull {
+			value[i] = v
+		}
+	}
+
+	return
+}
+
+// Array returns the value of the array field with the specified ordinal as
+// []interface{}.
+//
+// Elements are decoded according to the element type of the array, as
+// described for Any. Null elements are nil. Only one-dimensional arrays are
+// supported.
+func (rs *ResultSet) Array(ord int) (value []interface{}, isNull bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.Array", func() {
+		value, isNull = rs.array(ord)
+	})
+
+	return
+}
+
+// scanArray stores the elements of the array field with the specified ordinal
+// into the slice dest points to. It returns false, if dest is not a pointer
+// to a supported slice type. Null elements are stored as zero values.
+func (rs *ResultSet) scanArray(ord int, dest interface{}) bool {
+	elems, isNull := rs.arrayElements(ord)
+
+	var n int
+	if !isNull {
+		n = len(elems.values)
+	}
+
+	switch d := dest.(type) {
+	case *[]bool:
+		*d = nil
+		for i := 0; i < n; i++ {
+			v, _ := elems.bool(i)
+			*d = append(*d, v)
+		}
+
+	case *[]float32:
+		*d = nil
+		for i := 0; i < n; i++ {
+			v, _ := elems.float32(i)
+			*d = append(*d, v)
+		}
+
+	case *[]float64:
+		*d = nil
+		for i := 0; i < n; i++ {
+			v, _ := elems.float64(i)
+			*d = append(*d, v)
+		}
+
+	case *[]int:
+		*d = nil
+		for i := 0; i < n; i++ {
+			v, _ := elems.int(i)
+			*d = append(*d, v)
+		}
+
+	case *[]int16:
+		*d = nil
+		for i := 0; i < n; i++ {
+			v, _ := elems.int16(i)
+			*d = append(*d, v)
+		}
+
+	case *[]int32:
+		*d = nil
+		for i := 0; i < n; i++ {
+			v, _ := elems.int32(i)
+			*d = append(*d, v)
+		}
+
+	case *[]int64:
+		*d = nil
+		for i := 0; i < n; i++ {
+			v, _ := elems.int64(i)
+			*d = append(*d, v)
+		}
+
+	case *[]*big.Rat:
+		*d = nil
+		for i := 0; i < n; i++ {
+			v, _ := elems.rat(i)
+			*d = append(*d, v)
+		}
+
+	case *[]string:
+		*d = nil
+		for i := 0; i < n; i++ {
+			v, _ := elems.string(i)
+			*d = append(*d, v)
+		}
+
+	case *[]time.Time:
+		*d = nil
+		for i := 0; i < n; i++ {
+			v, _ := elems.time(i)
+			*d = append(*d, v)
+		}
+
+	case *[]interface{}:
+		*d, _ = rs.array(ord)
+
+	default:
+		return false
+	}
+
+	return true
+}
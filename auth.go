@@ -0,0 +1,285 @@
+// Copyright 2013 The go-pgsql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgsql
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Authenticator responds to the authentication requests of the server.
+//
+// Authenticate is called for each AuthenticationRequest message received
+// while connecting, except for AuthenticationOk. authType is the request code
+// as defined by the PostgreSQL protocol, e.g. 3 for a cleartext password, 5
+// for an MD5 hashed password, 7 for GSSAPI or 10 for SASL. data contains the
+// remainder of the message, e.g. the salt for MD5 or the list of mechanisms
+// for SASL.
+//
+// If response is not nil, it is sent to the server as the body of a
+// PasswordMessage, which is also used for GSSAPI, SSPI and SASL responses.
+// If err is not nil, the connection is closed and err is returned to the
+// caller.
+//
+// The same Authenticator is used for all connections established with a
+// ConnParams, e.g. by a Pool, so it must be safe for concurrent use. Use conn
+// to distinguish connections.
+type Authenticator interface {
+	Authenticate(conn *Conn, authType int32, data []byte) (response []byte, err error)
+}
+
+// PasswordAuthenticator is the built-in Authenticator, which supports
+// cleartext, MD5 and SCRAM-SHA-256 password authentication with the password
+// from ConnParams.PasswordProvider or ConnParams.Password.
+//
+// It is used if ConnParams.Authenticator is nil. A custom Authenticator can
+// delegate to it for the password based methods, e.g. to support an
+// additional method only:
+//
+//	func (a myAuthenticator) Authenticate(conn *pgsql.Conn, authType int32, data []byte) ([]byte, error) {
+//		if authType == 7 {
+//			return a.gssResponse(conn, data)
+//		}
+//
+//		return pgsql.PasswordAuthenticator{}.Authenticate(conn, authType, data)
+//	}
+type PasswordAuthenticator struct{}
+
+// Authenticate responds to a password authentication request of the server.
+// During SCRAM-SHA-256 authentication, it keeps the state of the exchange in
+// conn, so all requests of a connection must be passed to it.
+func (PasswordAuthenticator) Authenticate(conn *Conn, authType int32, data []byte) (response []byte, err error) {
+	params := conn.params
+
+	var password string
+
+	switch authenticationType(authType) {
+	case _AuthenticationCleartextPassword, _AuthenticationMD5Password, _AuthenticationSASL:
+		if password, err = params.password(); err != nil {
+			return
+		}
+	}
+
+	switch authenticationType(authType) {
+	case _AuthenticationCleartextPassword:
+		response = append([]byte(password), 0)
+
+	case _AuthenticationMD5Password:
+		response = append([]byte(md5Password(params.User, password, data)), 0)
+
+	case _AuthenticationSASL:
+		if !hasSASLMechanism(data, "SCRAM-SHA-256") {
+			return nil, fmt.Errorf("server requested unsupported SASL mechanisms: %s",
+				strings.Join(strings.Split(strings.Trim(string(data), "\x00"), "\x00"), ", "))
+		}
+
+		nonce := make([]byte, 18)
+		if _, err = rand.Read(nonce); err != nil {
+			return
+		}
+
+		conn.scram = newScramClient(password, base64.StdEncoding.EncodeToString(nonce))
+		response = conn.scram.initialResponse()
+
+	case _AuthenticationSASLContinue:
+		if conn.scram == nil {
+			return nil, errors.New("unexpected AuthenticationSASLContinue")
+		}
+
+		response, err = conn.scram.finalMessage(data)
+
+	case _AuthenticationSASLFinal:
+		if conn.scram == nil {
+			return nil, errors.New("unexpected AuthenticationSASLFinal")
+		}
+
+		err = conn.scram.verifyServerFinal(data)
+		conn.scram = nil
+
+	default:
+		name, ok := authType2String[authenticationType(authType)]
+		if !ok {
+			name = strconv.Itoa(int(authType))
+		}
+
+		err = fmt.Errorf("server requested unsupported authentication method: %s", name)
+	}
+
+	return
+}
+
+// password returns the password to authenticate with, which is obtained from
+// PasswordProvider, if set.
+func (params *ConnParams) password() (string, error) {
+	if params.PasswordProvider != nil {
+		return params.PasswordProvider()
+	}
+
+	return params.Password, nil
+}
+
+func md5Password(user, password string, salt []byte) string {
+	md5Hasher := md5.New()
+
+	md5Hasher.Write([]byte(password))
+	md5Hasher.Write([]byte(user))
+
+	md5HashHex1 := hex.EncodeToString(md5Hasher.Sum(nil))
+
+	md5Hasher.Reset()
+
+	md5Hasher.Write([]byte(md5HashHex1))
+	md5Hasher.Write(salt)
+
+	return "md5" + hex.EncodeToString(md5Hasher.Sum(nil))
+}
+
+func hasSASLMechanism(data []byte, mechanism string) bool {
+	for _, m := range bytes.Split(data, []byte{0}) {
+		if string(m) == mechanism {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scramClient implements the client side of SCRAM-SHA-256 as described in
+// RFC 5802 and RFC 7677, without channel binding.
+type scramClient struct {
+	password        string
+	clientNonce     string
+	clientFirstBare string
+	serverSignature []byte
+}
+
+func newScramClient(password, clientNonce string) *scramClient {
+	// The server ignores the user name in the SCRAM exchange and uses the
+	// one from the startup message instead, so we leave it empty.
+	return &scramClient{
+		password:        password,
+		clientNonce:     clientNonce,
+		clientFirstBare: "n=,r=" + clientNonce,
+	}
+}
+
+// initialResponse returns the body of the SASLInitialResponse message.
+func (sc *scramClient) initialResponse() []byte {
+	clientFirst := "n,," + sc.clientFirstBare
+
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("SCRAM-SHA-256")
+	buf.WriteByte(0)
+	binary.Write(buf, binary.BigEndian, int32(len(clientFirst)))
+	buf.WriteString(clientFirst)
+
+	return buf.Bytes()
+}
+
+// finalMessage returns the client-final-message for the server-first-message.
+func (sc *scramClient) finalMessage(serverFirst []byte) ([]byte, error) {
+	var nonce, salt string
+	var iterations int
+
+	for _, attr := range strings.Split(string(serverFirst), ",") {
+		if len(attr) < 2 || attr[1] != '=' {
+			continue
+		}
+
+		switch attr[0] {
+		case 'r':
+			nonce = attr[2:]
+
+		case 's':
+			salt = attr[2:]
+
+		case 'i':
+			iterations, _ = strconv.Atoi(attr[2:])
+		}
+	}
+
+	if !strings.HasPrefix(nonce, sc.clientNonce) || len(nonce) == len(sc.clientNonce) {
+		return nil, errors.New("invalid SCRAM nonce received from server")
+	}
+	if iterations < 1 {
+		return nil, errors.New("invalid SCRAM iteration count received from server")
+	}
+	saltBytes, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil {
+		return nil, errors.New("invalid SCRAM salt received from server")
+	}
+
+	saltedPassword := scramHi([]byte(sc.password), saltBytes, iterations)
+
+	clientKey := scramHMAC(saltedPassword, []byte("Client Key"))
+	storedKey := sha256.Sum256(clientKey)
+	serverKey := scramHMAC(saltedPassword, []byte("Server Key"))
+
+	// "biws" is the base64 encoding of the GS2 header "n,,".
+	clientFinalWithoutProof := "c=biws,r=" + nonce
+	authMessage := []byte(sc.clientFirstBare + "," + string(serverFirst) + "," + clientFinalWithoutProof)
+
+	clientSignature := scramHMAC(storedKey[:], authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range proof {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+
+	sc.serverSignature = scramHMAC(serverKey, authMessage)
+
+	return []byte(clientFinalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+// verifyServerFinal checks the signature in the server-final-message.
+func (sc *scramClient) verifyServerFinal(serverFinal []byte) error {
+	s := string(serverFinal)
+
+	if strings.HasPrefix(s, "e=") {
+		return errors.New("SCRAM authentication failed: " + s[2:])
+	}
+	if !strings.HasPrefix(s, "v=") {
+		return errors.New("invalid SCRAM server-final-message")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.SplitN(s[2:], ",", 2)[0])
+	if err != nil || !hmac.Equal(signature, sc.serverSignature) {
+		return errors.New("invalid SCRAM server signature")
+	}
+
+	return nil
+}
+
+func scramHMAC(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// scramHi is PBKDF2 with HMAC-SHA-256 and an output length of one block.
+func scramHi(password, salt []byte, iterations int) []byte {
+	u := scramHMAC(password, append(append([]byte{}, salt...), 0, 0, 0, 1))
+
+	result := make([]byte, len(u))
+	copy(result, u)
+
+	for i := 1; i < iterations; i++ {
+		u = scramHMAC(password, u)
+		for j := range result {
+			result[j] ^= u[j]
+		}
+	}
+
+	return result
+}
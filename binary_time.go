@@ -0,0 +1,142 @@
+// Copyright 2013 The go-pgsql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgsql
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// The binary representations of date and time values depend on the
+// integer_datetimes setting of the server, which is on by default since
+// PostgreSQL 8.4. If it is on, times are sent as int64 microseconds, otherwise
+// as float64 seconds. Dates are always sent as int32 days since 2000-01-01.
+
+// integerDatetimes returns if the server sends binary date and time values as
+// integers, as reported in the integer_datetimes ParameterStatus.
+func (conn *Conn) integerDatetimes() bool {
+	return conn.runtimeParameters["integer_datetimes"] != "off"
+}
+
+// binaryMicroseconds decodes an 8 byte binary time quantity, as used by
+// timestamp, time and interval values, into microseconds.
+func binaryMicroseconds(b []byte, integerDatetimes bool) int64 {
+	if len(b) < 8 {
+		panic(fmt.Sprintf("invalid binary time value length: %d", len(b)))
+	}
+
+	if integerDatetimes {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+
+	seconds := math.Float64frombits(binary.BigEndian.Uint64(b))
+	if math.IsInf(seconds, 0) {
+		if seconds > 0 {
+			return math.MaxInt64
+		}
+		return math.MinInt64
+	}
+
+	return int64(math.Floor(seconds*1e6 + 0.5))
+}
+
+// decodeBinaryTimestamp decodes a binary timestamp or timestamptz value.
+func decodeBinaryTimestamp(b []byte, integerDatetimes bool) time.Time {
+	us := binaryMicroseconds(b, integerDatetimes)
+	if us == math.MaxInt64 || us == math.MinInt64 {
+		panic("infinite timestamps are not supported")
+	}
+
+	seconds, fraction := us/1000000, us%1000000
+	if fraction < 0 {
+		seconds--
+		fraction += 1000000
+	}
+
+	return time.Unix(pgEpochUnix+seconds, fraction*1000).UTC()
+}
+
+// decodeBinaryDate decodes a binary date value.
+func decodeBinaryDate(b []byte) time.Time {
+	if len(b) != 4 {
+		panic(fmt.Sprintf("invalid binary date value length: %d", len(b)))
+	}
+
+	days := int32(binary.BigEndian.Uint32(b))
+	if days == math.MaxInt32 || days == math.MinInt32 {
+		panic("infinite dates are not supported")
+	}
+
+	return time.Unix(pgEpochUnix+int64(days)*86400, 0).UTC()
+}
+
+// decodeBinaryTimeOfDay decodes a binary time or, if withZone is true,
+// timetz value.
+func decodeBinaryTimeOfDay(b []byte, integerDatetimes, withZone bool) (t TimeOfDay) {
+	us := binaryMicroseconds(b, integerDatetimes)
+
+	t.Hour = int(us / 3600000000)
+	t.Minute = int(us / 60000000 % 60)
+	t.Second = int(us / 1000000 % 60)
+	t.Microsecond = int(us % 1000000)
+
+	if withZone {
+		if len(b) != 12 {
+			panic(fmt.Sprintf("invalid binary timetz value length: %d", len(b)))
+		}
+
+		// The zone is sent in seconds west of UTC.
+		t.HasZone = true
+		t.ZoneOffset = -int(int32(binary.BigEndian.Uint32(b[8:])))
+	}
+
+	return
+}
+
+// decodeBinaryInterval decodes a binary interval value into the text format
+// PostgreSQL uses with the default IntervalStyle, e.g.
+// "1 year 2 mons 3 days 04:05:06.5".
+func decodeBinaryInterval(b []byte, integerDatetimes bool) string {
+	if len(b) != 16 {
+		panic(fmt.Sprintf("invalid binary interval value length: %d", len(b)))
+	}
+
+	us := binaryMicroseconds(b, integerDatetimes)
+	days := int32(binary.BigEndian.Uint32(b[8:]))
+	months := int32(binary.BigEndian.Uint32(b[12:]))
+
+	var parts []string
+	// Like PostgreSQL, only 1 is singular, e.g. "-1 days".
+	plural := func(n int32, unit, units string) {
+		if n == 1 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, unit))
+		} else if n != 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, units))
+		}
+	}
+	plural(months/12, "year", "years")
+	plural(months%12, "mon", "mons")
+	plural(days, "day", "days")
+
+	if us != 0 || len(parts) == 0 {
+		sign := ""
+		if us < 0 {
+			sign = "-"
+			us = -us
+		}
+
+		clock := fmt.Sprintf("%s%02d:%02d:%02d", sign, us/3600000000, us/60000000%60, us/1000000%60)
+		if fraction := us % 1000000; fraction != 0 {
+			clock += strings.TrimRight(fmt.Sprintf(".%06d", fraction), "0")
+		}
+
+		parts = append(parts, clock)
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -9,13 +9,17 @@ package pgsql
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -45,15 +49,118 @@ const (
 	LogVerbose
 )
 
-type connParams struct {
+// ConnParams contains the settings used to establish a connection.
+//
+// See Connect for the meaning of the settings and their defaults. Use
+// ConnectParams to connect with a ConnParams.
+type ConnParams struct {
 	Host           string
 	Port           int
 	User           string
 	Password       string
 	Database       string
 	TimeoutSeconds int
+	MaxMessageSize int
+
+	// OnConnect, if not nil, is called each time a connection has been
+	// established, including reconnects, to initialize the session, e.g.
+	// by executing SET commands. If it returns an error, the connection is
+	// closed and the error is returned to the caller.
+	OnConnect func(conn *Conn) error
+
+	// Authenticator, if not nil, responds to the authentication requests
+	// of the server instead of PasswordAuthenticator, the built-in
+	// cleartext, MD5 and SCRAM-SHA-256 password authentication, which it
+	// may delegate to.
+	Authenticator Authenticator
+
+	// PasswordProvider, if not nil, is called for each connection attempt,
+	// right before responding to a password request of the server, and
+	// the returned password is used instead of Password. This is useful
+	// for short-lived tokens, e.g. with AWS RDS IAM authentication. If it
+	// returns an error, connecting fails with that error.
+	PasswordProvider func() (string, error)
+
+	// ConnectTimeout, if greater than 0, limits the time spent on
+	// establishing a connection, including all attempts and the delays
+	// between them.
+	ConnectTimeout time.Duration
+
+	// ConnectAttempts is the maximum number of attempts to establish a
+	// connection. Values less than 2 disable retrying. Only transient
+	// errors are retried, i.e. refused connections, timeouts, a missing
+	// Unix-domain socket and a server that is starting up or shutting down,
+	// but not e.g. authentication failures.
+	ConnectAttempts int
+
+	// ConnectRetryDelay is the delay before the first retry, which doubles
+	// for each further retry (default: 100 ms).
+	ConnectRetryDelay time.Duration
+
+	// ConnectRetryMaxDelay, if greater than 0, limits the delay between
+	// retries.
+	ConnectRetryMaxDelay time.Duration
+
+	// TransactionPooling enables compatibility with connection poolers like
+	// PgBouncer in transaction pooling mode, where consecutive transactions
+	// may be executed by different server sessions.
+	//
+	// Statements are then prepared as the unnamed statement and parsed
+	// again each time they are executed, which costs a round trip, and
+	// methods that change session defaults, like
+	// SetDefaultTransactionIsolation, fail. Other session state, like
+	// settings changed with SET, LISTEN registrations, temporary tables or
+	// advisory locks, must not be relied on beyond a transaction either.
+	TransactionPooling bool
+
+	// DisableTCPNoDelay, if true, keeps Nagle's algorithm enabled on TCP
+	// connections. By default, TCP_NODELAY is set, so small messages, like
+	// those of the extended query protocol, are sent without delay. It has
+	// no effect on Unix-domain sockets.
+	DisableTCPNoDelay bool
+
+	// Replication, if not empty, is sent as the replication startup
+	// parameter, so the connection is a replication connection, e.g.
+	// "database" for logical replication, see *Conn.StartReplication. Such
+	// connections only support simple queries, like those of *Conn.Query
+	// without parameters, and replication commands.
+	Replication string
+}
+
+// transactionPooling returns if TransactionPooling is enabled.
+func (conn *Conn) transactionPooling() bool {
+	return conn.params != nil && conn.params.TransactionPooling
+}
+
+// panicIfTransactionPooling panics, if TransactionPooling is enabled, since
+// session-level changes would affect an arbitrary server session.
+func (conn *Conn) panicIfTransactionPooling(funcName string) {
+	if conn.transactionPooling() {
+		panic(fmt.Errorf("%s is not supported with TransactionPooling", funcName))
+	}
+}
+
+// isUnixSocket returns whether Host names the directory of a Unix-domain
+// socket, rather than a host to connect to over TCP.
+func (params *ConnParams) isUnixSocket() bool {
+	return strings.HasPrefix(params.Host, "/")
 }
 
+// defaultMaxMessageSize is the default maximum size of a backend message.
+const defaultMaxMessageSize = 1 << 30
+
+// defaultMaxBufferedRows is the default maximum number of rows
+// *ResultSet.AllMaps reads into memory.
+const defaultMaxBufferedRows = 1000000
+
+// defaultConnectRetryDelay is the default delay before the first retry of a
+// failed connection attempt.
+const defaultConnectRetryDelay = 100 * time.Millisecond
+
+// cancelRequestCode identifies a CancelRequest message in place of the
+// protocol version.
+const cancelRequestCode = 80877102
+
 // ConnStatus represents the status of a connection.
 type ConnStatus int
 
@@ -132,7 +239,7 @@ type Conn struct {
 	tcpConn                         net.Conn
 	reader                          *bufio.Reader
 	writer                          *bufio.Writer
-	params                          *connParams
+	params                          *ConnParams
 	state                           state
 	backendPID                      int32
 	backendSecretKey                int32
@@ -141,7 +248,28 @@ type Conn struct {
 	nextStatementId                 uint64
 	nextPortalId                    uint64
 	nextSavepointId                 uint64
+	maxMessageSize                  int32
+	readTimeout                     time.Duration
+	writeTimeout                    time.Duration
+	logRedaction                    bool
+	scram                           *scramClient
+	events                          chan interface{}
+	dial                            func() (net.Conn, error)
+	maxBufferedRows                 int
+	tracer                          MessageTracer
+	paramCasts                      map[string]string
+	shareStatements                 bool
+	sharedStatements                map[string]*sharedStatement
+	emptyStringAsNull               bool
+	rowCountObserver                func(command string, rows int64)
+	readOnlyKnown                   bool
+	readOnly                        bool
+	connectDeadline                 time.Time
+	sendTrace                       *messageSplitter
+	recvTrace                       *messageSplitter
+	droppedEvents                   uint64
 	transactionStatus               TransactionStatus
+	statements                      map[*Statement]bool
 	dateFormat                      string
 	timeFormat                      string
 	timestampFormat                 string
@@ -155,6 +283,10 @@ func (conn *Conn) withRecover(funcName string, f func()) (err error) {
 
 	defer func() {
 		if x := recover(); x != nil {
+			if netErr, ok := x.(net.Error); ok && netErr.Timeout() {
+				// We don't know where in the message stream we are now.
+				conn.markDead()
+			}
 			err = conn.logAndConvertPanic(x)
 		}
 	}()
@@ -164,6 +296,168 @@ func (conn *Conn) withRecover(funcName string, f func()) (err error) {
 	return
 }
 
+// markDead closes the network connection after an error that left the
+// connection unusable.
+func (conn *Conn) markDead() {
+	if conn.tcpConn != nil {
+		conn.tcpConn.Close()
+	}
+	conn.state = disconnectedState{}
+}
+
+// timeoutConn wraps the network connection of a Conn and sets a new deadline
+// before each read or write, if a timeout has been configured.
+type timeoutConn struct {
+	net.Conn
+	conn *Conn
+}
+
+func (c *timeoutConn) Read(b []byte) (n int, err error) {
+	if c.conn.readTimeout > 0 {
+		if err = c.Conn.SetReadDeadline(time.Now().Add(c.conn.readTimeout)); err != nil {
+			return
+		}
+	}
+
+	n, err = c.Conn.Read(b)
+	if c.conn.recvTrace != nil {
+		c.conn.recvTrace.feed(b[:n])
+	}
+
+	return
+}
+
+func (c *timeoutConn) Write(b []byte) (n int, err error) {
+	if c.conn.writeTimeout > 0 {
+		if err = c.Conn.SetWriteDeadline(time.Now().Add(c.conn.writeTimeout)); err != nil {
+			return
+		}
+	}
+
+	n, err = c.Conn.Write(b)
+	if c.conn.sendTrace != nil {
+		c.conn.sendTrace.feed(b[:n])
+	}
+
+	return
+}
+
+// SetReadTimeout sets the maximum duration of each subsequent read from the
+// server. A value of 0 means no timeout.
+//
+// If a read times out, the connection is closed, because the position in the
+// message stream is unknown afterwards.
+func (conn *Conn) SetReadTimeout(d time.Duration) error {
+	conn.readTimeout = d
+
+	if d == 0 {
+		return conn.tcpConn.SetReadDeadline(time.Time{})
+	}
+
+	return nil
+}
+
+// SetWriteTimeout sets the maximum duration of each subsequent write to the
+// server. A value of 0 means no timeout.
+//
+// If a write times out, the connection is closed, because the position in
+// the message stream is unknown afterwards.
+func (conn *Conn) SetWriteTimeout(d time.Duration) error {
+	conn.writeTimeout = d
+
+	if d == 0 {
+		return conn.tcpConn.SetWriteDeadline(time.Time{})
+	}
+
+	return nil
+}
+
+// SetMaxBufferedRows sets the maximum number of rows helpers like
+// *ResultSet.AllMaps read into memory, before failing with an error. This
+// guards against exhausting memory with unexpectedly large results. The
+// default is 1,000,000, 0 means no limit.
+func (conn *Conn) SetMaxBufferedRows(n int) {
+	conn.maxBufferedRows = n
+}
+
+// MaxBufferedRows returns the maximum number of rows helpers like
+// *ResultSet.AllMaps read into memory, 0 means no limit.
+func (conn *Conn) MaxBufferedRows() int {
+	return conn.maxBufferedRows
+}
+
+// SetParameterCast sets the name of the type that parameters with the
+// specified name are cast to in commands prepared afterwards, if they have
+// no custom type name of their own, e.g. SetParameterCast("@created_at",
+// "timestamptz"). An empty typeName removes the default.
+func (conn *Conn) SetParameterCast(paramName, typeName string) {
+	if typeName == "" {
+		delete(conn.paramCasts, paramName)
+		return
+	}
+
+	if conn.paramCasts == nil {
+		conn.paramCasts = make(map[string]string)
+	}
+	conn.paramCasts[paramName] = typeName
+}
+
+// ParameterCast returns the name of the type that parameters with the
+// specified name are cast to by default, see SetParameterCast.
+func (conn *Conn) ParameterCast(paramName string) string {
+	return conn.paramCasts[paramName]
+}
+
+// SetShareStatements controls whether Statements returned by Prepare share a
+// server-side prepared statement, if they have the same actual command and
+// parameter types, instead of preparing the command again. This saves the
+// parsing and planning for code that prepares the same command repeatedly.
+//
+// Each Statement still has its own parameters and portal. The shared prepared
+// statement is deallocated, when the last Statement using it is closed.
+// Sharing is off by default.
+func (conn *Conn) SetShareStatements(shareStatements bool) {
+	conn.shareStatements = shareStatements
+}
+
+// SetEmptyStringAsNull controls whether parameters with an empty string
+// value are bound as NULL, as expected by code that treats "" as the absence
+// of a value. By default, empty strings are bound as empty strings. Only
+// values of type string are affected.
+func (conn *Conn) SetEmptyStringAsNull(emptyStringAsNull bool) {
+	conn.emptyStringAsNull = emptyStringAsNull
+}
+
+// EmptyStringAsNull returns whether parameters with an empty string value are
+// bound as NULL, see SetEmptyStringAsNull.
+func (conn *Conn) EmptyStringAsNull() bool {
+	return conn.emptyStringAsNull
+}
+
+// SetRowCountObserver sets a function, which is called with the command text
+// and the number of rows, whenever a ResultSet of a query or command is
+// closed, e.g. to collect metrics centrally. rows is the number of rows
+// returned or, for commands that return no rows, the number of rows
+// affected. Pass nil to remove the observer.
+//
+// The observer is called on the goroutine closing the ResultSet and must not
+// use the connection.
+func (conn *Conn) SetRowCountObserver(observer func(command string, rows int64)) {
+	conn.rowCountObserver = observer
+}
+
+// SetLogRedaction controls whether parameter values are replaced by a
+// placeholder when commands are logged at LogCommand level. Command texts and
+// parameter names are logged either way.
+func (conn *Conn) SetLogRedaction(redact bool) {
+	conn.logRedaction = redact
+}
+
+// LogRedaction returns whether parameter values are redacted from the log.
+func (conn *Conn) LogRedaction() bool {
+	return conn.logRedaction
+}
+
 func parseParamsInUnquotedSubstring(s string, name2value map[string]string) (lastKeyword string) {
 	var words []string
 
@@ -194,7 +488,7 @@ func parseParamsInUnquotedSubstring(s string, name2value map[string]string) (las
 	return
 }
 
-func (conn *Conn) parseParams(s string) *connParams {
+func (conn *Conn) parseParams(s string) *ConnParams {
 	name2value := make(map[string]string)
 
 	quoteIndexPairs := quoteRegExp.FindAllStringIndex(s, -1)
@@ -218,17 +512,23 @@ func (conn *Conn) parseParams(s string) *connParams {
 		parseParamsInUnquotedSubstring(s, name2value)
 	}
 
-	params := &connParams{}
+	params := &ConnParams{}
 
 	params.Host = name2value["host"]
 	params.Port, _ = strconv.Atoi(name2value["port"])
 	params.Database = name2value["dbname"]
 	params.User = name2value["user"]
 	params.Password = name2value["password"]
-	if params.Password == "" {
-		params.Password, _ = passwordfromfile(params.Host, params.Port, params.Database, params.User)
-	}
 	params.TimeoutSeconds, _ = strconv.Atoi(name2value["timeout"])
+	params.MaxMessageSize, _ = strconv.Atoi(name2value["maxmessagesize"])
+	connectTimeout, _ := strconv.Atoi(name2value["connect_timeout"])
+	params.ConnectTimeout = time.Duration(connectTimeout) * time.Second
+	params.TransactionPooling, _ = strconv.ParseBool(name2value["transaction_pooling"])
+	params.Replication = name2value["replication"]
+	if value, ok := name2value["tcp_nodelay"]; ok {
+		noDelay, _ := strconv.ParseBool(value)
+		params.DisableTCPNoDelay = !noDelay
+	}
 
 	if conn.LogLevel >= LogDebug {
 		buf := bytes.NewBuffer(nil)
@@ -251,17 +551,23 @@ func (conn *Conn) parseParams(s string) *connParams {
 //
 // Currently these keywords are supported:
 //
-//	host 		= Name of the host to connect to (default: localhost)
+//	host 		= Name of the host to connect to (default: localhost); a value
+//			  starting with a slash names the directory of the Unix-domain
+//			  socket of the server, e.g. /var/run/postgresql
 //	port 		= Integer port number the server listens on (default: 5432)
 //	dbname 		= Database name (default: same as user)
 //	user 		= User to connect as
 //	password	= Password for password based authentication methods
-//	timeout		= Timeout in seconds, 0 or not specified disables timeout (default: 0)
+//	timeout		= Timeout in seconds for each read or write, 0 or not specified disables timeout (default: 0)
+//	maxmessagesize	= Maximum size in bytes of a message received from the server (default: 1 GB)
+//	connect_timeout	= Maximum time in seconds to wait for a connection, 0 or not specified means wait indefinitely (default: 0)
+//	transaction_pooling = true to work with poolers in transaction pooling mode, see ConnParams.TransactionPooling (default: false)
+//	tcp_nodelay	= false to keep Nagle's algorithm enabled on TCP connections, see ConnParams.DisableTCPNoDelay (default: true)
+//	replication	= database to establish a logical replication connection, see ConnParams.Replication (default: none)
 func Connect(connStr string, logLevel LogLevel) (conn *Conn, err error) {
 	newConn := &Conn{}
 
 	newConn.LogLevel = logLevel
-	newConn.state = disconnectedState{}
 
 	if newConn.LogLevel >= LogDebug {
 		defer newConn.logExit(newConn.logEnter("Connect"))
@@ -273,8 +579,46 @@ func Connect(connStr string, logLevel LogLevel) (conn *Conn, err error) {
 		}
 	}()
 
-	params := newConn.parseParams(connStr)
-	newConn.params = params
+	newConn.connectParams(newConn.parseParams(connStr))
+
+	conn = newConn
+
+	return
+}
+
+// ConnectParams establishes a database connection using the settings in
+// params.
+//
+// The same defaults and environment variables as for Connect apply. params is
+// not modified.
+func ConnectParams(params *ConnParams, logLevel LogLevel) (conn *Conn, err error) {
+	newConn := &Conn{}
+
+	newConn.LogLevel = logLevel
+
+	if newConn.LogLevel >= LogDebug {
+		defer newConn.logExit(newConn.logEnter("ConnectParams"))
+	}
+
+	defer func() {
+		if x := recover(); x != nil {
+			err = newConn.logAndConvertPanic(x)
+		}
+	}()
+
+	p := *params
+	newConn.connectParams(&p)
+
+	conn = newConn
+
+	return
+}
+
+func (conn *Conn) connectParams(params *ConnParams) {
+	conn.state = disconnectedState{}
+	conn.statements = make(map[*Statement]bool)
+
+	conn.params = params
 
 	var env string // Reusable environment variable used to capture PG environment variables - PGHOST, PGPORT, PGDATABASE, PGUSER
 
@@ -303,39 +647,250 @@ func Connect(connStr string, logLevel LogLevel) (conn *Conn, err error) {
 	if env != "" {
 		params.User = env
 	}
+	if params.Password == "" && params.PasswordProvider == nil {
+		// Like libpq, use localhost to look up passwords for Unix-domain
+		// socket connections.
+		host := params.Host
+		if params.isUnixSocket() {
+			host = "localhost"
+		}
+		params.Password, _ = passwordfromfile(host, params.Port, params.Database, params.User)
+	}
+	if params.MaxMessageSize <= 0 || params.MaxMessageSize > defaultMaxMessageSize {
+		params.MaxMessageSize = defaultMaxMessageSize
+	}
+	conn.maxMessageSize = int32(params.MaxMessageSize)
+
+	conn.readTimeout = time.Duration(params.TimeoutSeconds) * time.Second
+	conn.writeTimeout = conn.readTimeout
+
+	conn.maxBufferedRows = defaultMaxBufferedRows
+
+	conn.connectWithRetry()
+}
+
+// dialServer opens a new network connection to the server. A timeout of 0
+// means no timeout.
+func (params *ConnParams) dialServer(timeout time.Duration) (net.Conn, error) {
+	if params.isUnixSocket() {
+		return net.DialTimeout("unix", filepath.Join(params.Host, fmt.Sprintf(".s.PGSQL.%d", params.Port)), timeout)
+	}
+
+	return net.DialTimeout("tcp", fmt.Sprintf("%s:%d", params.Host, params.Port), timeout)
+}
+
+// isTransientConnectError returns if err, raised while connecting, is likely
+// to go away soon, e.g. while the server restarts.
+func isTransientConnectError(err error) bool {
+	if pgErr, ok := err.(*Error); ok {
+		switch pgErr.Code() {
+		case "57P01", "57P03": // admin_shutdown, cannot_connect_now
+			return true
+		}
+
+		return false
+	}
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT)
+}
+
+// connectWithRetry calls connect until it succeeds, a non-transient error
+// occurs or the attempts or the time configured in conn.params are used up.
+func (conn *Conn) connectWithRetry() {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.connectWithRetry"))
+	}
+
+	params := conn.params
+
+	conn.connectDeadline = time.Time{}
+	if params.ConnectTimeout > 0 {
+		conn.connectDeadline = time.Now().Add(params.ConnectTimeout)
+	}
+
+	delay := params.ConnectRetryDelay
+	if delay <= 0 {
+		delay = defaultConnectRetryDelay
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := func() (err error) {
+			defer func() {
+				if x := recover(); x != nil {
+					if e, ok := x.(error); ok {
+						err = e
+					} else {
+						err = errors.New(fmt.Sprint(x))
+					}
+				}
+			}()
+
+			conn.connect()
+
+			return
+		}()
+		if err == nil {
+			return
+		}
+
+		if attempt >= params.ConnectAttempts || !isTransientConnectError(err) {
+			panic(err)
+		}
+		if !conn.connectDeadline.IsZero() && time.Now().Add(delay).After(conn.connectDeadline) {
+			panic(err)
+		}
+
+		if conn.LogLevel >= LogWarning {
+			conn.logf(LogWarning, "connection attempt %d failed, retrying in %s: %s", attempt, delay, err)
+		}
+
+		time.Sleep(delay)
+
+		delay *= 2
+		if params.ConnectRetryMaxDelay > 0 && delay > params.ConnectRetryMaxDelay {
+			delay = params.ConnectRetryMaxDelay
+		}
+	}
+}
 
-	tcpConn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", params.Host, params.Port))
+// connect dials the server and performs the startup using conn.params.
+func (conn *Conn) connect() {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.connect"))
+	}
+
+	params := conn.params
+
+	var timeout time.Duration
+	if !conn.connectDeadline.IsZero() {
+		if timeout = conn.connectDeadline.Sub(time.Now()); timeout <= 0 {
+			panic(errors.New("connect timeout exceeded"))
+		}
+	}
+
+	var tcpConn net.Conn
+	var err error
+	if conn.dial != nil {
+		tcpConn, err = conn.dial()
+	} else {
+		tcpConn, err = params.dialServer(timeout)
+	}
 	panicIfErr(err)
 
-	panicIfErr(tcpConn.SetDeadline(time.Unix(int64(params.TimeoutSeconds*1000*1000*1000), 0)))
+	if tc, ok := tcpConn.(*net.TCPConn); ok {
+		tc.SetNoDelay(!params.DisableTCPNoDelay)
+	}
 
-	newConn.tcpConn = tcpConn
+	if !conn.connectDeadline.IsZero() {
+		// Limit the startup as well, the per-operation timeouts apply
+		// afterwards.
+		tcpConn.SetDeadline(conn.connectDeadline)
+		defer tcpConn.SetDeadline(time.Time{})
+	}
 
-	newConn.reader = bufio.NewReader(tcpConn)
-	newConn.writer = bufio.NewWriter(tcpConn)
+	conn.tcpConn = &timeoutConn{Conn: tcpConn, conn: conn}
+	conn.sendTrace = newMessageSplitter(conn, TraceFrontend)
+	conn.recvTrace = newMessageSplitter(conn, TraceBackend)
 
-	newConn.runtimeParameters = make(map[string]string)
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			conn.markDead()
+		}
+	}()
 
-	newConn.onErrorDontRequireReadyForQuery = true
+	conn.reader = bufio.NewReader(conn.tcpConn)
+	conn.writer = bufio.NewWriter(conn.tcpConn)
+
+	conn.runtimeParameters = make(map[string]string)
+
+	conn.onErrorDontRequireReadyForQuery = true
 	defer func() {
-		newConn.onErrorDontRequireReadyForQuery = false
+		conn.onErrorDontRequireReadyForQuery = false
 	}()
 
-	newConn.writeStartup()
+	conn.writeStartup()
 
-	newConn.readBackendMessages(nil)
+	conn.checkStartupResponse()
 
-	newConn.state = readyState{}
-	newConn.params = nil
+	conn.readBackendMessages(nil)
 
-	newConn.transactionStatus = NotInTransaction
+	conn.state = readyState{}
 
-	conn = newConn
+	conn.transactionStatus = NotInTransaction
 
-	return
+	conn.onErrorDontRequireReadyForQuery = false
+
+	if params.OnConnect != nil {
+		panicIfErr(params.OnConnect(conn))
+	}
+
+	succeeded = true
+}
+
+func (conn *Conn) reconnect() {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.reconnect"))
+	}
+
+	if conn.Status() != StatusDisconnected {
+		// The old connection may well be broken already, so we don't care
+		// about errors here.
+		func() {
+			defer func() { recover() }()
+			conn.writeTerminate()
+		}()
+		conn.markDead()
+	}
+
+	conn.connectWithRetry()
+
+	// Statements sharing a prepared statement need it prepared only once.
+	prepared := make(map[string]bool)
+	for stmt := range conn.statements {
+		if !prepared[stmt.name] {
+			conn.state.prepare(stmt)
+			prepared[stmt.name] = true
+		}
+	}
+}
+
+// Reconnect closes the connection, if it is still open, and establishes a new
+// one with the same connection parameters.
+//
+// Statements prepared with Prepare or PrepareRaw that have not been closed are
+// prepared again on the new connection, so they remain usable. Session state,
+// like open transactions, temporary tables or settings changed with SET, is
+// lost.
+func (conn *Conn) Reconnect() (err error) {
+	return conn.withRecover("*Conn.Reconnect", func() {
+		conn.reconnect()
+	})
+}
+
+// Clone establishes a new connection to the database, using the same
+// connection parameters and log level as conn.
+//
+// The new connection is independent of conn and must be closed separately.
+// Connections created by NewConnFromNetConn or NewConnFromStreams can't be
+// cloned, since there is no server address to connect to.
+func (conn *Conn) Clone() (*Conn, error) {
+	if conn.dial != nil {
+		return nil, errors.New("cannot clone a connection created from an existing network connection or streams")
+	}
+
+	return ConnectParams(conn.params, conn.LogLevel)
 }
 
 // Close closes the connection to the database.
+//
+// It sends a Terminate message first, so the server ends the session right
+// away. If that fails, e.g. because the server is gone already, the network
+// connection is closed anyway and the error is returned.
 func (conn *Conn) Close() (err error) {
 	return conn.withRecover("*Conn.Close", func() {
 		if conn.Status() == StatusDisconnected {
@@ -344,6 +899,13 @@ func (conn *Conn) Close() (err error) {
 			return
 		}
 
+		defer func() {
+			if x := recover(); x != nil {
+				conn.markDead()
+				panic(x)
+			}
+		}()
+
 		conn.writeTerminate()
 
 		panicIfErr(conn.tcpConn.Close())
@@ -411,6 +973,29 @@ func (conn *Conn) CopyFrom(command string, r io.Reader) (rowsAffected int64, err
 	return
 }
 
+func (conn *Conn) deallocateAll() {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.deallocateAll"))
+	}
+
+	conn.execute("DEALLOCATE ALL;")
+
+	for stmt := range conn.statements {
+		stmt.isClosed = true
+	}
+	conn.statements = make(map[*Statement]bool)
+	conn.sharedStatements = nil
+}
+
+// DeallocateAll drops all prepared statements of the session on the server
+// and marks all Statements prepared with Prepare or PrepareRaw, which have
+// not been closed yet, as closed.
+func (conn *Conn) DeallocateAll() (err error) {
+	return conn.withRecover("*Conn.DeallocateAll", func() {
+		conn.deallocateAll()
+	})
+}
+
 func getpgpassfilename() string {
 	var env string
 	env = os.Getenv("PGPASSFILE")
@@ -493,6 +1078,33 @@ func (conn *Conn) execute(command string, params ...*Parameter) int64 {
 	return rs.rowsAffected
 }
 
+func (conn *Conn) executeScript(script string) []CommandResult {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.executeScript"))
+	}
+
+	rs := conn.query(script)
+	rs.close()
+
+	return rs.commandResults
+}
+
+// ExecuteScript sends SQL commands, separated by semicolons, to the server in a
+// single simple query and returns the result of each command, in order, e.g.
+// the statements of a migration.
+//
+// Rows returned by queries are discarded. If a command fails, the server
+// skips the remaining ones and the error is returned. Unless the script
+// contains explicit transaction control commands, all commands are executed
+// in a single implicit transaction, so none of them takes effect then.
+func (conn *Conn) ExecuteScript(script string) (results []CommandResult, err error) {
+	err = conn.withRecover("*Conn.ExecuteScript", func() {
+		results = conn.executeScript(script)
+	})
+
+	return
+}
+
 // Execute sends a SQL command to the server and returns the number
 // of rows affected.
 //
@@ -511,13 +1123,65 @@ func (conn *Conn) prepare(command string, params ...*Parameter) *Statement {
 		defer conn.logExit(conn.logEnter("*Conn.prepare"))
 	}
 
-	stmt := newStatement(conn, command, params)
+	if conn.transactionPooling() {
+		stmt := conn.prepareUnnamed(command, params...)
+		stmt.reparse = true
 
-	conn.state.prepare(stmt)
+		return stmt
+	}
+
+	stmt := newStatement(conn, command, params, false)
+	stmt.adjustCommand(conn.paramCasts)
+	stmt.checkParameters()
+
+	if conn.shareStatements {
+		conn.prepareShared(stmt)
+	} else {
+		conn.state.prepare(stmt)
+	}
+
+	conn.statements[stmt] = true
 
 	return stmt
 }
 
+// prepareShared lets stmt use an existing server-side prepared statement with
+// the same actual command and parameter types, or prepares a new one, which
+// later Statements can share.
+func (conn *Conn) prepareShared(stmt *Statement) {
+	key := stmt.shareKey()
+
+	if ss, ok := conn.sharedStatements[key]; ok {
+		if stateCode := conn.state.code(); stateCode != StatusReady {
+			panic(invalidOpForStateMsg)
+		}
+
+		stmt.name = ss.name
+		stmt.paramTypeOIDs = ss.paramTypeOIDs
+		stmt.returnsRows = ss.returnsRows
+
+		ss.refs++
+		stmt.shared = ss
+
+		return
+	}
+
+	conn.state.prepare(stmt)
+
+	if conn.sharedStatements == nil {
+		conn.sharedStatements = make(map[string]*sharedStatement)
+	}
+
+	stmt.shared = &sharedStatement{
+		key:           key,
+		name:          stmt.name,
+		refs:          1,
+		paramTypeOIDs: stmt.paramTypeOIDs,
+		returnsRows:   stmt.returnsRows,
+	}
+	conn.sharedStatements[key] = stmt.shared
+}
+
 // Prepare returns a new prepared Statement, optimized to be executed multiple
 // times with different parameter values.
 func (conn *Conn) Prepare(command string, params ...*Parameter) (stmt *Statement, err error) {
@@ -528,6 +1192,96 @@ func (conn *Conn) Prepare(command string, params ...*Parameter) (stmt *Statement
 	return
 }
 
+func (conn *Conn) prepareAuto(command string) *Statement {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.prepareAuto"))
+	}
+
+	var params []*Parameter
+	for _, name := range parameterNames(command) {
+		params = append(params, NewParameter(name, Custom))
+	}
+
+	return conn.prepare(command, params...)
+}
+
+// PrepareAuto works like Prepare, but creates a Parameter of type Custom for
+// each parameter name found in command, like @name or :name, so the types
+// are inferred by the server. Use *Statement.Parameter or
+// *Statement.Parameters to access them and set their values.
+func (conn *Conn) PrepareAuto(command string) (stmt *Statement, err error) {
+	err = conn.withRecover("*Conn.PrepareAuto", func() {
+		stmt = conn.prepareAuto(command)
+	})
+
+	return
+}
+
+func (conn *Conn) prepareUnnamed(command string, params ...*Parameter) *Statement {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.prepareUnnamed"))
+	}
+
+	stmt := newStatement(conn, command, params, true)
+	stmt.adjustCommand(conn.paramCasts)
+	stmt.checkParameters()
+
+	conn.state.prepare(stmt)
+
+	return stmt
+}
+
+// PrepareUnnamed returns a new Statement, prepared as the unnamed statement
+// and executed through the unnamed portal.
+//
+// The server plans the unnamed statement with the actual parameter values
+// when it is executed and discards it automatically, so it is the right
+// choice for commands that are executed only once. The Statement becomes
+// invalid when another unnamed statement is prepared or a simple query is
+// sent over the same connection. Calling Close is optional.
+func (conn *Conn) PrepareUnnamed(command string, params ...*Parameter) (stmt *Statement, err error) {
+	err = conn.withRecover("*Conn.PrepareUnnamed", func() {
+		stmt = conn.prepareUnnamed(command, params...)
+	})
+
+	return
+}
+
+func (conn *Conn) prepareRaw(command string, params []*Parameter) *Statement {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.prepareRaw"))
+	}
+
+	pooling := conn.transactionPooling()
+
+	stmt := newStatement(conn, command, params, pooling)
+
+	conn.state.prepare(stmt)
+
+	if pooling {
+		stmt.reparse = true
+	} else {
+		conn.statements[stmt] = true
+	}
+
+	return stmt
+}
+
+// PrepareRaw returns a new prepared Statement like Prepare, but sends command
+// to the server unchanged.
+//
+// The command must already refer to the parameters as $1..$n, where $i
+// corresponds to params[i-1]. Named parameters in the command are not
+// replaced and custom type names are not inserted as casts. This avoids the
+// cost of adjusting the command in code that prepares many statements.
+func (conn *Conn) PrepareRaw(command string, params []*Parameter) (stmt *Statement, err error) {
+	err = conn.withRecover("*Conn.PrepareRaw", func() {
+		stmt = conn.prepareRaw(command, params)
+	})
+
+	return
+}
+
 func (conn *Conn) query(command string, params ...*Parameter) (rs *ResultSet) {
 	if conn.LogLevel >= LogDebug {
 		defer conn.logExit(conn.logEnter("*Conn.query"))
@@ -536,6 +1290,7 @@ func (conn *Conn) query(command string, params ...*Parameter) (rs *ResultSet) {
 	var stmt *Statement
 	if len(params) == 0 {
 		r := newResultSet(conn)
+		r.command = command
 
 		conn.state.query(conn, r, command)
 
@@ -563,6 +1318,257 @@ func (conn *Conn) Query(command string, params ...*Parameter) (rs *ResultSet, er
 	return
 }
 
+func (conn *Conn) queryParams(command string, args ...interface{}) *ResultSet {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.queryParams"))
+	}
+
+	params := make([]*Parameter, len(args))
+	for i, arg := range args {
+		params[i] = newPositionalParameter(i+1, arg)
+	}
+
+	// The command already refers to $1..$n, so there is nothing to adjust.
+	stmt := newStatement(conn, command, params, true)
+
+	conn.state.prepare(stmt)
+
+	return stmt.query()
+}
+
+// QueryParams sends a SQL query with positional parameters $1..$n to the
+// server and returns a ResultSet for row-by-row retrieval of the results.
+//
+// The values of args are bound to $1..$n in order. The query is executed
+// using the unnamed statement and portal, so no prepared statement is left
+// behind on the server. Parameter types are inferred by the server and the
+// values are formatted accordingly, e.g. a time.Time bound to a date
+// parameter is sent as a date.
+//
+// The returned ResultSet must be closed before sending another
+// query or command to the server over the same connection.
+func (conn *Conn) QueryParams(command string, args ...interface{}) (rs *ResultSet, err error) {
+	err = conn.withRecover("*Conn.QueryParams", func() {
+		rs = conn.queryParams(command, args...)
+	})
+
+	return
+}
+
+// BackendPID returns the process ID of the server process handling this
+// connection, as reported in the BackendKeyData message at startup. It
+// matches the pid column of pg_stat_activity and %p in log_line_prefix.
+func (conn *Conn) BackendPID() int {
+	return int(conn.backendPID)
+}
+
+// Activity describes what a server process is doing, as reported by the
+// pg_stat_activity view. Fields the server reports as NULL are empty.
+type Activity struct {
+	State         string
+	WaitEventType string
+	WaitEvent     string
+	Query         string
+}
+
+func (conn *Conn) activity(pid int) (a Activity, found bool) {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.activity"))
+	}
+
+	rs := conn.queryParams("SELECT state, wait_event_type, wait_event, query FROM pg_stat_activity WHERE pid = $1;", pid)
+	defer rs.close()
+
+	found = rs.scanNext(&a.State, &a.WaitEventType, &a.WaitEvent, &a.Query)
+
+	return
+}
+
+// Activity returns the state and the wait event of the server process with
+// the specified pid, e.g. to find out whether a slow query is waiting for a
+// lock. found is false, if there is no such process.
+//
+// A connection is busy with this very query, while it queries its own
+// activity, so pass the BackendPID of the connection to observe and call
+// Activity on another connection. The server must be version 9.6 or later.
+func (conn *Conn) Activity(pid int) (a Activity, found bool, err error) {
+	err = conn.withRecover("*Conn.Activity", func() {
+		a, found = conn.activity(pid)
+	})
+
+	return
+}
+
+func (conn *Conn) cancel() {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.cancel"))
+	}
+
+	if conn.dial != nil {
+		panic(errors.New("cannot cancel on a connection without server address"))
+	}
+
+	c, err := conn.params.dialServer(conn.params.ConnectTimeout)
+	panicIfErr(err)
+	defer c.Close()
+
+	var msg [16]byte
+	binary.BigEndian.PutUint32(msg[0:], 16)
+	binary.BigEndian.PutUint32(msg[4:], cancelRequestCode)
+	binary.BigEndian.PutUint32(msg[8:], uint32(conn.backendPID))
+	binary.BigEndian.PutUint32(msg[12:], uint32(conn.backendSecretKey))
+
+	_, err = c.Write(msg[:])
+	panicIfErr(err)
+
+	// The server doesn't respond, it just closes the connection once it has
+	// processed the request.
+	ioutil.ReadAll(c)
+}
+
+// watchCancel starts a goroutine, which cancels the command processed on the
+// connection, when done receives a value or is closed. Call stop to end the
+// goroutine; once stop returns, no CancelRequest will be sent anymore.
+func (conn *Conn) watchCancel(done <-chan bool) (stop func()) {
+	stopc := make(chan bool)
+	exited := make(chan bool)
+
+	go func() {
+		defer close(exited)
+
+		select {
+		case <-done:
+			conn.Cancel()
+
+		case <-stopc:
+		}
+	}()
+
+	return func() {
+		close(stopc)
+		<-exited
+	}
+}
+
+// Cancel asks the server to cancel the command currently processed on the
+// connection, by sending a CancelRequest over a separate network connection.
+//
+// Unlike all other methods of Conn, Cancel may be called from another
+// goroutine while the connection is in use. If the cancellation succeeds,
+// the canceled command fails with an error. There is no guarantee that the
+// server acts on the request, and if no command is in progress, the request
+// has no effect.
+func (conn *Conn) Cancel() (err error) {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.Cancel"))
+	}
+
+	// Not withRecover, which marks the connection dead after a timeout.
+	// A timeout here concerns the separate network connection only, and
+	// the connection itself may be in use by another goroutine.
+	defer func() {
+		if x := recover(); x != nil {
+			err = conn.logAndConvertPanic(x)
+		}
+	}()
+
+	conn.cancel()
+
+	return
+}
+
+// drainToReadyForQuery reads and discards backend messages until the server
+// is ready for the next query. Non-fatal errors, e.g. the one caused by a
+// CancelRequest, are ignored.
+func (conn *Conn) drainToReadyForQuery() {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.drainToReadyForQuery"))
+	}
+
+	for conn.state.code() != StatusReady {
+		msgCode := conn.readMessageCode()
+
+		conn.checkMessageLength()
+
+		switch msgCode {
+		case _ErrorResponse:
+			func() {
+				defer func() {
+					if x := recover(); x != nil {
+						if err, ok := x.(*Error); !ok || err.isFatal() {
+							panic(x)
+						}
+					}
+				}()
+
+				// This also reads the ReadyForQuery following the error.
+				conn.readErrorOrNoticeResponse(true)
+			}()
+
+		case _NoticeResponse:
+			conn.readErrorOrNoticeResponse(false)
+
+		case _NotificationResponse:
+			conn.readNotificationResponse()
+
+		case _ParameterStatus:
+			conn.readParameterStatus()
+
+		case _ReadyForQuery:
+			conn.readReadyForQuery(nil)
+
+		default:
+			// Rows and other results of the aborted command are of no
+			// interest, so we skip them without decoding.
+			_, err := conn.reader.Discard(int(conn.readInt32()) - 4)
+			conn.panicIfReadErr(err)
+		}
+	}
+}
+
+func (conn *Conn) abort() {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.abort"))
+	}
+
+	switch conn.state.code() {
+	case StatusDisconnected:
+		panic(errors.New("connection closed"))
+
+	case StatusProcessingQuery:
+		conn.cancel()
+
+	case StatusCopy:
+		message := "aborted by client"
+		conn.writeFrontendMessageCode(_CopyFail)
+		conn.writeInt32(int32(5 + len(message)))
+		conn.writeString0(message)
+		conn.flush()
+	}
+
+	conn.drainToReadyForQuery()
+
+	if conn.transactionStatus != NotInTransaction {
+		conn.execute("ROLLBACK;")
+	}
+}
+
+// Abort cancels the command currently processed on the connection, if any,
+// discards its remaining results and rolls back the current transaction, so
+// the connection is ready for new commands afterwards.
+//
+// Running commands are canceled with a CancelRequest, as sent by Cancel, a
+// COPY in progress is aborted with CopyFail. Abort waits until the server
+// has processed the cancellation, which it may not act on immediately.
+//
+// ResultSets open at the time of the call must not be used afterwards, not
+// even closed, since their results have been discarded.
+func (conn *Conn) Abort() (err error) {
+	return conn.withRecover("*Conn.Abort", func() {
+		conn.abort()
+	})
+}
+
 // RuntimeParameter returns the value of the specified runtime parameter.
 //
 // If the value was successfully retrieved, ok is true, otherwise false.
@@ -575,6 +1581,77 @@ func (conn *Conn) RuntimeParameter(name string) (value string, ok bool) {
 	return
 }
 
+// parseServerVersion parses the major and minor version from a server_version
+// string, e.g. "8.4.1", "14.2", "15beta1" or "9.6.24 (Ubuntu 9.6.24-1)".
+func parseServerVersion(s string) (major, minor int, err error) {
+	digits := func() (n int, ok bool) {
+		i := 0
+		for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+			i++
+		}
+		if i == 0 {
+			return
+		}
+
+		n, err := strconv.Atoi(s[:i])
+		s = s[i:]
+
+		return n, err == nil
+	}
+
+	var ok bool
+	if major, ok = digits(); !ok {
+		err = fmt.Errorf("invalid server version: '%s'", s)
+		return
+	}
+
+	if strings.HasPrefix(s, ".") {
+		s = s[1:]
+		minor, _ = digits()
+	}
+
+	return
+}
+
+// ServerVersion returns the major and minor version of the server, as parsed
+// from the server_version runtime parameter.
+//
+// For servers before version 10, e.g. "8.4.1", the minor version is the
+// second number, for later servers, e.g. "14.2", it is the number after the
+// major version. Suffixes like in "15beta1" are ignored, so that minor is 0.
+func (conn *Conn) ServerVersion() (major, minor int, err error) {
+	version, ok := conn.runtimeParameters["server_version"]
+	if !ok {
+		err = errors.New("server_version not reported by server")
+		return
+	}
+
+	return parseServerVersion(version)
+}
+
+func (conn *Conn) fetchCursor(name string) *ResultSet {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.fetchCursor"))
+	}
+
+	return conn.query(fmt.Sprintf("FETCH ALL FROM %s;", quoteIdentifier(name)))
+}
+
+// FetchCursor fetches all remaining rows of the open cursor with the
+// specified name and returns them as a ResultSet.
+//
+// This is the way to consume the result sets of functions returning
+// refcursors: scan the cursor names returned by the function and call
+// FetchCursor for each of them, within the same transaction. name is quoted,
+// so it must match the cursor name exactly, as refcursor values do.
+func (conn *Conn) FetchCursor(name string) (rs *ResultSet, err error) {
+	err = conn.withRecover("*Conn.FetchCursor", func() {
+		rs = conn.fetchCursor(name)
+	})
+
+	return
+}
+
 func (conn *Conn) scan(command string, args ...interface{}) (*ResultSet, bool) {
 	if conn.LogLevel >= LogDebug {
 		defer conn.logExit(conn.logEnter("*Conn.scan"))
@@ -601,6 +1678,28 @@ func (conn *Conn) Scan(command string, args ...interface{}) (fetched bool, err e
 	return
 }
 
+// QueryScalar executes the query and scans the single field of the single row
+// it returns into dest, which must be of a pointer type, e.g. for
+// SELECT count(*) queries.
+//
+// An error is returned, if the query does not return exactly one row with
+// exactly one field.
+func (conn *Conn) QueryScalar(command string, dest interface{}, params ...*Parameter) (err error) {
+	err = conn.withRecover("*Conn.QueryScalar", func() {
+		conn.query(command, params...).scanScalar(dest)
+	})
+
+	return
+}
+
+// IsClosed returns if the connection has been closed, either by Close or
+// because an error left it unusable. It does not check the network
+// connection, so a connection the server dropped silently is not detected
+// until it is used.
+func (conn *Conn) IsClosed() bool {
+	return conn.state == nil || conn.state.code() == StatusDisconnected
+}
+
 // Status returns the current connection status.
 func (conn *Conn) Status() ConnStatus {
 	return conn.state.code()
@@ -611,6 +1710,101 @@ func (conn *Conn) TransactionStatus() TransactionStatus {
 	return conn.transactionStatus
 }
 
+func (conn *Conn) transactionIsReadOnly() bool {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.transactionIsReadOnly"))
+	}
+
+	if conn.readOnlyKnown && conn.transactionStatus == InTransaction {
+		return conn.readOnly
+	}
+
+	var value string
+	rs, _ := conn.scan("SHOW transaction_read_only;", &value)
+	rs.close()
+
+	readOnly := parseBool(value)
+
+	// Outside of a transaction block, each command runs in a transaction
+	// of its own, so there is nothing to cache.
+	if conn.transactionStatus == InTransaction {
+		conn.readOnly = readOnly
+		conn.readOnlyKnown = true
+	}
+
+	return readOnly
+}
+
+// TransactionIsReadOnly returns if the current transaction is read-only, or,
+// if no transaction is in progress, if transactions are read-only by default.
+//
+// Within a transaction block, the value queried from the server is cached
+// until the next command is executed, so repeated calls in between cost no
+// round trip.
+func (conn *Conn) TransactionIsReadOnly() (readOnly bool, err error) {
+	err = conn.withRecover("*Conn.TransactionIsReadOnly", func() {
+		readOnly = conn.transactionIsReadOnly()
+	})
+
+	return
+}
+
+// isolationLevels contains the isolation levels accepted by
+// SetDefaultTransactionIsolation.
+var isolationLevels = map[string]bool{
+	"READ UNCOMMITTED": true,
+	"READ COMMITTED":   true,
+	"REPEATABLE READ":  true,
+	"SERIALIZABLE":     true,
+}
+
+func (conn *Conn) setDefaultTransactionIsolation(level string) {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.setDefaultTransactionIsolation"))
+	}
+
+	conn.panicIfTransactionPooling("SetDefaultTransactionIsolation")
+
+	normalized := strings.ToUpper(strings.Join(strings.Fields(level), " "))
+	if !isolationLevels[normalized] {
+		panic(fmt.Errorf("invalid isolation level: '%s'", level))
+	}
+
+	conn.execute("SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL " + normalized + ";")
+}
+
+// SetDefaultTransactionIsolation sets the default isolation level of the
+// transactions of the current session.
+//
+// level must be one of "READ UNCOMMITTED", "READ COMMITTED", "REPEATABLE READ"
+// or "SERIALIZABLE", case is ignored. Note that WithTransaction and
+// WithSavepoint always set the isolation level of the transactions they
+// start explicitly.
+func (conn *Conn) SetDefaultTransactionIsolation(level string) (err error) {
+	err = conn.withRecover("*Conn.SetDefaultTransactionIsolation", func() {
+		conn.setDefaultTransactionIsolation(level)
+	})
+
+	return
+}
+
+// SetDefaultTransactionReadOnly sets whether the transactions of the current
+// session are read-only by default.
+func (conn *Conn) SetDefaultTransactionReadOnly(readOnly bool) (err error) {
+	err = conn.withRecover("*Conn.SetDefaultTransactionReadOnly", func() {
+		conn.panicIfTransactionPooling("SetDefaultTransactionReadOnly")
+
+		mode := "READ WRITE"
+		if readOnly {
+			mode = "READ ONLY"
+		}
+
+		conn.execute("SET SESSION CHARACTERISTICS AS TRANSACTION " + mode + ";")
+	})
+
+	return
+}
+
 // WithTransaction starts a new transaction, if none is in progress, then
 // calls f.
 //
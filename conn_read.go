@@ -5,37 +5,77 @@
 package pgsql
 
 import (
-	"crypto/md5"
 	"encoding/binary"
-	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
 )
 
+// errConnClosedMidMessage is returned, if the connection is closed while a
+// message has only been received in part, e.g. because the server crashed.
+var errConnClosedMidMessage = errors.New("connection closed mid-message")
+
+// panicIfReadErr panics with err, if it is not nil. An EOF while reading a
+// message means the connection is gone, so it is closed.
+func (conn *Conn) panicIfReadErr(err error) {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		conn.markDead()
+		panic(errConnClosedMidMessage)
+	}
+
+	panicIfErr(err)
+}
+
 func (conn *Conn) read(b []byte) {
-	readTotal := 0
-	for {
-		n, err := conn.reader.Read(b[readTotal:])
-		panicIfErr(err)
+	_, err := io.ReadFull(conn.reader, b)
+	conn.panicIfReadErr(err)
+}
 
-		readTotal += n
-		if readTotal == len(b) {
-			break
-		}
+// readMessageCode reads the code of the next backend message. Unlike within a
+// message, an EOF here is reported as io.EOF, but the connection is closed as
+// well.
+func (conn *Conn) readMessageCode() backendMessageCode {
+	b, err := conn.reader.ReadByte()
+	if err == io.EOF {
+		conn.markDead()
+	}
+	panicIfErr(err)
+
+	return backendMessageCode(b)
+}
+
+// checkMessageLength peeks at the length of the next message and closes the
+// connection, if it exceeds the maximum message size. This protects against
+// huge allocations caused by a broken or malicious server.
+func (conn *Conn) checkMessageLength() {
+	b, err := conn.reader.Peek(4)
+	conn.panicIfReadErr(err)
+
+	conn.checkLength(int32(binary.BigEndian.Uint32(b)))
+}
+
+func (conn *Conn) checkLength(length int32) {
+	if length <= conn.maxMessageSize {
+		return
 	}
+
+	conn.markDead()
+
+	panic(fmt.Sprintf("message size %d exceeds maximum of %d bytes, connection closed", length, conn.maxMessageSize))
 }
 
 func (conn *Conn) readByte() byte {
 	b, err := conn.reader.ReadByte()
-	panicIfErr(err)
+	conn.panicIfReadErr(err)
 
 	return b
 }
 
 func (conn *Conn) readBytes(delim byte) []byte {
 	b, err := conn.reader.ReadBytes(delim)
-	panicIfErr(err)
+	conn.panicIfReadErr(err)
 
 	return b
 }
@@ -66,57 +106,39 @@ func (conn *Conn) readAuthenticationRequest() {
 		defer conn.logExit(conn.logEnter("*Conn.readAuthenticationRequest"))
 	}
 
-	// Just eat message length.
-	conn.readInt32()
-
-	authType := conn.readInt32()
-	switch authenticationType(authType) {
-	case _AuthenticationOk:
-		// nop
-
-		//		case _AuthenticationKerberosV5 authenticationType:
-
-		//		case _AuthenticationCleartextPassword:
-
-	case _AuthenticationMD5Password:
-		salt := make([]byte, 4)
-
-		conn.read(salt)
-
-		md5Hasher := md5.New()
-
-		_, err := md5Hasher.Write([]byte(conn.params.Password))
-		panicIfErr(err)
-
-		_, err = md5Hasher.Write([]byte(conn.params.User))
-		panicIfErr(err)
-
-		md5HashHex1 := hex.EncodeToString(md5Hasher.Sum(nil))
-
-		md5Hasher.Reset()
-
-		_, err = md5Hasher.Write([]byte(md5HashHex1))
-		panicIfErr(err)
-
-		_, err = md5Hasher.Write(salt)
-		panicIfErr(err)
-
-		md5HashHex2 := hex.EncodeToString(md5Hasher.Sum(nil))
+	msgLen := conn.readInt32()
+	conn.checkLength(msgLen)
 
-		password := "md5" + md5HashHex2
-
-		conn.writePasswordMessage(password)
+	if msgLen < 8 {
+		// Length and authentication type are required.
+		conn.markDead()
+		panic(fmt.Sprintf("invalid AuthenticationRequest message length: %d, connection closed", msgLen))
+	}
 
-		//		case _AuthenticationSCMCredential:
+	authType := conn.readInt32()
+	if authenticationType(authType) == _AuthenticationOk {
+		return
+	}
 
-		//		case _AuthenticationGSS:
+	data := make([]byte, msgLen-8)
+	if len(data) > 0 {
+		conn.read(data)
+	}
 
-		//		case _AuthenticationGSSContinue:
+	var auth Authenticator = PasswordAuthenticator{}
+	if conn.params.Authenticator != nil {
+		auth = conn.params.Authenticator
+	}
 
-		//		case _AuthenticationSSPI:
+	response, err := auth.Authenticate(conn, authType, data)
+	if err != nil {
+		// The connection can't proceed, so don't wait for any more messages.
+		conn.markDead()
+		panic(err)
+	}
 
-	default:
-		panic(fmt.Sprintf("unsupported authentication type: %d", authType))
+	if response != nil {
+		conn.writePasswordMessage(response)
 	}
 }
 
@@ -166,11 +188,13 @@ func (conn *Conn) readCommandComplete(rs *ResultSet) {
 
 		rs.rowsAffected, _ = strconv.ParseInt(parts[len(parts)-1], 10, 64)
 		rs.currentResultComplete = true
+
+		rs.commandResults = append(rs.commandResults, CommandResult{tag, rs.rowsAffected})
 	}
 }
 
 // As of PostgreSQL 9.2 (protocol 3.0), CopyOutResponse and CopyBothResponse
-// are exactly the same.
+// are exactly the same, so this reads CopyBothResponse as well.
 func (conn *Conn) readCopyInResponse() {
 	if conn.LogLevel >= LogDebug {
 		defer conn.logExit(conn.logEnter("*Conn.readCopyInResponse"))
@@ -192,11 +216,20 @@ func (conn *Conn) readCopyInResponse() {
 }
 
 func (conn *Conn) readDataRow(rs *ResultSet) {
-	// Just eat message length.
-	conn.readInt32()
+	msgLen := conn.readInt32()
 
 	fieldCount := conn.readInt16()
 
+	// With a ScanBuffer, all values of the row are read into its data,
+	// which is reused for subsequent rows.
+	var data []byte
+	if rs.scanBuffer != nil {
+		data = rs.scanBuffer.data[:0]
+		if cap(data) < int(msgLen) {
+			data = make([]byte, 0, msgLen)
+		}
+	}
+
 	var ord int16
 	for ord = 0; ord < fieldCount; ord++ {
 		valLen := conn.readInt32()
@@ -206,12 +239,23 @@ func (conn *Conn) readDataRow(rs *ResultSet) {
 		if valLen == -1 {
 			val = nil
 		} else {
-			val = make([]byte, valLen)
+			conn.checkLength(valLen)
+			if rs.scanBuffer != nil {
+				start := len(data)
+				data = data[:start+int(valLen)]
+				val = data[start:len(data):len(data)]
+			} else {
+				val = make([]byte, valLen)
+			}
 			conn.read(val)
 		}
 
 		rs.values[ord] = val
 	}
+
+	if rs.scanBuffer != nil {
+		rs.scanBuffer.data = data
+	}
 }
 
 func (conn *Conn) readEmptyQueryResponse() {
@@ -239,6 +283,15 @@ func (conn *Conn) readErrorOrNoticeResponse(isError bool) {
 
 		if fieldType == 0 {
 			if isError {
+				if err.isFatal() {
+					// The server closes the connection after a FATAL error,
+					// e.g. one caused by pg_terminate_backend, so there
+					// will be no ReadyForQuery message.
+					conn.markDead()
+
+					panic(err)
+				}
+
 				if !conn.onErrorDontRequireReadyForQuery {
 					// Before panicking, we have to wait for a ReadyForQuery message.
 					conn.readBackendMessages(nil)
@@ -247,8 +300,8 @@ func (conn *Conn) readErrorOrNoticeResponse(isError bool) {
 				// We panic with our error as parameter, so the right thing (TM) will happen.
 				panic(err)
 			} else {
-				// For now, we just log notices.
 				conn.logError(LogDebug, err)
+				conn.dispatchEvent(&Notice{*err})
 				return
 			}
 		}
@@ -295,13 +348,56 @@ func (conn *Conn) readErrorOrNoticeResponse(isError bool) {
 	}
 }
 
-func (conn *Conn) readNoData() {
+func (conn *Conn) readNoData(rs *ResultSet) {
 	if conn.LogLevel >= LogDebug {
 		defer conn.logExit(conn.logEnter("*Conn.readNoData"))
 	}
 
 	// Just eat message length.
 	conn.readInt32()
+
+	// The statement or portal returns no rows, so there are no fields.
+	if rs != nil {
+		rs.fields = nil
+		rs.values = nil
+	}
+}
+
+func (conn *Conn) readNotificationResponse() {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.readNotificationResponse"))
+	}
+
+	// Just eat message length.
+	conn.readInt32()
+
+	n := &Notification{}
+
+	n.PID = conn.readInt32()
+	n.Channel = conn.readString()
+	n.Payload = conn.readString()
+
+	conn.dispatchEvent(n)
+}
+
+func (conn *Conn) readParameterDescription(rs *ResultSet) {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.readParameterDescription"))
+	}
+
+	// Just eat message length.
+	conn.readInt32()
+
+	paramCount := conn.readInt16()
+
+	oids := make([]int32, paramCount)
+	for i := range oids {
+		oids[i] = conn.readInt32()
+	}
+
+	if rs != nil && rs.stmt != nil {
+		rs.stmt.paramTypeOIDs = oids
+	}
 }
 
 func (conn *Conn) readParameterStatus() {
@@ -351,6 +447,10 @@ func (conn *Conn) readReadyForQuery(rs *ResultSet) {
 
 	conn.transactionStatus = TransactionStatus(txStatus)
 
+	// The command may have ended the transaction or changed its
+	// characteristics, e.g. "COMMIT; BEGIN READ ONLY;".
+	conn.readOnlyKnown = false
+
 	if rs != nil {
 		rs.allResultsComplete = true
 	}
@@ -370,20 +470,11 @@ func (conn *Conn) readRowDescription(rs *ResultSet) {
 	var ord int16
 	for ord = 0; ord < fieldCount; ord++ {
 		rs.fields[ord].name = conn.readString()
-
-		// Just eat table OID.
-		conn.readInt32()
-
-		// Just eat field OID.
-		conn.readInt16()
-
+		rs.fields[ord].tableOID = conn.readInt32()
+		rs.fields[ord].attNum = conn.readInt16()
 		rs.fields[ord].typeOID = conn.readInt32()
-
-		// Just eat field size.
-		conn.readInt16()
-
-		// Just eat field type modifier.
-		conn.readInt32()
+		rs.fields[ord].typeSize = conn.readInt16()
+		rs.fields[ord].typeMod = conn.readInt32()
 
 		format := fieldFormat(conn.readInt16())
 		switch format {
@@ -397,13 +488,85 @@ func (conn *Conn) readRowDescription(rs *ResultSet) {
 	}
 }
 
+// errUnexpectedStartupResponse is returned, if the response to the startup
+// message does not look like one of a PostgreSQL server.
+var errUnexpectedStartupResponse = errors.New("unexpected server response; not a PostgreSQL server or unsupported protocol version (the driver requires protocol 3.0)")
+
+// checkStartupResponse checks that the server responds to the startup message
+// with an AuthenticationRequest or ErrorResponse, as PostgreSQL servers
+// speaking protocol 3.0 do, before the response is processed. Servers that
+// only speak older protocol versions respond with an ErrorResponse without
+// length, while other servers respond with anything.
+func (conn *Conn) checkStartupResponse() {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.checkStartupResponse"))
+	}
+
+	for {
+		b, err := conn.reader.Peek(5)
+		if err == io.EOF && len(b) > 0 {
+			panic(errUnexpectedStartupResponse)
+		}
+		panicIfErr(err)
+
+		length := int32(binary.BigEndian.Uint32(b[1:]))
+
+		switch backendMessageCode(b[0]) {
+		case _AuthenticationRequest:
+			if length >= 8 && length <= conn.maxMessageSize {
+				return
+			}
+
+		case _ErrorResponse:
+			if length >= 5 && length <= conn.maxMessageSize {
+				return
+			}
+
+		case _NegotiateProtocol:
+			if length >= 12 && length <= conn.maxMessageSize {
+				conn.readByte()
+				conn.readNegotiateProtocolVersion()
+				continue
+			}
+		}
+
+		panic(errUnexpectedStartupResponse)
+	}
+}
+
+// readNegotiateProtocolVersion reads a NegotiateProtocolVersion message, which
+// the server sends, if it does not support the requested minor version or
+// protocol options. Since we request version 3.0 without options, the server
+// can continue with the startup, so we just log it.
+func (conn *Conn) readNegotiateProtocolVersion() {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.readNegotiateProtocolVersion"))
+	}
+
+	// Just eat message length.
+	conn.readInt32()
+
+	minorVersion := conn.readInt32()
+
+	options := make([]string, conn.readInt32())
+	for i := range options {
+		options[i] = conn.readString()
+	}
+
+	if conn.LogLevel >= LogDebug {
+		conn.logf(LogDebug, "server supports protocol version 3.%d, unsupported options: %v", minorVersion, options)
+	}
+}
+
 func (conn *Conn) readBackendMessages(rs *ResultSet) {
 	if conn.LogLevel >= LogDebug {
 		defer conn.logExit(conn.logEnter("*Conn.readBackendMessages"))
 	}
 
 	for {
-		msgCode := backendMessageCode(conn.readByte())
+		msgCode := conn.readMessageCode()
+
+		conn.checkMessageLength()
 
 		if conn.LogLevel >= LogDebug {
 			conn.logf(LogDebug, "received '%s' backend message", msgCode)
@@ -427,7 +590,7 @@ func (conn *Conn) readBackendMessages(rs *ResultSet) {
 			conn.readCommandComplete(rs)
 			return
 
-		case _CopyInResponse:
+		case _CopyInResponse, _CopyOutResponse, _CopyBothResponse:
 			conn.readCopyInResponse()
 			return
 
@@ -442,12 +605,19 @@ func (conn *Conn) readBackendMessages(rs *ResultSet) {
 			conn.readErrorOrNoticeResponse(true)
 
 		case _NoData:
-			conn.readNoData()
+			conn.readNoData(rs)
 			return
 
 		case _NoticeResponse:
 			conn.readErrorOrNoticeResponse(false)
 
+		case _NotificationResponse:
+			conn.readNotificationResponse()
+
+		case _ParameterDescription:
+			conn.readParameterDescription(rs)
+			return
+
 		case _ParameterStatus:
 			conn.readParameterStatus()
 
@@ -5,10 +5,15 @@
 package pgsql
 
 import (
+	"database/sql/driver"
+	"encoding"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"math"
 	"math/big"
+	"net"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -88,93 +93,191 @@ func (conn *Conn) writeFlush() {
 	conn.flush()
 }
 
-func (conn *Conn) writeBind(stmt *Statement) {
-	values := make([]string, len(stmt.params))
+// formatParamValue returns the text format representation of a parameter
+// value to be sent to the server for type typ.
+//
+// Built-in types take precedence, so e.g. time.Time is formatted according to
+// typ, or like for TimestampTZ, if typ is not a date or time type. Values of other types are formatted using the first of these
+// interfaces they implement: driver.Valuer, encoding.TextMarshaler and
+// fmt.Stringer. []byte values are formatted in hex format for bytea and as
+// they are for other types. Other slices are formatted as one-dimensional
+// arrays, e.g. for text[] parameters.
+func formatParamValue(typ Type, value interface{}) (s string, isNull bool) {
+	if val, ok := value.(uint64); ok {
+		value = int64(val)
+	}
 
-	var paramValuesLen int
-	for i, param := range stmt.params {
-		value := param.value
-		if val, ok := value.(uint64); ok {
-			value = int64(val)
-		}
+	if value != nil && isNilPtr(value) {
+		isNull = true
+		return
+	}
 
-		switch val := value.(type) {
-		case bool:
-			if val {
-				values[i] = "t"
-			} else {
-				values[i] = "f"
-			}
+	switch val := value.(type) {
+	case bool:
+		s = strconv.FormatBool(val)
 
-		case byte:
-			values[i] = string([]byte{val})
+	case byte:
+		s = string([]byte{val})
 
-		case float32:
-			values[i] = strconv.FormatFloat(float64(val), 'f', -1, 32)
+	case float32:
+		s = strconv.FormatFloat(float64(val), 'f', -1, 32)
 
-		case float64:
-			values[i] = strconv.FormatFloat(val, 'f', -1, 64)
+	case float64:
+		s = strconv.FormatFloat(val, 'f', -1, 64)
 
-		case int:
-			values[i] = strconv.Itoa(val)
+	case int:
+		s = strconv.Itoa(val)
 
-		case int16:
-			values[i] = strconv.Itoa(int(val))
+	case int16:
+		s = strconv.Itoa(int(val))
 
-		case int32:
-			values[i] = strconv.Itoa(int(val))
+	case int32:
+		s = strconv.Itoa(int(val))
 
-		case int64:
-			switch param.typ {
-			case Date:
-				values[i] = time.Unix(val, 0).UTC().Format("2006-01-02")
+	case int64:
+		switch typ {
+		case Date:
+			s = time.Unix(val, 0).UTC().Format("2006-01-02")
 
-			case Time, TimeTZ:
-				values[i] = time.Unix(val, 0).UTC().Format("15:04:05")
+		case Time, TimeTZ:
+			s = time.Unix(val, 0).UTC().Format("15:04:05")
 
-			case Timestamp, TimestampTZ:
-				values[i] = time.Unix(val, 0).UTC().Format("2006-01-02 15:04:05")
+		case Timestamp, TimestampTZ:
+			s = time.Unix(val, 0).UTC().Format("2006-01-02 15:04:05")
 
-			default:
-				values[i] = strconv.FormatInt(val, 10)
-			}
+		default:
+			s = strconv.FormatInt(val, 10)
+		}
 
-		case nil:
+	case nil:
+		isNull = true
 
-		case *big.Rat:
-			if val.IsInt() {
-				values[i] = val.Num().String()
-			} else {
-				// FIXME: Find a better way to do this.
-				prec999 := val.FloatString(999)
-				trimmed := strings.TrimRight(prec999, "0")
-				sepIndex := strings.Index(trimmed, ".")
-				prec := len(trimmed) - sepIndex - 1
-				values[i] = val.FloatString(prec)
-			}
+	case *big.Int:
+		s = val.String()
 
-		case string:
-			values[i] = val
+	case *big.Rat:
+		s = formatRat(val)
 
-		case time.Time:
-			switch param.typ {
-			case Date:
-				values[i] = val.Format("2006-01-02")
+	case string:
+		s = val
 
-			case Time, TimeTZ:
-				values[i] = val.Format("15:04:05")
+	case []byte:
+		if val == nil {
+			isNull = true
+		} else if typ == Bytea {
+			s = `\x` + hex.EncodeToString(val)
+		} else {
+			s = string(val)
+		}
+
+	case net.HardwareAddr:
+		s = val.String()
+
+	case TimeOfDay:
+		s = val.String()
 
-			case Timestamp, TimestampTZ:
-				values[i] = val.Format("2006-01-02 15:04:05")
+	case time.Time:
+		switch typ {
+		case Date:
+			s = val.Format("2006-01-02")
 
-			default:
-				panic("invalid use of time.Time")
-			}
+		case Time, TimeTZ:
+			s = val.Format("15:04:05")
+
+		case Timestamp:
+			s = val.Format("2006-01-02 15:04:05")
 
 		default:
+			// Like timestamptz, which keeps the instant, e.g. if the
+			// server infers text for `SELECT $1`.
+			s = val.Format("2006-01-02 15:04:05-07:00")
+		}
+
+	case driver.Valuer:
+		v, err := val.Value()
+		panicIfErr(err)
+
+		if _, ok := v.(driver.Valuer); ok {
+			panic("driver.Valuer returned a driver.Valuer")
+		}
+
+		s, isNull = formatParamValue(typ, v)
+
+	case encoding.TextMarshaler:
+		b, err := val.MarshalText()
+		panicIfErr(err)
+
+		s = string(b)
+
+	case fmt.Stringer:
+		s = val.String()
+
+	default:
+		v := reflect.ValueOf(value)
+		if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
 			panic("unsupported parameter type")
 		}
 
+		if v.IsNil() {
+			isNull = true
+		} else {
+			s = formatArray(typ, v)
+		}
+	}
+
+	return
+}
+
+// formatRat returns the decimal representation of r with as many fractional
+// digits as needed, e.g. "1.5".
+func formatRat(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+
+	// FIXME: Find a better way to do this.
+	prec999 := r.FloatString(999)
+	trimmed := strings.TrimRight(prec999, "0")
+	sepIndex := strings.Index(trimmed, ".")
+	prec := len(trimmed) - sepIndex - 1
+
+	return r.FloatString(prec)
+}
+
+// formatParam returns the text representation of the value of the parameter
+// of stmt with the specified index, as it is sent in a Bind message, and the
+// type it has been formatted for.
+func (conn *Conn) formatParam(stmt *Statement, i int) (typ Type, s string, isNull bool) {
+	param := stmt.params[i]
+
+	// If the type was left for the server to infer, use the type from the
+	// ParameterDescription. A custom time type name takes precedence though,
+	// so time values are formatted as intended.
+	typ = param.typ
+	if typ == Custom {
+		if t, ok := customTimeTypes[strings.ToLower(param.customTypeName)]; ok {
+			typ = t
+		} else if i < len(stmt.paramTypeOIDs) {
+			typ = Type(stmt.paramTypeOIDs[i])
+		}
+	}
+
+	s, isNull = formatParamValue(typ, param.value)
+	if v, ok := param.value.(string); ok && v == "" && conn.emptyStringAsNull {
+		isNull = true
+	}
+
+	return
+}
+
+func (conn *Conn) writeBind(stmt *Statement) {
+	values := make([]string, len(stmt.params))
+	nulls := make([]bool, len(stmt.params))
+
+	var paramValuesLen int
+	for i := range stmt.params {
+		_, values[i], nulls[i] = conn.formatParam(stmt, i)
+
 		paramValuesLen += len(values[i])
 	}
 
@@ -193,8 +296,8 @@ func (conn *Conn) writeBind(stmt *Statement) {
 	conn.writeInt16(int16(textFormat))
 	conn.writeInt16(int16(len(stmt.params)))
 
-	for i, param := range stmt.params {
-		if param.value == nil {
+	for i := range stmt.params {
+		if nulls[i] {
 			conn.writeInt32(-1)
 		} else {
 			conn.writeInt32(int32(len(values[i])))
@@ -230,6 +333,17 @@ func (conn *Conn) writeDescribe(stmt *Statement) {
 	conn.writeFlush()
 }
 
+func (conn *Conn) writeDescribeStatement(stmt *Statement) {
+	msgLen := int32(4 + 1 + len(stmt.name) + 1)
+
+	conn.writeFrontendMessageCode(_Describe)
+	conn.writeInt32(msgLen)
+	conn.writeByte('S')
+	conn.writeString0(stmt.name)
+
+	conn.writeFlush()
+}
+
 func (conn *Conn) writeExecute(stmt *Statement) {
 	msgLen := int32(4 + len(stmt.portalName) + 1 + 4)
 
@@ -270,22 +384,26 @@ func (conn *Conn) writeParse(stmt *Statement) {
 			// and it worked. The corresponding field in the table was CHAR(32).
 			typ = Varchar
 		}
+		if typeName := param.castTypeName(conn.paramCasts); typ == Custom && typeName != "" {
+			// Zero (unspecified) for types not known by OID.
+			typ = Type(customTypeOIDs[strings.ToLower(strings.TrimSpace(typeName))])
+		}
 		conn.writeInt32(int32(typ))
 	}
 
 	conn.writeFlush()
 }
 
-func (conn *Conn) writePasswordMessage(password string) {
+func (conn *Conn) writePasswordMessage(data []byte) {
 	if conn.LogLevel >= LogDebug {
 		defer conn.logExit(conn.logEnter("*Conn.writePasswordMessage"))
 	}
 
-	msgLen := int32(4 + len(password) + 1)
+	msgLen := int32(4 + len(data))
 
 	conn.writeFrontendMessageCode(_PasswordMessage)
 	conn.writeInt32(msgLen)
-	conn.writeString0(password)
+	conn.write(data)
 
 	conn.flush()
 }
@@ -314,6 +432,9 @@ func (conn *Conn) writeStartup() {
 	msglen := int32(4 + 4 +
 		len("user") + 1 + len(conn.params.User) + 1 +
 		len("database") + 1 + len(conn.params.Database) + 1 + 1)
+	if conn.params.Replication != "" {
+		msglen += int32(len("replication") + 1 + len(conn.params.Replication) + 1)
+	}
 
 	conn.writeInt32(msglen)
 
@@ -326,6 +447,11 @@ func (conn *Conn) writeStartup() {
 	conn.writeString0("database")
 	conn.writeString0(conn.params.Database)
 
+	if conn.params.Replication != "" {
+		conn.writeString0("replication")
+		conn.writeString0(conn.params.Replication)
+	}
+
 	conn.writeByte(0)
 
 	conn.flush()
@@ -0,0 +1,738 @@
+// Copyright 2013 The go-pgsql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgsql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// copyBinarySignature starts the header of the binary COPY format.
+const copyBinarySignature = "PGCOPY\n\377\r\n\000"
+
+// pgEpochUnix is 2000-01-01 00:00:00 UTC, the epoch of binary date and
+// timestamp values, in seconds since the Unix epoch.
+const pgEpochUnix = 946684800
+
+// encodeBinaryValue appends the binary representation of v for a field of the
+// type with the specified OID to buf.
+func encodeBinaryValue(buf *bytes.Buffer, typeOID int32, v interface{}) {
+	switch typeOID {
+	case _BOOLOID:
+		val, ok := v.(bool)
+		if !ok {
+			panicInvalidBinaryValue(typeOID, v)
+		}
+		if val {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+
+	case _INT2OID:
+		i := binaryInt(typeOID, v)
+		if i < math.MinInt16 || i > math.MaxInt16 {
+			panicInvalidBinaryValue(typeOID, v)
+		}
+		binary.Write(buf, binary.BigEndian, int16(i))
+
+	case _INT4OID:
+		i := binaryInt(typeOID, v)
+		if i < math.MinInt32 || i > math.MaxInt32 {
+			panicInvalidBinaryValue(typeOID, v)
+		}
+		binary.Write(buf, binary.BigEndian, int32(i))
+
+	case _OIDOID:
+		i := binaryInt(typeOID, v)
+		if i < 0 || i > math.MaxUint32 {
+			panicInvalidBinaryValue(typeOID, v)
+		}
+		binary.Write(buf, binary.BigEndian, uint32(i))
+
+	case _INT8OID:
+		binary.Write(buf, binary.BigEndian, binaryInt(typeOID, v))
+
+	case _FLOAT4OID:
+		binary.Write(buf, binary.BigEndian, float32(binaryFloat(typeOID, v)))
+
+	case _FLOAT8OID:
+		binary.Write(buf, binary.BigEndian, binaryFloat(typeOID, v))
+
+	case _BPCHAROID, _CHAROID, _NAMEOID, _TEXTOID, _VARCHAROID:
+		if b, ok := v.([]byte); ok {
+			buf.Write(b)
+		} else {
+			s, _ := formatParamValue(Custom, v)
+			buf.WriteString(s)
+		}
+
+	case _BYTEAOID:
+		switch val := v.(type) {
+		case []byte:
+			buf.Write(val)
+
+		case string:
+			buf.WriteString(val)
+
+		default:
+			panicInvalidBinaryValue(typeOID, v)
+		}
+
+	case _DATEOID:
+		t := binaryTime(typeOID, v)
+		wall := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		binary.Write(buf, binary.BigEndian, int32((wall.Unix()-pgEpochUnix)/86400))
+
+	case _TIMESTAMPOID:
+		t := binaryTime(typeOID, v)
+		wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+		binary.Write(buf, binary.BigEndian, pgMicroseconds(wall))
+
+	case _TIMESTAMPTZOID:
+		binary.Write(buf, binary.BigEndian, pgMicroseconds(binaryTime(typeOID, v)))
+
+	case _NUMERICOID:
+		s, _ := formatParamValue(Numeric, v)
+		encodeBinaryNumeric(buf, s)
+
+	case _UUIDOID:
+		s, ok := v.(string)
+		if !ok {
+			panicInvalidBinaryValue(typeOID, v)
+		}
+		b, err := hex.DecodeString(strings.Replace(strings.Trim(s, "{}"), "-", "", -1))
+		if err != nil || len(b) != 16 {
+			panicInvalidBinaryValue(typeOID, v)
+		}
+		buf.Write(b)
+
+	default:
+		panic(fmt.Sprintf("binary COPY does not support type OID: %d", typeOID))
+	}
+}
+
+func panicInvalidBinaryValue(typeOID int32, v interface{}) {
+	panic(fmt.Sprintf("invalid value for type OID %d: '%v' (Go type: %T)", typeOID, v, v))
+}
+
+func binaryInt(typeOID int32, v interface{}) int64 {
+	switch val := v.(type) {
+	case int:
+		return int64(val)
+
+	case int8:
+		return int64(val)
+
+	case int16:
+		return int64(val)
+
+	case int32:
+		return int64(val)
+
+	case int64:
+		return val
+
+	case uint:
+		return int64(val)
+
+	case uint8:
+		return int64(val)
+
+	case uint16:
+		return int64(val)
+
+	case uint32:
+		return int64(val)
+
+	case uint64:
+		if val > math.MaxInt64 {
+			panicInvalidBinaryValue(typeOID, v)
+		}
+		return int64(val)
+	}
+
+	panicInvalidBinaryValue(typeOID, v)
+	return 0
+}
+
+func binaryFloat(typeOID int32, v interface{}) float64 {
+	switch val := v.(type) {
+	case float32:
+		return float64(val)
+
+	case float64:
+		return val
+	}
+
+	return float64(binaryInt(typeOID, v))
+}
+
+// binaryTime returns v as time.Time. Like elsewhere, int64 values are
+// interpreted as seconds since the Unix epoch.
+func binaryTime(typeOID int32, v interface{}) time.Time {
+	switch val := v.(type) {
+	case time.Time:
+		return val
+
+	case int64:
+		return time.Unix(val, 0).UTC()
+	}
+
+	panicInvalidBinaryValue(typeOID, v)
+	return time.Time{}
+}
+
+func pgMicroseconds(t time.Time) int64 {
+	return (t.Unix()-pgEpochUnix)*1000000 + int64(t.Nanosecond()/1000)
+}
+
+// encodeBinaryNumeric appends the binary representation of the decimal number
+// s, e.g. "-123.45", to buf.
+func encodeBinaryNumeric(buf *bytes.Buffer, s string) {
+	var sign uint16
+	if strings.HasPrefix(s, "-") {
+		sign = 0x4000
+		s = s[1:]
+	}
+
+	intPart, fracPart := s, ""
+	if i := strings.Index(s, "."); i != -1 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	dscale := len(fracPart)
+
+	intPart = strings.TrimLeft(intPart, "0")
+
+	// Pad both parts to whole base 10000 digits.
+	if n := len(intPart) % 4; n != 0 {
+		intPart = strings.Repeat("0", 4-n) + intPart
+	}
+	if n := len(fracPart) % 4; n != 0 {
+		fracPart += strings.Repeat("0", 4-n)
+	}
+
+	var digits []int16
+	weight := len(intPart)/4 - 1
+	for _, part := range []string{intPart, fracPart} {
+		for i := 0; i < len(part); i += 4 {
+			var d int16
+			for _, c := range part[i : i+4] {
+				if c < '0' || c > '9' {
+					panic(fmt.Sprintf("invalid numeric value: '%s'", s))
+				}
+				d = d*10 + int16(c-'0')
+			}
+			digits = append(digits, d)
+		}
+	}
+
+	for len(digits) > 0 && digits[0] == 0 {
+		digits = digits[1:]
+		weight--
+	}
+	for len(digits) > 0 && digits[len(digits)-1] == 0 {
+		digits = digits[:len(digits)-1]
+	}
+	if len(digits) == 0 {
+		sign, weight = 0, 0
+	}
+
+	binary.Write(buf, binary.BigEndian, int16(len(digits)))
+	binary.Write(buf, binary.BigEndian, int16(weight))
+	binary.Write(buf, binary.BigEndian, sign)
+	binary.Write(buf, binary.BigEndian, int16(dscale))
+	binary.Write(buf, binary.BigEndian, digits)
+}
+
+// decodeBinaryValue decodes the binary representation b of a value of the
+// type with the specified OID, as the inverse of encodeBinaryValue.
+func (conn *Conn) decodeBinaryValue(typeOID int32, b []byte) interface{} {
+	checkLen := func(n int) {
+		if len(b) != n {
+			panic(fmt.Sprintf("invalid binary value length for type OID %d: %d", typeOID, len(b)))
+		}
+	}
+
+	switch typeOID {
+	case _BOOLOID:
+		checkLen(1)
+		return b[0] != 0
+
+	case _INT2OID:
+		checkLen(2)
+		return int16(binary.BigEndian.Uint16(b))
+
+	case _INT4OID:
+		checkLen(4)
+		return int(int32(binary.BigEndian.Uint32(b)))
+
+	case _OIDOID:
+		checkLen(4)
+		return binary.BigEndian.Uint32(b)
+
+	case _INT8OID:
+		checkLen(8)
+		return int64(binary.BigEndian.Uint64(b))
+
+	case _FLOAT4OID:
+		checkLen(4)
+		return math.Float32frombits(binary.BigEndian.Uint32(b))
+
+	case _FLOAT8OID:
+		checkLen(8)
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+
+	case _BPCHAROID, _CHAROID, _NAMEOID, _TEXTOID, _VARCHAROID:
+		return string(b)
+
+	case _BYTEAOID:
+		return append([]byte{}, b...)
+
+	case _DATEOID:
+		return decodeBinaryDate(b)
+
+	case _TIMESTAMPOID, _TIMESTAMPTZOID:
+		return decodeBinaryTimestamp(b, conn.integerDatetimes())
+
+	case _NUMERICOID:
+		return decodeBinaryNumeric(b)
+
+	case _UUIDOID:
+		checkLen(16)
+		h := hex.EncodeToString(b)
+		return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+	}
+
+	panic(fmt.Sprintf("binary COPY does not support type OID: %d", typeOID))
+}
+
+// decodeBinaryNumeric decodes a binary numeric value, as written by
+// encodeBinaryNumeric.
+func decodeBinaryNumeric(b []byte) *big.Rat {
+	if len(b) < 8 {
+		panic(fmt.Sprintf("invalid binary numeric value length: %d", len(b)))
+	}
+
+	ndigits := int(int16(binary.BigEndian.Uint16(b)))
+	weight := int(int16(binary.BigEndian.Uint16(b[2:])))
+	sign := binary.BigEndian.Uint16(b[4:])
+
+	if sign == 0xC000 {
+		panic("NaN numeric values are not supported")
+	}
+	if ndigits < 0 || len(b) != 8+2*ndigits {
+		panic(fmt.Sprintf("invalid binary numeric value length: %d", len(b)))
+	}
+
+	// The value is the base 10000 digits times 10000^(weight-ndigits+1).
+	num := new(big.Int)
+	base := big.NewInt(10000)
+	for i := 0; i < ndigits; i++ {
+		num.Mul(num, base)
+		num.Add(num, big.NewInt(int64(binary.BigEndian.Uint16(b[8+2*i:]))))
+	}
+	if sign == 0x4000 {
+		num.Neg(num)
+	}
+
+	value := new(big.Rat).SetInt(num)
+	if exp := weight - ndigits + 1; exp > 0 {
+		value.Mul(value, new(big.Rat).SetInt(new(big.Int).Exp(base, big.NewInt(int64(exp)), nil)))
+	} else if exp < 0 {
+		value.Quo(value, new(big.Rat).SetInt(new(big.Int).Exp(base, big.NewInt(int64(-exp)), nil)))
+	}
+
+	return value
+}
+
+// decodeBinaryCopyHeader returns the length of the binary COPY header at the
+// start of b, or 0, if b does not contain all of it yet.
+func decodeBinaryCopyHeader(b []byte) int {
+	const fixedLen = len(copyBinarySignature) + 8
+
+	if len(b) < len(copyBinarySignature) {
+		return 0
+	}
+	if string(b[:len(copyBinarySignature)]) != copyBinarySignature {
+		panic("invalid binary COPY signature")
+	}
+	if len(b) < fixedLen {
+		return 0
+	}
+
+	flags := binary.BigEndian.Uint32(b[len(copyBinarySignature):])
+	if flags&(1<<16) != 0 {
+		panic("binary COPY with OIDs is not supported")
+	}
+
+	n := fixedLen + int(binary.BigEndian.Uint32(b[fixedLen-4:]))
+	if len(b) < n {
+		return 0
+	}
+
+	return n
+}
+
+// decodeBinaryTuple decodes the binary COPY tuple at the start of b and
+// returns its values and length, or a length of 0, if b does not contain all
+// of it yet. For the file trailer, row is nil.
+func (conn *Conn) decodeBinaryTuple(b []byte, typeOIDs []int32) (row []interface{}, n int) {
+	if len(b) < 2 {
+		return nil, 0
+	}
+
+	fieldCount := int(int16(binary.BigEndian.Uint16(b)))
+	if fieldCount == -1 {
+		return nil, 2
+	}
+	if fieldCount != len(typeOIDs) {
+		panic(fmt.Sprintf("wrong field count, expected: %d, have: %d", len(typeOIDs), fieldCount))
+	}
+
+	pos := 2
+	row = make([]interface{}, fieldCount)
+	for i := range row {
+		if len(b) < pos+4 {
+			return nil, 0
+		}
+		fieldLen := int(int32(binary.BigEndian.Uint32(b[pos:])))
+		pos += 4
+
+		if fieldLen == -1 {
+			continue
+		}
+		if len(b) < pos+fieldLen {
+			return nil, 0
+		}
+		row[i] = conn.decodeBinaryValue(typeOIDs[i], b[pos:pos+fieldLen])
+		pos += fieldLen
+	}
+
+	return row, pos
+}
+
+func (conn *Conn) writeCopyData(data []byte) {
+	conn.writeFrontendMessageCode(_CopyData_FE)
+	conn.writeInt32(int32(4 + len(data)))
+	conn.write(data)
+}
+
+// failCopy aborts the COPY in progress with a CopyFail and panics with err,
+// once the server is ready for the next query.
+func (conn *Conn) failCopy(err error) {
+	message := err.Error()
+	conn.writeFrontendMessageCode(_CopyFail)
+	conn.writeInt32(int32(5 + len(message)))
+	conn.writeString0(message)
+	conn.flush()
+
+	// Eat the ErrorResponse caused by CopyFail and the ReadyForQuery.
+	func() {
+		defer func() {
+			recover()
+		}()
+
+		conn.readBackendMessages(nil)
+	}()
+
+	panic(err)
+}
+
+// copyBinaryColumns returns the column list for a binary COPY of the columns
+// cols of table and the OIDs of their types.
+func (conn *Conn) copyBinaryColumns(table string, cols []string) (colList string, typeOIDs []int32) {
+	colList = "*"
+	if len(cols) > 0 {
+		colList = strings.Join(cols, ", ")
+	}
+
+	// Binary values must match the column types exactly, so look them up.
+	rs := conn.query(fmt.Sprintf("SELECT %s FROM %s LIMIT 0;", colList, table))
+	rs.close()
+
+	typeOIDs = make([]int32, len(rs.fields))
+	for i, f := range rs.fields {
+		typeOIDs[i] = f.typeOID
+	}
+
+	return
+}
+
+// readCopyOutData reads the next message sent by the server during a COPY TO
+// STDOUT. It returns the payload of a CopyData message or, if the server has
+// sent a CopyDone, done as true.
+func (conn *Conn) readCopyOutData() (data []byte, done bool) {
+	for {
+		msgCode := conn.readMessageCode()
+
+		conn.checkMessageLength()
+
+		if conn.LogLevel >= LogDebug {
+			conn.logf(LogDebug, "received '%s' backend message", msgCode)
+		}
+
+		switch msgCode {
+		case _CopyData_BE:
+			msgLen := conn.readInt32()
+
+			data = make([]byte, msgLen-4)
+			conn.read(data)
+			return
+
+		case _CopyDone_BE:
+			conn.readInt32()
+
+			done = true
+			return
+
+		case _ErrorResponse:
+			conn.readErrorOrNoticeResponse(true)
+
+		case _NoticeResponse:
+			conn.readErrorOrNoticeResponse(false)
+
+		case _ParameterStatus:
+			conn.readParameterStatus()
+
+		default:
+			conn.markDead()
+			panic(fmt.Errorf("unexpected '%s' backend message during COPY, connection closed", msgCode))
+		}
+	}
+}
+
+func (conn *Conn) copyFromBinary(table string, cols []string, rows <-chan []interface{}) int64 {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.copyFromBinary"))
+	}
+
+	colList, typeOIDs := conn.copyBinaryColumns(table, cols)
+
+	command := fmt.Sprintf("COPY %s FROM STDIN WITH BINARY;", table)
+	if len(cols) > 0 {
+		command = fmt.Sprintf("COPY %s (%s) FROM STDIN WITH BINARY;", table, colList)
+	}
+
+	conn.writeQuery(command)
+	conn.readBackendMessages(nil)
+	if stateCode := conn.state.code(); stateCode != StatusCopy {
+		panic("wrong state, expected: StatusCopy, have: " + stateCode.String())
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString(copyBinarySignature)
+	// Flags and header extension length
+	binary.Write(buf, binary.BigEndian, int32(0))
+	binary.Write(buf, binary.BigEndian, int32(0))
+
+	// FIXME: magic number; same as for text format.
+	const CopyBufferSize = 32 << 10
+
+	err := func() (err error) {
+		defer func() {
+			if x := recover(); x != nil {
+				if e, ok := x.(error); ok {
+					err = e
+				} else {
+					err = errors.New(fmt.Sprint(x))
+				}
+			}
+		}()
+
+		var field bytes.Buffer
+		for row := range rows {
+			if len(row) != len(typeOIDs) {
+				panic(fmt.Sprintf("wrong value count, expected: %d, have: %d", len(typeOIDs), len(row)))
+			}
+
+			binary.Write(buf, binary.BigEndian, int16(len(row)))
+
+			for i, v := range row {
+				if v == nil || isNilPtr(v) {
+					binary.Write(buf, binary.BigEndian, int32(-1))
+					continue
+				}
+
+				field.Reset()
+				encodeBinaryValue(&field, typeOIDs[i], v)
+
+				binary.Write(buf, binary.BigEndian, int32(field.Len()))
+				buf.Write(field.Bytes())
+			}
+
+			if buf.Len() >= CopyBufferSize {
+				conn.writeCopyData(buf.Bytes())
+				buf.Reset()
+			}
+		}
+
+		return
+	}()
+
+	if err != nil {
+		conn.failCopy(err)
+	}
+
+	// File trailer
+	binary.Write(buf, binary.BigEndian, int16(-1))
+	conn.writeCopyData(buf.Bytes())
+
+	conn.writeFrontendMessageCode(_CopyDone_FE)
+	conn.writeInt32(4)
+	conn.flush()
+
+	rs := newResultSet(conn)
+	conn.readBackendMessages(rs)
+	rs.close()
+
+	return rs.rowsAffected
+}
+
+// CopyFromBinary copies the rows received from rows into table in the binary
+// COPY format and returns the number of rows affected.
+//
+// cols lists the columns to copy into, all columns are used, if it is empty.
+// table and cols are inserted into the COPY command as they are, so quote
+// them as required. Each row must contain a value for each column. Rows are
+// read until the channel is closed.
+//
+// The column types are determined before copying and values are encoded
+// accordingly. Supported are boolean, smallint, integer, bigint, oid, real,
+// double precision, numeric, char, name, text, varchar, bytea, date,
+// timestamp, timestamp with time zone and uuid columns. Date and timestamp
+// values can be time.Time or int64 seconds since the Unix epoch, uuid values
+// are expected as string. nil values are copied as NULL.
+//
+// If a value can't be encoded, the COPY is aborted, so no rows are copied, and
+// the error is returned. The remaining rows are not read from the channel in
+// this case.
+func (conn *Conn) CopyFromBinary(table string, cols []string, rows <-chan []interface{}) (rowsAffected int64, err error) {
+	err = conn.withRecover("*Conn.CopyFromBinary", func() {
+		rowsAffected = conn.copyFromBinary(table, cols, rows)
+	})
+
+	return
+}
+
+func (conn *Conn) copyToBinary(table string, cols []string, rows chan<- []interface{}) int64 {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.copyToBinary"))
+	}
+
+	colList, typeOIDs := conn.copyBinaryColumns(table, cols)
+
+	command := fmt.Sprintf("COPY %s TO STDOUT WITH BINARY;", table)
+	if len(cols) > 0 {
+		command = fmt.Sprintf("COPY %s (%s) TO STDOUT WITH BINARY;", table, colList)
+	}
+
+	conn.writeQuery(command)
+	conn.readBackendMessages(nil)
+	if stateCode := conn.state.code(); stateCode != StatusCopy {
+		panic("wrong state, expected: StatusCopy, have: " + stateCode.String())
+	}
+
+	var pending []byte
+	var headerRead, trailerRead bool
+	var err error
+
+	for {
+		data, done := conn.readCopyOutData()
+		if done {
+			break
+		}
+
+		// After an error or the trailer, just discard the rest, so the
+		// connection stays usable.
+		if err != nil || trailerRead {
+			continue
+		}
+
+		pending = append(pending, data...)
+
+		err = func() (err error) {
+			defer func() {
+				if x := recover(); x != nil {
+					if e, ok := x.(error); ok {
+						err = e
+					} else {
+						err = errors.New(fmt.Sprint(x))
+					}
+				}
+			}()
+
+			if !headerRead {
+				n := decodeBinaryCopyHeader(pending)
+				if n == 0 {
+					return
+				}
+				pending = pending[n:]
+				headerRead = true
+			}
+
+			for {
+				row, n := conn.decodeBinaryTuple(pending, typeOIDs)
+				if n == 0 {
+					return
+				}
+				pending = pending[n:]
+
+				if row == nil {
+					trailerRead = true
+					return
+				}
+
+				rows <- row
+			}
+		}()
+	}
+
+	rs := newResultSet(conn)
+	conn.readBackendMessages(rs)
+	rs.close()
+
+	if err != nil {
+		panic(err)
+	}
+	if !trailerRead {
+		panic(errors.New("binary COPY data ended without trailer"))
+	}
+
+	return rs.rowsAffected
+}
+
+// CopyToBinary copies the rows of table in the binary COPY format, sends them
+// to rows and returns the number of rows copied. rows is closed when the COPY
+// has completed, whether successfully or not.
+//
+// cols lists the columns to copy, all columns are used, if it is empty. table
+// and cols are inserted into the COPY command as they are, so quote them as
+// required.
+//
+// The same column types as for CopyFromBinary are supported. Values are
+// decoded as bool, int16, int (integer), uint32 (oid), int64, float32,
+// float64, string, []byte (bytea), time.Time (date and timestamps), *big.Rat
+// (numeric) and string (uuid), so rows can be passed to CopyFromBinary again.
+// NULL values are nil.
+//
+// If a value can't be decoded, the remaining data is discarded and the error
+// is returned once the COPY has completed.
+func (conn *Conn) CopyToBinary(table string, cols []string, rows chan<- []interface{}) (rowsAffected int64, err error) {
+	defer close(rows)
+
+	err = conn.withRecover("*Conn.CopyToBinary", func() {
+		rowsAffected = conn.copyToBinary(table, cols, rows)
+	})
+
+	return
+}
@@ -0,0 +1,145 @@
+// Copyright 2013 The go-pgsql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgsql
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// copyTextEscaper escapes the characters that have a special meaning in
+// values in the text COPY format.
+var copyTextEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"\t", "\\t",
+	"\n", "\\n",
+	"\r", "\\r",
+)
+
+// appendCopyTextValue appends the text COPY representation of v to buf.
+func appendCopyTextValue(buf *bytes.Buffer, v interface{}) {
+	if v == nil || isNilPtr(v) {
+		buf.WriteString("\\N")
+		return
+	}
+
+	var s string
+	switch val := v.(type) {
+	case time.Time:
+		// The column type is unknown, but this is accepted for date and
+		// timestamp columns alike.
+		s = val.Format("2006-01-02 15:04:05.999999999Z07:00")
+
+	case []byte:
+		s = `\x` + fmt.Sprintf("%x", val)
+
+	default:
+		var isNull bool
+		if s, isNull = formatParamValue(Custom, v); isNull {
+			buf.WriteString("\\N")
+			return
+		}
+	}
+
+	copyTextEscaper.WriteString(buf, s)
+}
+
+func (conn *Conn) copyFromRows(table string, cols []string, rows <-chan []interface{}) int64 {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.copyFromRows"))
+	}
+
+	command := fmt.Sprintf("COPY %s FROM STDIN;", table)
+	if len(cols) > 0 {
+		command = fmt.Sprintf("COPY %s (%s) FROM STDIN;", table, strings.Join(cols, ", "))
+	}
+
+	conn.writeQuery(command)
+	conn.readBackendMessages(nil)
+	if stateCode := conn.state.code(); stateCode != StatusCopy {
+		panic("wrong state, expected: StatusCopy, have: " + stateCode.String())
+	}
+
+	// FIXME: magic number; same as for the other COPY variants.
+	const CopyBufferSize = 32 << 10
+
+	buf := bytes.NewBuffer(nil)
+
+	err := func() (err error) {
+		defer func() {
+			if x := recover(); x != nil {
+				if e, ok := x.(error); ok {
+					err = e
+				} else {
+					err = errors.New(fmt.Sprint(x))
+				}
+			}
+		}()
+
+		for row := range rows {
+			if len(cols) > 0 && len(row) != len(cols) {
+				panic(fmt.Sprintf("wrong value count, expected: %d, have: %d", len(cols), len(row)))
+			}
+
+			for i, v := range row {
+				if i > 0 {
+					buf.WriteByte('\t')
+				}
+				appendCopyTextValue(buf, v)
+			}
+			buf.WriteByte('\n')
+
+			if buf.Len() >= CopyBufferSize {
+				conn.writeCopyData(buf.Bytes())
+				buf.Reset()
+			}
+		}
+
+		return
+	}()
+
+	if err != nil {
+		conn.failCopy(err)
+	}
+
+	if buf.Len() > 0 {
+		conn.writeCopyData(buf.Bytes())
+	}
+
+	conn.writeFrontendMessageCode(_CopyDone_FE)
+	conn.writeInt32(4)
+	conn.flush()
+
+	rs := newResultSet(conn)
+	conn.readBackendMessages(rs)
+	rs.close()
+
+	return rs.rowsAffected
+}
+
+// CopyFromRows copies the rows received from rows into table in the text
+// COPY format and returns the number of rows affected.
+//
+// cols lists the columns to copy into, all columns are used, if it is empty.
+// table and cols are inserted into the COPY command as they are, so quote
+// them as required. Rows are read until the channel is closed.
+//
+// Values are formatted like parameter values and escaped as required by the
+// COPY format, so they may contain tabs, newlines and backslashes. nil values
+// are copied as NULL, []byte values are copied as bytea in hex format.
+//
+// If a value can't be formatted, the COPY is aborted, so no rows are copied,
+// and the error is returned. The remaining rows are not read from the channel
+// in this case.
+func (conn *Conn) CopyFromRows(table string, cols []string, rows <-chan []interface{}) (rowsAffected int64, err error) {
+	err = conn.withRecover("*Conn.CopyFromRows", func() {
+		rowsAffected = conn.copyFromRows(table, cols, rows)
+	})
+
+	return
+}
@@ -194,7 +194,10 @@ func paramsFromValues(params []*Parameter, vals []driver.Value) []*Parameter {
 			case bool:
 				typ = Boolean
 
-			case []byte, string:
+			case []byte:
+				typ = Bytea
+
+			case string:
 				typ = Varchar
 
 			case float64:
@@ -6,6 +6,8 @@ package pgsql
 
 import (
 	"fmt"
+	"strconv"
+	"unicode/utf8"
 )
 
 // Error contains detailed error information received from a PostgreSQL backend.
@@ -60,6 +62,34 @@ func (e *Error) Position() string {
 	return e.position
 }
 
+// OriginalPosition returns the position of the error in the original command
+// of stmt, as given to *Conn.Prepare, or 0, if the error carries no position.
+//
+// Like Position, which refers to the actual command sent to the server, the
+// result is a 1-based index in characters. If the position lies within the
+// $n a parameter name has been replaced with, the position of the name is
+// returned.
+func (e *Error) OriginalPosition(stmt *Statement) int {
+	pos, err := strconv.Atoi(e.position)
+	if err != nil || pos < 1 {
+		return 0
+	}
+
+	// Convert the character position to a byte offset and back.
+	offset := 0
+	for i := 1; i < pos && offset < len(stmt.actualCommand); i++ {
+		_, size := utf8.DecodeRuneInString(stmt.actualCommand[offset:])
+		offset += size
+	}
+
+	offset = stmt.originalOffset(offset)
+	if offset > len(stmt.command) {
+		offset = len(stmt.command)
+	}
+
+	return utf8.RuneCountInString(stmt.command[:offset]) + 1
+}
+
 func (e *Error) InternalPosition() string {
 	return e.internalPosition
 }
@@ -84,6 +114,26 @@ func (e *Error) Routine() string {
 	return e.routine
 }
 
+func (e *Error) isFatal() bool {
+	return e.severity == "FATAL" || e.severity == "PANIC"
+}
+
+// IsAdminShutdown returns if the error reports that the server terminated
+// the session, e.g. because an administrator called pg_terminate_backend or
+// the server is shutting down.
+//
+// The connection that received such an error is closed.
+func (e *Error) IsAdminShutdown() bool {
+	switch e.code {
+	case "57P01", // admin_shutdown
+		"57P02", // crash_shutdown
+		"57P03": // cannot_connect_now
+		return true
+	}
+
+	return false
+}
+
 func (e *Error) Error() string {
 	return fmt.Sprintf(
 		`Severity: %s
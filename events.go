@@ -0,0 +1,80 @@
+// Copyright 2013 The go-pgsql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgsql
+
+import (
+	"sync/atomic"
+)
+
+// eventBufferSize is the capacity of the channel returned by *Conn.Events.
+const eventBufferSize = 64
+
+// Notice is a notice message sent by the server, e.g. a warning or a message
+// raised by RAISE NOTICE in a PL/pgSQL function. It provides the same details
+// as an Error.
+type Notice struct {
+	Error
+}
+
+// Notification is a notification sent by the server for a channel the
+// session is listening on, as a result of a NOTIFY command.
+type Notification struct {
+	// PID is the process ID of the notifying backend.
+	PID int32
+
+	// Channel is the name of the channel the notification was sent on.
+	Channel string
+
+	// Payload is the payload string, which is empty if none was specified.
+	Payload string
+}
+
+// Events returns a channel which delivers a *Notice or *Notification value
+// for each notice or notification received from the server.
+//
+// Events are delivered as they are read from the connection, which happens
+// while commands are processed, so to receive notifications while idle,
+// execute a command, e.g. an empty one, from time to time.
+//
+// The channel is buffered. If it is full, the oldest event is dropped to make
+// room for a new one, so that a slow receiver never blocks the connection.
+// Use DroppedEvents to find out how many events have been dropped.
+func (conn *Conn) Events() <-chan interface{} {
+	if conn.events == nil {
+		conn.events = make(chan interface{}, eventBufferSize)
+	}
+
+	return conn.events
+}
+
+// DroppedEvents returns the number of events dropped, because the channel
+// returned by Events was full.
+func (conn *Conn) DroppedEvents() uint64 {
+	return atomic.LoadUint64(&conn.droppedEvents)
+}
+
+func (conn *Conn) dispatchEvent(event interface{}) {
+	if conn.events == nil {
+		return
+	}
+
+	for {
+		select {
+		case conn.events <- event:
+			return
+
+		default:
+		}
+
+		// The channel is full, so drop the oldest event, unless the
+		// receiver just took it.
+		select {
+		case <-conn.events:
+			atomic.AddUint64(&conn.droppedEvents, 1)
+
+		default:
+		}
+	}
+}
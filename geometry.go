@@ -0,0 +1,316 @@
+// Copyright 2013 The go-pgsql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgsql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Point represents a value of the PostgreSQL type point.
+type Point struct {
+	X, Y float64
+}
+
+// String returns p in the text format of PostgreSQL, e.g. (1.5,2).
+func (p Point) String() string {
+	return "(" + formatGeometryFloat(p.X) + "," + formatGeometryFloat(p.Y) + ")"
+}
+
+// LineSegment represents a value of the PostgreSQL type lseg.
+type LineSegment struct {
+	Start, End Point
+}
+
+// String returns l in the text format of PostgreSQL, e.g. [(1,2),(3,4)].
+func (l LineSegment) String() string {
+	return "[" + l.Start.String() + "," + l.End.String() + "]"
+}
+
+// Path represents a value of the PostgreSQL type path.
+type Path struct {
+	Points []Point
+
+	// Closed is true for closed paths, where the last point is connected
+	// to the first one.
+	Closed bool
+}
+
+// String returns p in the text format of PostgreSQL, e.g. [(1,2),(3,4)] for
+// an open path or ((1,2),(3,4)) for a closed one.
+func (p Path) String() string {
+	if p.Closed {
+		return "(" + formatPoints(p.Points) + ")"
+	}
+
+	return "[" + formatPoints(p.Points) + "]"
+}
+
+// Polygon represents a value of the PostgreSQL type polygon, given by its
+// vertices.
+type Polygon []Point
+
+// String returns p in the text format of PostgreSQL, e.g. ((0,0),(1,0),(0,1)).
+func (p Polygon) String() string {
+	return "(" + formatPoints(p) + ")"
+}
+
+// Circle represents a value of the PostgreSQL type circle.
+type Circle struct {
+	Center Point
+	Radius float64
+}
+
+// String returns c in the text format of PostgreSQL, e.g. <(1,2),3>.
+func (c Circle) String() string {
+	return "<" + c.Center.String() + "," + formatGeometryFloat(c.Radius) + ">"
+}
+
+func formatGeometryFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func formatPoints(points []Point) string {
+	s := make([]string, len(points))
+	for i, p := range points {
+		s[i] = p.String()
+	}
+
+	return strings.Join(s, ",")
+}
+
+// parseGeometryFloats returns the numbers in the text representation of a
+// geometric value, ignoring the brackets of the various types.
+func parseGeometryFloats(s string) (floats []float64, err error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return strings.ContainsRune("()[]<>{}, ", r)
+	})
+
+	for _, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid geometric value: '%s'", s)
+		}
+
+		floats = append(floats, v)
+	}
+
+	return
+}
+
+// parsePoints parses a list of points, e.g. ((1,2),(3,4)), and checks the
+// number of points, if count is greater than zero.
+func parsePoints(s string, count int) ([]Point, error) {
+	floats, err := parseGeometryFloats(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(floats)%2 != 0 || count > 0 && len(floats) != 2*count {
+		return nil, fmt.Errorf("invalid geometric value: '%s'", s)
+	}
+
+	points := make([]Point, len(floats)/2)
+	for i := range points {
+		points[i] = Point{floats[2*i], floats[2*i+1]}
+	}
+
+	return points, nil
+}
+
+func parsePoint(s string) (Point, error) {
+	points, err := parsePoints(s, 1)
+	if err != nil {
+		return Point{}, err
+	}
+
+	return points[0], nil
+}
+
+func parseLineSegment(s string) (LineSegment, error) {
+	points, err := parsePoints(s, 2)
+	if err != nil {
+		return LineSegment{}, err
+	}
+
+	return LineSegment{points[0], points[1]}, nil
+}
+
+// parsePath parses an open path, e.g. [(1,2),(3,4)], or a closed one, e.g.
+// ((1,2),(3,4)).
+func parsePath(s string) (Path, error) {
+	points, err := parsePoints(s, 0)
+	if err != nil {
+		return Path{}, err
+	}
+
+	return Path{Points: points, Closed: !strings.HasPrefix(strings.TrimSpace(s), "[")}, nil
+}
+
+func parsePolygon(s string) (Polygon, error) {
+	points, err := parsePoints(s, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return Polygon(points), nil
+}
+
+func parseCircle(s string) (Circle, error) {
+	floats, err := parseGeometryFloats(s)
+	if err != nil {
+		return Circle{}, err
+	}
+	if len(floats) != 3 {
+		return Circle{}, fmt.Errorf("invalid circle: '%s'", s)
+	}
+
+	return Circle{Point{floats[0], floats[1]}, floats[2]}, nil
+}
+
+// geometryText returns the text of the field with the specified ordinal,
+// which must be of the specified geometric type.
+func (rs *ResultSet) geometryText(ord int, typeOID int32, typeName string) (s string, isNull bool) {
+	isNull = rs.isNull(ord)
+	if isNull {
+		return
+	}
+
+	f := rs.fields[ord]
+
+	if f.typeOID != typeOID {
+		panic(fmt.Sprintf("field '%s' is not of type %s, OID: %d", f.name, typeName, f.typeOID))
+	}
+	if f.format != textFormat {
+		panicNotImplemented()
+	}
+
+	return string(rs.values[ord]), false
+}
+
+func (rs *ResultSet) point(ord int) (value Point, isNull bool) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.point"))
+	}
+
+	s, isNull := rs.geometryText(ord, _POINTOID, "point")
+	if isNull {
+		return
+	}
+
+	value, err := parsePoint(s)
+	panicIfErr(err)
+
+	return
+}
+
+// Point returns the value of the point field with the specified ordinal.
+func (rs *ResultSet) Point(ord int) (value Point, isNull bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.Point", func() {
+		value, isNull = rs.point(ord)
+	})
+
+	return
+}
+
+func (rs *ResultSet) lineSegment(ord int) (value LineSegment, isNull bool) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.lineSegment"))
+	}
+
+	s, isNull := rs.geometryText(ord, _LSEGOID, "lseg")
+	if isNull {
+		return
+	}
+
+	value, err := parseLineSegment(s)
+	panicIfErr(err)
+
+	return
+}
+
+// LineSegment returns the value of the lseg field with the specified ordinal.
+func (rs *ResultSet) LineSegment(ord int) (value LineSegment, isNull bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.LineSegment", func() {
+		value, isNull = rs.lineSegment(ord)
+	})
+
+	return
+}
+
+func (rs *ResultSet) path(ord int) (value Path, isNull bool) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.path"))
+	}
+
+	s, isNull := rs.geometryText(ord, _PATHOID, "path")
+	if isNull {
+		return
+	}
+
+	value, err := parsePath(s)
+	panicIfErr(err)
+
+	return
+}
+
+// Path returns the value of the path field with the specified ordinal.
+func (rs *ResultSet) Path(ord int) (value Path, isNull bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.Path", func() {
+		value, isNull = rs.path(ord)
+	})
+
+	return
+}
+
+func (rs *ResultSet) polygon(ord int) (value Polygon, isNull bool) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.polygon"))
+	}
+
+	s, isNull := rs.geometryText(ord, _POLYGONOID, "polygon")
+	if isNull {
+		return
+	}
+
+	value, err := parsePolygon(s)
+	panicIfErr(err)
+
+	return
+}
+
+// Polygon returns the value of the polygon field with the specified ordinal.
+func (rs *ResultSet) Polygon(ord int) (value Polygon, isNull bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.Polygon", func() {
+		value, isNull = rs.polygon(ord)
+	})
+
+	return
+}
+
+func (rs *ResultSet) circle(ord int) (value Circle, isNull bool) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.circle"))
+	}
+
+	s, isNull := rs.geometryText(ord, _CIRCLEOID, "circle")
+	if isNull {
+		return
+	}
+
+	value, err := parseCircle(s)
+	panicIfErr(err)
+
+	return
+}
+
+// Circle returns the value of the circle field with the specified ordinal.
+func (rs *ResultSet) Circle(ord int) (value Circle, isNull bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.Circle", func() {
+		value, isNull = rs.circle(ord)
+	})
+
+	return
+}
@@ -0,0 +1,154 @@
+// Copyright 2013 The go-pgsql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgsql
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"time"
+)
+
+// jsonValue returns the value of the field with the specified ordinal in a
+// form encoding/json encodes as the matching JSON type.
+func (rs *ResultSet) jsonValue(ord int) interface{} {
+	if rs.isNull(ord) {
+		return nil
+	}
+
+	f := rs.fields[ord]
+
+	if f.format == textFormat {
+		switch f.typeOID {
+		case _JSONOID, _JSONBOID:
+			// Already JSON, so embed it as it is.
+			return json.RawMessage(rs.values[ord])
+
+		case _NUMERICOID:
+			// Keep all digits. JSON can't express NaN and infinity, so these
+			// are written as strings.
+			switch s := string(rs.values[ord]); s {
+			case "NaN", "Infinity", "-Infinity":
+				return s
+
+			default:
+				return json.Number(s)
+			}
+		}
+	}
+
+	v, _ := rs.any(ord)
+
+	return toJSONValue(v)
+}
+
+func toJSONValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil, bool, string, int, int16, int32, int64, uint32, uint64:
+		return val
+
+	case float32:
+		return toJSONValue(float64(val))
+
+	case float64:
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			return fmt.Sprint(val)
+		}
+		return val
+
+	case *big.Rat:
+		return json.Number(formatRat(val))
+
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+
+	case []byte:
+		// Like the text format of bytea.
+		return `\x` + hex.EncodeToString(val)
+
+	case []interface{}:
+		elems := make([]interface{}, len(val))
+		for i, elem := range val {
+			elems[i] = toJSONValue(elem)
+		}
+		return elems
+
+	case fmt.Stringer:
+		return val.String()
+	}
+
+	return fmt.Sprint(v)
+}
+
+func (rs *ResultSet) writeJSONLines(w io.Writer) (rows int64) {
+	if rs.conn.LogLevel >= LogDebug {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.writeJSONLines"))
+	}
+
+	var buf bytes.Buffer
+
+	var keys [][]byte
+	for _, f := range rs.fields {
+		key, err := json.Marshal(f.name)
+		panicIfErr(err)
+
+		keys = append(keys, key)
+	}
+
+	for rs.fetchNext() {
+		buf.Reset()
+		buf.WriteByte('{')
+
+		for ord, key := range keys {
+			if ord > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+
+			value, err := json.Marshal(rs.jsonValue(ord))
+			panicIfErr(err)
+
+			buf.Write(value)
+		}
+
+		buf.WriteString("}\n")
+
+		_, err := w.Write(buf.Bytes())
+		panicIfErr(err)
+
+		rows++
+	}
+
+	rs.close()
+
+	return
+}
+
+// WriteJSONLines writes the remaining rows of the current result to w as
+// newline-delimited JSON, one object per row, with the field names as keys
+// in field order, then closes the ResultSet. It returns the number of rows
+// written.
+//
+// Each row is written as soon as it has been received, so the result is not
+// held in memory. NULL is written as null, boolean fields as booleans,
+// numeric fields as numbers, json and jsonb fields as they are, arrays as
+// arrays and other fields as strings, e.g. timestamps in RFC 3339 format and
+// bytea values in the hex format of PostgreSQL, like "\\xdeadbeef".
+//
+// If an error occurs, the ResultSet is not closed.
+func (rs *ResultSet) WriteJSONLines(w io.Writer) (rows int64, err error) {
+	err = rs.conn.withRecover("*ResultSet.WriteJSONLines", func() {
+		rows = rs.writeJSONLines(w)
+	})
+
+	rs.setCompletedOnPgsqlError(err)
+
+	return
+}
@@ -0,0 +1,84 @@
+// Copyright 2013 The go-pgsql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgsql
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LSN represents a value of the PostgreSQL type pg_lsn, a position in the
+// write-ahead log. LSNs can be compared and subtracted like integers, the
+// difference of two LSNs is the number of bytes between them.
+type LSN uint64
+
+// String returns lsn in the text format of PostgreSQL, e.g. 16/B374D848.
+func (lsn LSN) String() string {
+	return fmt.Sprintf("%X/%X", uint32(lsn>>32), uint32(lsn))
+}
+
+// ParseLSN parses an LSN in the text format of PostgreSQL, e.g. 16/B374D848.
+func ParseLSN(s string) (LSN, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid LSN: '%s'", s)
+	}
+
+	hi, err := strconv.ParseUint(parts[0], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN: '%s'", s)
+	}
+	lo, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN: '%s'", s)
+	}
+
+	return LSN(hi<<32 | lo), nil
+}
+
+func (rs *ResultSet) lsn(ord int) (value LSN, isNull bool) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.lsn"))
+	}
+
+	isNull = rs.isNull(ord)
+	if isNull {
+		return
+	}
+
+	f := rs.fields[ord]
+	val := rs.values[ord]
+
+	if f.typeOID != _PG_LSNOID {
+		panic(fmt.Sprintf("field '%s' is not of type pg_lsn, OID: %d", f.name, f.typeOID))
+	}
+
+	switch f.format {
+	case textFormat:
+		var err error
+		value, err = ParseLSN(string(val))
+		panicIfErr(err)
+
+	case binaryFormat:
+		if len(val) != 8 {
+			panic(fmt.Sprintf("invalid binary pg_lsn length: %d", len(val)))
+		}
+		value = LSN(binary.BigEndian.Uint64(val))
+	}
+
+	return
+}
+
+// LSN returns the value of the pg_lsn field with the specified ordinal, e.g.
+// of the replay_lsn column of pg_stat_replication.
+func (rs *ResultSet) LSN(ord int) (value LSN, isNull bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.LSN", func() {
+		value, isNull = rs.lsn(ord)
+	})
+
+	return
+}
@@ -18,6 +18,7 @@ const (
 	_BindComplete          backendMessageCode = '2'
 	_CloseComplete         backendMessageCode = '3'
 	_CommandComplete       backendMessageCode = 'C'
+	_CopyBothResponse      backendMessageCode = 'W'
 	_CopyData_BE           backendMessageCode = 'd'
 	_CopyDone_BE           backendMessageCode = 'c'
 	_CopyInResponse        backendMessageCode = 'G'
@@ -26,6 +27,7 @@ const (
 	_EmptyQueryResponse    backendMessageCode = 'I'
 	_ErrorResponse         backendMessageCode = 'E'
 	_FunctionCallResponse  backendMessageCode = 'V'
+	_NegotiateProtocol     backendMessageCode = 'v'
 	_NoData                backendMessageCode = 'n'
 	_NoticeResponse        backendMessageCode = 'N'
 	_NotificationResponse  backendMessageCode = 'A'
@@ -94,6 +96,9 @@ const (
 	_AuthenticationGSS               authenticationType = 7
 	_AuthenticationGSSContinue       authenticationType = 8
 	_AuthenticationSSPI              authenticationType = 9
+	_AuthenticationSASL              authenticationType = 10
+	_AuthenticationSASLContinue      authenticationType = 11
+	_AuthenticationSASLFinal         authenticationType = 12
 )
 
 var authType2String map[authenticationType]string
@@ -118,6 +123,7 @@ func init() {
 	backendMsgCode2String[_BindComplete] = "BindComplete"
 	backendMsgCode2String[_CloseComplete] = "CloseComplete"
 	backendMsgCode2String[_CommandComplete] = "CommandComplete"
+	backendMsgCode2String[_CopyBothResponse] = "CopyBothResponse"
 	backendMsgCode2String[_CopyData_BE] = "CopyData"
 	backendMsgCode2String[_CopyDone_BE] = "CopyDone"
 	backendMsgCode2String[_CopyInResponse] = "CopyInResponse"
@@ -126,6 +132,7 @@ func init() {
 	backendMsgCode2String[_EmptyQueryResponse] = "EmptyQueryResponse"
 	backendMsgCode2String[_ErrorResponse] = "ErrorResponse"
 	backendMsgCode2String[_FunctionCallResponse] = "FunctionCallResponse"
+	backendMsgCode2String[_NegotiateProtocol] = "NegotiateProtocolVersion"
 	backendMsgCode2String[_NoData] = "NoData"
 	backendMsgCode2String[_NoticeResponse] = "NoticeResponse"
 	backendMsgCode2String[_NotificationResponse] = "NotificationResponse"
@@ -168,4 +175,7 @@ func init() {
 	authType2String[_AuthenticationGSS] = "AuthenticationGSS"
 	authType2String[_AuthenticationGSSContinue] = "AuthenticationGSSContinue"
 	authType2String[_AuthenticationSSPI] = "AuthenticationSSPI"
+	authType2String[_AuthenticationSASL] = "AuthenticationSASL"
+	authType2String[_AuthenticationSASLContinue] = "AuthenticationSASLContinue"
+	authType2String[_AuthenticationSASLFinal] = "AuthenticationSASLFinal"
 }
@@ -0,0 +1,134 @@
+// Copyright 2013 The go-pgsql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgsql
+
+import (
+	"fmt"
+	"sync"
+)
+
+// RowResult is a row, or an error, received from ParallelQuery.
+type RowResult struct {
+	// Partition is the index of the connection and parameter set the row
+	// was produced by.
+	Partition int
+
+	// Values contains the field values of the row, as returned by
+	// *ResultSet.Any. Null values are nil.
+	Values []interface{}
+
+	// Err is set, if the query failed on the connection of Partition. Values
+	// is nil in this case.
+	Err error
+}
+
+// ParallelQuery runs command concurrently on each of conns, binding the values
+// of paramSets[i] to the positional parameters $1..$n of the query running on
+// conns[i], as described for *Conn.QueryParams.
+//
+// The rows of all partitions are merged into the returned channel in the order
+// they arrive, which is closed when all queries have completed. If a query
+// fails, a RowResult with Err set is sent, and the queries still running on
+// the other connections are canceled, see *Conn.Cancel. Rows of other
+// partitions, which were already on their way, may still be received after
+// the error.
+//
+// The connections must not be used by anything else until the channel has
+// been closed, and the channel must be drained, otherwise the queries never
+// complete.
+func ParallelQuery(conns []*Conn, command string, paramSets [][]interface{}) (<-chan RowResult, error) {
+	if len(conns) != len(paramSets) {
+		return nil, fmt.Errorf("have %d connections, but %d parameter sets", len(conns), len(paramSets))
+	}
+
+	rows := make(chan RowResult)
+	failed := make(chan bool)
+
+	var failOnce sync.Once
+	fail := func(partition int, err error) {
+		failOnce.Do(func() {
+			// Stop the other queries, even if they are still waiting for
+			// their first row, e.g. for a slow aggregate.
+			for j, conn := range conns {
+				if j != partition {
+					conn.Cancel()
+				}
+			}
+
+			close(failed)
+			rows <- RowResult{Partition: partition, Err: err}
+		})
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(conns))
+
+	for i := range conns {
+		go func(partition int) {
+			defer wg.Done()
+
+			conn := conns[partition]
+
+			rs, err := conn.QueryParams(command, paramSets[partition]...)
+			if err != nil {
+				fail(partition, err)
+				return
+			}
+
+			for {
+				hasRow, err := rs.FetchNext()
+				if err != nil {
+					fail(partition, err)
+					rs.Close()
+					return
+				}
+				if !hasRow {
+					break
+				}
+
+				values := make([]interface{}, rs.FieldCount())
+				for ord := range values {
+					v, isNull, err := rs.Any(ord)
+					if err != nil {
+						fail(partition, err)
+						rs.Close()
+						return
+					}
+					if !isNull {
+						values[ord] = v
+					}
+				}
+
+				select {
+				case <-failed:
+
+				default:
+					select {
+					case rows <- RowResult{Partition: partition, Values: values}:
+						continue
+
+					case <-failed:
+					}
+				}
+
+				// Another partition failed and has canceled this query
+				// already, so just stop sending rows.
+				rs.Close()
+				return
+			}
+
+			if err := rs.Close(); err != nil {
+				fail(partition, err)
+			}
+		}(i)
+	}
+
+	go func() {
+		wg.Wait()
+		close(rows)
+	}()
+
+	return rows, nil
+}
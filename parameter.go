@@ -5,9 +5,12 @@
 package pgsql
 
 import (
+	"database/sql/driver"
+	"encoding"
 	"errors"
 	"fmt"
 	"math/big"
+	"net"
 	"reflect"
 	"time"
 )
@@ -19,6 +22,7 @@ type Parameter struct {
 	typ            Type
 	customTypeName string
 	value          interface{}
+	isSet          bool
 }
 
 // NewParameter returns a new Parameter with the specified name and type.
@@ -34,10 +38,80 @@ func NewParameter(name string, typ Type) *Parameter {
 //
 // This constructor can be used for enum type parameters. In that case the value
 // provided to SetValue is expected to be a string.
+//
+// A customTypeName of date, time, timetz, timestamp or timestamptz also
+// determines how time.Time values are formatted, e.g. date-only for date, or
+// with the zone offset for timestamptz.
 func NewCustomTypeParameter(name, customTypeName string) *Parameter {
 	return &Parameter{name: name, customTypeName: customTypeName}
 }
 
+// newPositionalParameter returns a new Parameter for the positional parameter
+// $ord, leaving the type for the server to infer.
+func newPositionalParameter(ord int, v interface{}) *Parameter {
+	p := &Parameter{name: fmt.Sprintf("$%d", ord), isSet: true}
+
+	switch val := v.(type) {
+	case int8:
+		p.value = int16(val)
+
+	case uint:
+		p.value = int64(val)
+
+	case uint16:
+		p.value = int64(val)
+
+	case uint32:
+		p.value = int64(val)
+
+	default:
+		p.value = v
+	}
+
+	return p
+}
+
+// Clone returns a new Parameter with the name, type and current value of p,
+// which is not associated with any Statement.
+//
+// A Parameter can only be used with a single Statement, so Clone allows to
+// keep a set of parameter definitions as a template for building many
+// statements.
+func (p *Parameter) Clone() *Parameter {
+	return &Parameter{
+		name:           p.name,
+		typ:            p.typ,
+		customTypeName: p.customTypeName,
+		value:          p.value,
+		isSet:          p.isSet,
+	}
+}
+
+// castTypeName returns the name of the type the Parameter is cast to in a
+// command, which is the custom type name, if set, or the default casts maps
+// the name of the Parameter to.
+func (p *Parameter) castTypeName(casts map[string]string) string {
+	if p.customTypeName != "" {
+		return p.customTypeName
+	}
+
+	return casts[p.name]
+}
+
+// customTimeTypes maps the custom type names, which control how time.Time and
+// int64 values of Custom parameters are formatted, to the respective Type.
+var customTimeTypes = map[string]Type{
+	"date":                        Date,
+	"time":                        Time,
+	"time without time zone":      Time,
+	"timetz":                      TimeTZ,
+	"time with time zone":         TimeTZ,
+	"timestamp":                   Timestamp,
+	"timestamp without time zone": Timestamp,
+	"timestamptz":                 TimestampTZ,
+	"timestamp with time zone":    TimestampTZ,
+}
+
 // CustomTypeName returns the custom type name of the Parameter.
 func (p *Parameter) CustomTypeName() string {
 	return p.customTypeName
@@ -58,6 +132,11 @@ func (p *Parameter) Type() Type {
 	return p.typ
 }
 
+// IsSet returns if a value, which may be nil, has been set for the Parameter.
+func (p *Parameter) IsSet() bool {
+	return p.isSet
+}
+
 // Value returns the current value of the Parameter.
 func (p *Parameter) Value() interface{} {
 	return p.value
@@ -76,6 +155,20 @@ func isNilPtr(v interface{}) bool {
 }
 
 // SetValue sets the current value of the Parameter.
+//
+// Parameters of type Custom, Char, Name, Text or Varchar also accept values
+// of types implementing driver.Valuer, encoding.TextMarshaler or fmt.Stringer.
+// When the statement is executed, built-in types like time.Time, *big.Int or *big.Rat
+// are formatted as usual. Values of other types are formatted using the
+// first of these interfaces they implement, in the order listed above. A
+// driver.Valuer returning nil results in NULL.
+//
+// Parameters of type Time or TimeTZ also accept TimeOfDay values. Parameters
+// of type Custom accept slices, e.g. []string for a text[] parameter, which
+// are sent as one-dimensional arrays.
+//
+// A Statement can only be executed once all its parameters have been set,
+// use nil for NULL.
 func (p *Parameter) SetValue(v interface{}) (err error) {
 	if p.stmt != nil && p.stmt.conn.LogLevel >= LogVerbose {
 		defer p.stmt.conn.logExit(p.stmt.conn.logEnter("*Parameter.SetValue"))
@@ -97,6 +190,8 @@ func (p *Parameter) SetValue(v interface{}) (err error) {
 			} else {
 				err = p.stmt.conn.logAndConvertPanic(x)
 			}
+		} else {
+			p.isSet = true
 		}
 	}()
 
@@ -146,12 +241,31 @@ func (p *Parameter) SetValue(v interface{}) (err error) {
 		}
 		p.value = val
 
-	case Char, Text, Varchar:
-		val, ok := v.(string)
-		if !ok {
+	case Bytea:
+		switch val := v.(type) {
+		case []byte:
+			p.value = val
+
+		case driver.Valuer:
+			// Formatted when the statement is executed.
+			p.value = val
+
+		default:
+			p.panicInvalidValue(v)
+		}
+
+	case Char, Name, Text, Varchar:
+		switch val := v.(type) {
+		case string:
+			p.value = val
+
+		case driver.Valuer, encoding.TextMarshaler, fmt.Stringer:
+			// Formatted when the statement is executed.
+			p.value = val
+
+		default:
 			p.panicInvalidValue(v)
 		}
-		p.value = val
 
 	case Custom:
 		p.value = v
@@ -161,6 +275,13 @@ func (p *Parameter) SetValue(v interface{}) (err error) {
 		case int64:
 			p.value = val
 
+		case TimeOfDay:
+			if p.typ != Time && p.typ != TimeTZ {
+				p.panicInvalidValue(v)
+			}
+
+			p.value = val
+
 		case time.Time:
 			if isNilPtr(v) {
 				p.value = nil
@@ -215,9 +336,24 @@ func (p *Parameter) SetValue(v interface{}) (err error) {
 			p.panicInvalidValue(v)
 		}
 
+	case MacAddr, MacAddr8:
+		switch val := v.(type) {
+		case net.HardwareAddr:
+			p.value = val
+
+		case string:
+			// Any input format accepted by the server.
+			p.value = val
+
+		default:
+			p.panicInvalidValue(v)
+		}
+
 	case Numeric:
-		val, ok := v.(*big.Rat)
-		if !ok {
+		switch v.(type) {
+		case *big.Int, *big.Rat:
+
+		default:
 			p.panicInvalidValue(v)
 		}
 
@@ -226,7 +362,25 @@ func (p *Parameter) SetValue(v interface{}) (err error) {
 			return
 		}
 
-		p.value = val
+		p.value = v
+
+	case Oid:
+		switch val := v.(type) {
+		case int:
+			p.value = int64(val)
+
+		case int32:
+			p.value = int64(val)
+
+		case uint:
+			p.value = int64(val)
+
+		case uint32:
+			p.value = int64(val)
+
+		default:
+			p.panicInvalidValue(v)
+		}
 
 	case Real:
 		switch val := v.(type) {
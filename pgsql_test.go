@@ -5,14 +5,26 @@
 package pgsql
 
 import (
+	"bufio"
 	"bytes"
+	"database/sql/driver"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
 	"math"
 	"math/big"
+	"net"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
+	"unicode/utf8"
 )
 
 func withConnLog(t *testing.T, logLevel LogLevel, f func(conn *Conn)) {
@@ -1059,3 +1071,4384 @@ func Test_Issue14_CopyFrom(t *testing.T) {
 		}
 	})
 }
+
+func Test_Conn_QueryParams(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		rs, err := conn.QueryParams("SELECT $1::int + 1, $2::text WHERE $3;", 2, "abc", true)
+		if err != nil {
+			t.Error("failed to query:", err)
+			return
+		}
+		defer rs.Close()
+
+		var three int
+		var abc string
+		fetched, err := rs.ScanNext(&three, &abc)
+		if err != nil {
+			t.Error("failed to scan next:", err)
+			return
+		}
+		if !fetched {
+			t.Error("fetched == false")
+			return
+		}
+		if three != 3 {
+			t.Errorf("have: %d, but want: 3", three)
+		}
+		if abc != "abc" {
+			t.Errorf("have: '%s', but want: 'abc'", abc)
+		}
+	})
+}
+
+func Test_Conn_PrepareUnnamed(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		stmt, err := conn.PrepareUnnamed("SELECT @id + 1;", idParameter(41))
+		if err != nil {
+			t.Error("failed to prepare:", err)
+			return
+		}
+		defer stmt.Close()
+
+		var have int
+		if _, err := stmt.Scan(&have); err != nil {
+			t.Error("failed to scan:", err)
+			return
+		}
+		if have != 42 {
+			t.Errorf("have: %d, but want: 42", have)
+		}
+	})
+}
+
+func Test_Conn_AdminShutdown(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		withConn(t, func(admin *Conn) {
+			command := fmt.Sprintf("SELECT pg_terminate_backend(%d);", conn.backendPID)
+			if _, err := admin.Execute(command); err != nil {
+				t.Error("failed to terminate backend:", err)
+			}
+		})
+
+		_, err := conn.Execute("SELECT 1;")
+		pgerr, ok := err.(*Error)
+		if !ok || !pgerr.IsAdminShutdown() {
+			t.Errorf("expected admin shutdown error, have: %v", err)
+		}
+		if conn.Status() != StatusDisconnected {
+			t.Errorf("status - have: %s, but want: %s", conn.Status(), StatusDisconnected)
+		}
+	})
+}
+
+func Test_Statement_InferredParameterType(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		tm, _ := time.Parse(timestampFormat, "2010-08-14 20:03:38")
+
+		stmt, err := conn.Prepare("SELECT @d::date = DATE '2010-08-14';", NewParameter("@d", Custom))
+		if err != nil {
+			t.Error("failed to prepare:", err)
+			return
+		}
+		defer stmt.Close()
+
+		if len(stmt.paramTypeOIDs) != 1 || stmt.paramTypeOIDs[0] != _DATEOID {
+			t.Errorf("unexpected parameter type OIDs: %v", stmt.paramTypeOIDs)
+			return
+		}
+
+		stmt.Parameter("@d").SetValue(tm)
+
+		var equal bool
+		if _, err := stmt.Scan(&equal); err != nil {
+			t.Error("failed to scan:", err)
+			return
+		}
+		if !equal {
+			t.Error("date parameter not formatted as date")
+		}
+	})
+}
+
+func Test_CharAndName(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		var relkind, relname interface{}
+		_, err := conn.Scan("SELECT relkind, relname FROM pg_class WHERE relname = 'pg_class';", &relkind, &relname)
+		if err != nil {
+			t.Error("failed to scan:", err)
+			return
+		}
+		if relkind != "r" {
+			t.Errorf("relkind - have: '%v', but want: 'r'", relkind)
+		}
+		if relname != "pg_class" {
+			t.Errorf("relname - have: '%v', but want: 'pg_class'", relname)
+		}
+
+		var count int
+		stmt, err := conn.Prepare("SELECT count(*)::int FROM pg_class WHERE relname = @name;", param("@name", Name, "pg_class"))
+		if err != nil {
+			t.Error("failed to prepare:", err)
+			return
+		}
+		defer stmt.Close()
+
+		if _, err := stmt.Scan(&count); err != nil {
+			t.Error("failed to scan:", err)
+			return
+		}
+		if count != 1 {
+			t.Errorf("count - have: %d, but want: 1", count)
+		}
+	})
+}
+
+func Test_Conn_PrepareRaw(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		command := "SELECT $1 + 1;"
+
+		stmt, err := conn.PrepareRaw(command, []*Parameter{idParameter(41)})
+		if err != nil {
+			t.Error("failed to prepare:", err)
+			return
+		}
+		defer stmt.Close()
+
+		if stmt.ActualCommand() != command {
+			t.Errorf("have: '%s', but want: '%s'", stmt.ActualCommand(), command)
+		}
+
+		var have int
+		if _, err := stmt.Scan(&have); err != nil {
+			t.Error("failed to scan:", err)
+			return
+		}
+		if have != 42 {
+			t.Errorf("have: %d, but want: 42", have)
+		}
+	})
+}
+
+func Test_replaceParameterName_Opaque(t *testing.T) {
+	tests := []struct{ command, want string }{
+		{`SELECT "col @id x" FROM t WHERE id = @id;`, `SELECT "col @id x" FROM t WHERE id = $1;`},
+		{`SELECT 1 /* @id */ WHERE id = @id;`, `SELECT 1 /* @id */ WHERE id = $1;`},
+		{`SELECT 'a @id b', "a @id b" WHERE id = @id;`, `SELECT 'a @id b', "a @id b" WHERE id = $1;`},
+	}
+
+	for _, test := range tests {
+		if have := replaceParameterName(test.command, "@id", "$1"); have != test.want {
+			t.Errorf("have: '%s', but want: '%s'", have, test.want)
+		}
+	}
+}
+
+func Test_Pipeline(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		conn.Execute("DROP TABLE _gopgsql_test_pipeline;")
+
+		if _, err := conn.Execute("CREATE TABLE _gopgsql_test_pipeline (id int PRIMARY KEY);"); err != nil {
+			t.Error("failed to create table:", err)
+			return
+		}
+		defer func() {
+			conn.Execute("DROP TABLE _gopgsql_test_pipeline;")
+		}()
+
+		p := conn.Pipeline()
+		p.Execute("INSERT INTO _gopgsql_test_pipeline (id) VALUES (1);")
+		p.Execute("INSERT INTO _gopgsql_test_pipeline (id) VALUES (@id);", idParameter(2))
+		p.Execute("SELECT id FROM _gopgsql_test_pipeline;")
+		p.Execute("UPDATE _gopgsql_test_pipeline SET id = id + 10;")
+
+		rowsAffected, err := p.Flush()
+		if err != nil {
+			t.Error("failed to flush pipeline:", err)
+			return
+		}
+		if have, want := fmt.Sprint(rowsAffected), "[1 1 2 2]"; have != want {
+			t.Errorf("rows affected - have: %s, but want: %s", have, want)
+		}
+
+		p.Execute("INSERT INTO _gopgsql_test_pipeline (id) VALUES (11);")
+		p.Execute("INSERT INTO _gopgsql_test_pipeline (id) VALUES (3);")
+		if _, err = p.Flush(); err == nil {
+			t.Error("error expected")
+			return
+		}
+
+		var count int
+		if _, err := conn.Scan("SELECT count(*)::int FROM _gopgsql_test_pipeline;", &count); err != nil {
+			t.Error("failed to scan after failed pipeline:", err)
+			return
+		}
+		if count != 2 {
+			t.Errorf("count - have: %d, but want: 2", count)
+		}
+	})
+}
+
+func Test_ResultSet_ScanMap(t *testing.T) {
+	withSimpleQueryResultSet(t, "SELECT 1 AS _1, 'two' AS _two, null AS _null;", func(rs *ResultSet) {
+		m := make(map[string]interface{})
+
+		fetched, err := rs.ScanMap(m)
+		if err != nil {
+			t.Error("failed to scan map:", err)
+			return
+		}
+		if !fetched {
+			t.Error("fetched == false")
+			return
+		}
+		if m["_1"] != 1 || m["_two"] != "two" || m["_null"] != nil {
+			t.Errorf("unexpected map: %v", m)
+		}
+		if _, ok := m["_null"]; !ok {
+			t.Error("null field missing from map")
+		}
+
+		if fetched, _ = rs.ScanMap(m); fetched {
+			t.Error("fetched == true after last row")
+		}
+	})
+}
+
+func Test_parseBool(t *testing.T) {
+	for _, s := range []string{"t", "true", "TRUE", "y", "yes", "on", "1"} {
+		if !parseBool(s) {
+			t.Errorf("'%s' - have: false, but want: true", s)
+		}
+	}
+	for _, s := range []string{"f", "false", "FALSE", "n", "no", "off", "0"} {
+		if parseBool(s) {
+			t.Errorf("'%s' - have: true, but want: false", s)
+		}
+	}
+}
+
+func Test_Bool_RoundTrip(t *testing.T) {
+	for _, want := range []bool{true, false} {
+		withStatementResultSet(t, "SELECT @b, @b;", []*Parameter{param("@b", Boolean, want)}, func(rs *ResultSet) {
+			var have bool
+			var haveInterface interface{}
+			if _, err := rs.ScanNext(&have, &haveInterface); err != nil {
+				t.Error("failed to scan next:", err)
+				return
+			}
+			if have != want {
+				t.Errorf("have: %t, but want: %t", have, want)
+			}
+			if haveInterface != want {
+				t.Errorf("interface{} - have: %v, but want: %t", haveInterface, want)
+			}
+		})
+	}
+}
+
+func Test_OidAndRegclass(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		var oid uint32
+		var oidInt int
+		var relname string
+		_, err := conn.Scan("SELECT 'pg_class'::regclass::oid, 4294967295::oid, 'pg_class'::regclass;", &oid, &oidInt, &relname)
+		if err != nil {
+			t.Error("failed to scan:", err)
+			return
+		}
+		if oid == 0 {
+			t.Error("oid == 0")
+		}
+		if oidInt != 4294967295 {
+			t.Errorf("have: %d, but want: 4294967295", oidInt)
+		}
+		if relname != "pg_class" {
+			t.Errorf("have: '%s', but want: 'pg_class'", relname)
+		}
+
+		var count int
+		stmt, err := conn.Prepare("SELECT count(*)::int FROM pg_class WHERE oid = @oid;", param("@oid", Oid, oid))
+		if err != nil {
+			t.Error("failed to prepare:", err)
+			return
+		}
+		defer stmt.Close()
+
+		if _, err := stmt.Scan(&count); err != nil {
+			t.Error("failed to scan:", err)
+			return
+		}
+		if count != 1 {
+			t.Errorf("count - have: %d, but want: 1", count)
+		}
+	})
+}
+
+func Test_Conn_SetReadTimeout(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		if err := conn.SetReadTimeout(100 * time.Millisecond); err != nil {
+			t.Error("failed to set read timeout:", err)
+			return
+		}
+
+		_, err := conn.Execute("SELECT pg_sleep(1);")
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			t.Errorf("expected timeout error, have: %v", err)
+		}
+		if conn.Status() != StatusDisconnected {
+			t.Errorf("status - have: %s, but want: %s", conn.Status(), StatusDisconnected)
+		}
+	})
+}
+
+func Test_Conn_Reconnect_PreparesStatementsAgain(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		stmt, err := conn.Prepare("SELECT @id + 1;", idParameter(41))
+		if err != nil {
+			t.Error("failed to prepare:", err)
+			return
+		}
+		defer stmt.Close()
+
+		closedStmt, err := conn.Prepare("SELECT 1;")
+		if err != nil {
+			t.Error("failed to prepare:", err)
+			return
+		}
+		closedStmt.Close()
+
+		if err := conn.Reconnect(); err != nil {
+			t.Error("failed to reconnect:", err)
+			return
+		}
+
+		var have int
+		if _, err := stmt.Scan(&have); err != nil {
+			t.Error("failed to scan after reconnect:", err)
+			return
+		}
+		if have != 42 {
+			t.Errorf("have: %d, but want: 42", have)
+		}
+		if conn.statements[closedStmt] {
+			t.Error("closed statement prepared again")
+		}
+	})
+}
+
+func Test_ResultSet_RawText(t *testing.T) {
+	withSimpleQueryResultSet(t, "SELECT 1.50::numeric, true, DATE '2010-08-14';", func(rs *ResultSet) {
+		rs.SetRawText(true)
+
+		var num, b, d interface{}
+		if _, err := rs.ScanNext(&num, &b, &d); err != nil {
+			t.Error("failed to scan next:", err)
+			return
+		}
+		if num != "1.50" || b != "t" || d != "2010-08-14" {
+			t.Errorf("unexpected values: %v, %v, %v", num, b, d)
+		}
+
+		if text, _, _ := rs.Text(0); text != "1.50" {
+			t.Errorf("Text - have: '%s', but want: '1.50'", text)
+		}
+	})
+}
+
+func Test_adjustCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		params  []*Parameter
+		want    string
+	}{
+		{
+			"SELECT @a,@a,@a;",
+			[]*Parameter{NewParameter("@a", Integer)},
+			"SELECT $1,$1,$1;",
+		},
+		{
+			"SELECT * FROM t WHERE b = @b AND a = @a AND (c = @b OR d = :a);",
+			[]*Parameter{NewParameter("@a", Integer), NewParameter("@b", Integer)},
+			"SELECT * FROM t WHERE b = $2 AND a = $1 AND (c = $2 OR d = $1);",
+		},
+		{
+			"SELECT @id, @id2, @i;",
+			[]*Parameter{NewParameter("@id2", Integer), NewParameter("@i", Integer), NewParameter("@id", Integer)},
+			"SELECT $3, $1, $2;",
+		},
+		{
+			"SELECT @d, @x;",
+			[]*Parameter{NewParameter("@x", Integer), NewCustomTypeParameter("@d", "date")},
+			"SELECT $2::date, $1;",
+		},
+		{
+			"SELECT * FROM t WHERE data @> @filter AND data->>@key = 'x' AND arr[@i] = @v::int;",
+			[]*Parameter{NewCustomTypeParameter("@filter", "jsonb"), NewParameter("@key", Text), NewParameter("@i", Integer), NewParameter("@v", Custom)},
+			"SELECT * FROM t WHERE data @> $1::jsonb AND data->>$2 = 'x' AND arr[$3] = $4::int;",
+		},
+		{
+			"SELECT x::name, :name;",
+			[]*Parameter{NewParameter(":name", Name)},
+			"SELECT x::name, $1;",
+		},
+	}
+
+	for _, test := range tests {
+		if have := adjustCommand(test.command, test.params); have != test.want {
+			t.Errorf("have: '%s', but want: '%s'", have, test.want)
+		}
+	}
+}
+
+func Test_Statement_ParameterOrder(t *testing.T) {
+	params := []*Parameter{
+		param("@b", Text, "b"),
+		param("@a", Integer, 1),
+	}
+
+	withStatementResultSet(t, "SELECT @a, @b, @a + 1, @b || @b;", params, func(rs *ResultSet) {
+		var a, a1 int
+		var b, bb string
+		if _, err := rs.ScanNext(&a, &b, &a1, &bb); err != nil {
+			t.Error("failed to scan next:", err)
+			return
+		}
+		if a != 1 || b != "b" || a1 != 2 || bb != "bb" {
+			t.Errorf("unexpected values: %d, '%s', %d, '%s'", a, b, a1, bb)
+		}
+	})
+}
+
+func testConnParams() *ConnParams {
+	return &ConnParams{Database: "testdatabase", User: "testuser", Password: "testpassword"}
+}
+
+func Test_ConnectParams_OnConnect(t *testing.T) {
+	params := testConnParams()
+	params.OnConnect = func(conn *Conn) error {
+		_, err := conn.Execute("SET application_name = 'gopgsql_test';")
+		return err
+	}
+
+	conn, err := ConnectParams(params, LogNothing)
+	if err != nil {
+		t.Error("failed to connect:", err)
+		return
+	}
+	defer conn.Close()
+
+	var name string
+	if _, err := conn.Scan("SHOW application_name;", &name); err != nil {
+		t.Error("failed to scan:", err)
+		return
+	}
+	if name != "gopgsql_test" {
+		t.Errorf("have: '%s', but want: 'gopgsql_test'", name)
+	}
+
+	params.OnConnect = func(conn *Conn) error {
+		return errors.New("fail")
+	}
+	if conn, err := ConnectParams(params, LogNothing); err == nil {
+		t.Error("error expected")
+		conn.Close()
+	}
+}
+
+func Test_Void(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		_, err := conn.Execute(`
+			CREATE OR REPLACE FUNCTION _gopgsql_test_void() RETURNS void AS $$
+			BEGIN
+			END;
+			$$ LANGUAGE plpgsql;
+			`)
+		if err != nil {
+			t.Error("create function failed:", err)
+			return
+		}
+		defer func() {
+			conn.Execute("DROP FUNCTION _gopgsql_test_void();")
+		}()
+
+		fetched, err := conn.Scan("SELECT _gopgsql_test_void();")
+		if err != nil {
+			t.Error("failed to scan:", err)
+			return
+		}
+		if !fetched {
+			t.Error("fetched == false")
+		}
+
+		var v interface{} = 1
+		if _, err := conn.Scan("SELECT _gopgsql_test_void();", &v); err != nil {
+			t.Error("failed to scan into interface{}:", err)
+			return
+		}
+		if v != nil {
+			t.Errorf("have: %v, but want: nil", v)
+		}
+	})
+}
+
+func Test_Conn_Clone(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		clone, err := conn.Clone()
+		if err != nil {
+			t.Error("failed to clone:", err)
+			return
+		}
+		defer clone.Close()
+
+		if clone.backendPID == conn.backendPID {
+			t.Error("clone uses the same backend")
+		}
+
+		var one int
+		if _, err := clone.Scan("SELECT 1;", &one); err != nil || one != 1 {
+			t.Error("failed to query clone:", err)
+		}
+	})
+}
+
+func Test_Conn_Clone_Streams(t *testing.T) {
+	var server, client bytes.Buffer
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0, 'Z', 0, 0, 0, 5, 'I'})
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	clone, err := conn.Clone()
+	if err == nil {
+		clone.Close()
+	}
+	if err == nil || !strings.Contains(err.Error(), "cannot clone") {
+		t.Errorf("expected error refusing to clone, have: %v", err)
+	}
+}
+
+func Test_parseArray(t *testing.T) {
+	tests := []struct {
+		s     string
+		delim byte
+		want  []string
+	}{
+		{"{}", ',', []string{}},
+		{"{1,2,3}", ',', []string{"1", "2", "3"}},
+		{"{a,NULL,\"NULL\"}", ',', []string{"a", "<nil>", "NULL"}},
+		{`{"a b","c,d","e\"f","g\\h"}`, ',', []string{"a b", "c,d", `e"f`, `g\h`}},
+		{"[0:1]={1.5,2.25}", ',', []string{"1.5", "2.25"}},
+		{"{(1,1),(0,0);(3,3),(2,2)}", ';', []string{"(1,1),(0,0)", "(3,3),(2,2)"}},
+	}
+
+	for _, test := range tests {
+		elems := parseArray([]byte(test.s), test.delim)
+		if len(elems) != len(test.want) {
+			t.Errorf("'%s': have %d elements, but want %d", test.s, len(elems), len(test.want))
+			continue
+		}
+		for i, elem := range elems {
+			have := string(elem)
+			if elem == nil {
+				have = "<nil>"
+			}
+			if have != test.want[i] {
+				t.Errorf("'%s': element %d: have '%s', but want '%s'", test.s, i, have, test.want[i])
+			}
+		}
+	}
+}
+
+func Test_TypedArrays(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		var nums []*big.Rat
+		var times []time.Time
+		var uuids []string
+		var boxes []string
+		_, err := conn.Scan(`SELECT '{1.5,NULL,-3}'::numeric[],
+			'{"2010-01-02 03:04:05","2011-02-03 04:05:06"}'::timestamp[],
+			'{a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11}'::uuid[],
+			'{(1,1),(0,0);(3,3),(2,2)}'::box[];`, &nums, &times, &uuids, &boxes)
+		if err != nil {
+			t.Error("failed to scan:", err)
+			return
+		}
+
+		if len(nums) != 3 || nums[0].Cmp(big.NewRat(3, 2)) != 0 || nums[1] != nil || nums[2].Cmp(big.NewRat(-3, 1)) != 0 {
+			t.Errorf("unexpected numeric[]: %v", nums)
+		}
+		if len(times) != 2 || times[0].Year() != 2010 || times[1].Second() != 6 {
+			t.Errorf("unexpected timestamp[]: %v", times)
+		}
+		if len(uuids) != 1 || uuids[0] != "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11" {
+			t.Errorf("unexpected uuid[]: %v", uuids)
+		}
+		if len(boxes) != 2 || boxes[1] != "(3,3),(2,2)" {
+			t.Errorf("unexpected box[]: %v", boxes)
+		}
+	})
+}
+
+func Test_Conn_SetLogRedaction(t *testing.T) {
+	withConnLog(t, LogCommand, func(conn *Conn) {
+		buf := bytes.NewBuffer(nil)
+		log.SetOutput(buf)
+		defer log.SetOutput(os.Stderr)
+
+		conn.SetLogRedaction(true)
+
+		stmt, err := conn.Prepare("SELECT @secret;", param("@secret", Text, "hunter2"))
+		if err != nil {
+			t.Error("failed to prepare statement:", err)
+			return
+		}
+		defer stmt.Close()
+
+		var s string
+		if _, err := stmt.Scan(&s); err != nil {
+			t.Error("failed to scan:", err)
+			return
+		}
+
+		if out := buf.String(); strings.Contains(out, "hunter2") {
+			t.Errorf("log contains parameter value: %s", out)
+		} else if !strings.Contains(out, "@secret") {
+			t.Errorf("log does not contain parameter name: %s", out)
+		}
+	})
+}
+
+func Test_Connect_UnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopgsql")
+	if err != nil {
+		t.Fatal("failed to create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen("unix", dir+"/.s.PGSQL.5433")
+	if err != nil {
+		t.Fatal("failed to listen:", err)
+	}
+	defer l.Close()
+
+	accepted := make(chan bool, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			c.Close()
+		}
+		accepted <- err == nil
+	}()
+
+	if _, err := Connect("host="+dir+" port=5433 user=testuser", LogNothing); err == nil {
+		t.Error("expected error when the server closes the connection")
+	}
+
+	if !<-accepted {
+		t.Error("no connection accepted on the Unix-domain socket")
+	}
+}
+
+// withFakeServer listens on a Unix-domain socket in a temporary directory and
+// calls serve for the first connection accepted. f is called with the socket
+// directory, to be used as host.
+func withFakeServer(t *testing.T, serve func(c net.Conn), f func(host string)) {
+	dir, err := ioutil.TempDir("", "gopgsql")
+	if err != nil {
+		t.Fatal("failed to create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen("unix", dir+"/.s.PGSQL.5432")
+	if err != nil {
+		t.Fatal("failed to listen:", err)
+	}
+	defer l.Close()
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+
+		serve(c)
+	}()
+
+	f(dir)
+
+	l.Close()
+	<-done
+}
+
+func Test_Connect_UnsupportedAuthentication(t *testing.T) {
+	serve := func(c net.Conn) {
+		buf := make([]byte, 1024)
+		c.Read(buf)
+
+		// AuthenticationGSS
+		c.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 7})
+
+		c.Read(buf)
+	}
+
+	withFakeServer(t, serve, func(host string) {
+		_, err := Connect("host="+host+" user=testuser", LogNothing)
+		if err == nil || !strings.Contains(err.Error(), "AuthenticationGSS") {
+			t.Errorf("expected error naming AuthenticationGSS, have: %v", err)
+		}
+	})
+}
+
+func Test_scramClient(t *testing.T) {
+	// Test vector from RFC 7677.
+	sc := newScramClient("pencil", "rOprNGfwEbeRWgbNEkqO")
+	sc.clientFirstBare = "n=user,r=rOprNGfwEbeRWgbNEkqO"
+
+	final, err := sc.finalMessage([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"))
+	if err != nil {
+		t.Fatal("finalMessage failed:", err)
+	}
+
+	if want := "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="; string(final) != want {
+		t.Errorf("have: '%s', but want: '%s'", final, want)
+	}
+
+	if err := sc.verifyServerFinal([]byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")); err != nil {
+		t.Error("verifyServerFinal failed:", err)
+	}
+	if err := sc.verifyServerFinal([]byte("v=AAAATRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")); err == nil {
+		t.Error("verifyServerFinal accepted a wrong signature")
+	}
+}
+
+type tokenAuthenticator struct {
+	token string
+}
+
+func (a tokenAuthenticator) Authenticate(conn *Conn, authType int32, data []byte) ([]byte, error) {
+	if authType != 3 {
+		return nil, fmt.Errorf("unexpected authentication type: %d", authType)
+	}
+
+	return append([]byte(a.token), 0), nil
+}
+
+// fallbackAuthenticator sends a token for cleartext password requests and
+// leaves the other methods to the built-in authentication.
+type fallbackAuthenticator struct {
+	token string
+}
+
+func (a fallbackAuthenticator) Authenticate(conn *Conn, authType int32, data []byte) ([]byte, error) {
+	if authType == 3 {
+		return append([]byte(a.token), 0), nil
+	}
+
+	return PasswordAuthenticator{}.Authenticate(conn, authType, data)
+}
+
+func Test_ConnParams_Authenticator(t *testing.T) {
+	received := make(chan string, 1)
+
+	serve := func(c net.Conn) {
+		buf := make([]byte, 1024)
+		c.Read(buf)
+
+		// AuthenticationCleartextPassword
+		c.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 3})
+
+		n, _ := c.Read(buf)
+		if n > 5 && buf[0] == 'p' {
+			received <- string(bytes.TrimRight(buf[5:n], "\x00"))
+		}
+		close(received)
+	}
+
+	withFakeServer(t, serve, func(host string) {
+		params := &ConnParams{Host: host, User: "testuser", Authenticator: tokenAuthenticator{"secret-token"}}
+
+		ConnectParams(params, LogNothing)
+
+		if token := <-received; token != "secret-token" {
+			t.Errorf("have: '%s', but want: 'secret-token'", token)
+		}
+	})
+}
+
+func Test_PasswordAuthenticator_Delegation(t *testing.T) {
+	salt := []byte{1, 2, 3, 4}
+	received := make(chan string, 1)
+
+	serve := func(c net.Conn) {
+		buf := make([]byte, 1024)
+		c.Read(buf)
+
+		// AuthenticationMD5Password
+		c.Write(append([]byte{'R', 0, 0, 0, 12, 0, 0, 0, 5}, salt...))
+
+		n, _ := c.Read(buf)
+		if n > 5 && buf[0] == 'p' {
+			received <- string(bytes.TrimRight(buf[5:n], "\x00"))
+		}
+		close(received)
+	}
+
+	withFakeServer(t, serve, func(host string) {
+		params := &ConnParams{Host: host, User: "testuser", Password: "secret", Authenticator: fallbackAuthenticator{"secret-token"}}
+
+		ConnectParams(params, LogNothing)
+
+		if have, want := <-received, md5Password("testuser", "secret", salt); have != want {
+			t.Errorf("have: '%s', but want: '%s'", have, want)
+		}
+	})
+}
+
+func Test_readAuthenticationRequest_InvalidLength(t *testing.T) {
+	tests := []struct {
+		msgLen int32
+		want   string
+	}{
+		{4, "invalid AuthenticationRequest message length"},
+		{1 << 30, "exceeds maximum"},
+	}
+
+	for _, test := range tests {
+		var server, client bytes.Buffer
+		// The startup response is checked before it is read, so send a
+		// valid AuthenticationCleartextPassword first.
+		server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 3})
+		server.WriteByte('R')
+		binary.Write(&server, binary.BigEndian, test.msgLen)
+		// AuthenticationMD5Password with salt
+		server.Write([]byte{0, 0, 0, 5, 1, 2, 3, 4})
+
+		_, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser", Password: "secret", MaxMessageSize: 1024}, LogNothing)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%d: have: %v, but want error containing '%s'", test.msgLen, err, test.want)
+		}
+	}
+}
+
+func Test_ConnParams_PasswordProvider(t *testing.T) {
+	serve := func(c net.Conn) {
+		buf := make([]byte, 1024)
+		c.Read(buf)
+
+		// AuthenticationCleartextPassword
+		c.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 3})
+
+		c.Read(buf)
+	}
+
+	withFakeServer(t, serve, func(host string) {
+		providerErr := errors.New("token expired")
+
+		params := &ConnParams{Host: host, User: "testuser"}
+		params.PasswordProvider = func() (string, error) {
+			return "", providerErr
+		}
+
+		if _, err := ConnectParams(params, LogNothing); err != providerErr {
+			t.Errorf("have: %v, but want: %v", err, providerErr)
+		}
+	})
+}
+
+func Test_parseServerVersion(t *testing.T) {
+	tests := []struct {
+		s            string
+		major, minor int
+	}{
+		{"8.4.1", 8, 4},
+		{"9.6.24 (Ubuntu 9.6.24-1.pgdg20.04+1)", 9, 6},
+		{"14.2", 14, 2},
+		{"15beta1", 15, 0},
+		{"16devel", 16, 0},
+		{"10", 10, 0},
+	}
+
+	for _, test := range tests {
+		major, minor, err := parseServerVersion(test.s)
+		if err != nil {
+			t.Errorf("'%s': %v", test.s, err)
+		} else if major != test.major || minor != test.minor {
+			t.Errorf("'%s': have: %d.%d, but want: %d.%d", test.s, major, minor, test.major, test.minor)
+		}
+	}
+
+	if _, _, err := parseServerVersion("devel"); err == nil {
+		t.Error("expected error for 'devel'")
+	}
+}
+
+func Test_Conn_dispatchEvent_DropsOldest(t *testing.T) {
+	conn := &Conn{}
+	events := conn.Events()
+
+	for i := 0; i < eventBufferSize+2; i++ {
+		conn.dispatchEvent(&Notification{PID: int32(i)})
+	}
+
+	if dropped := conn.DroppedEvents(); dropped != 2 {
+		t.Errorf("have %d dropped events, but want 2", dropped)
+	}
+
+	if n := (<-events).(*Notification); n.PID != 2 {
+		t.Errorf("have oldest event with PID %d, but want 2", n.PID)
+	}
+}
+
+func Test_Conn_Events(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		events := conn.Events()
+
+		if _, err := conn.Execute("LISTEN gopgsql_test;"); err != nil {
+			t.Error("failed to listen:", err)
+			return
+		}
+		if _, err := conn.Execute("NOTIFY gopgsql_test, 'hello';"); err != nil {
+			t.Error("failed to notify:", err)
+			return
+		}
+		if _, err := conn.Execute("DO $$ BEGIN RAISE NOTICE 'watch out'; END $$;"); err != nil {
+			t.Error("failed to raise notice:", err)
+			return
+		}
+
+		n, ok := (<-events).(*Notification)
+		if !ok || n.Channel != "gopgsql_test" || n.Payload != "hello" {
+			t.Errorf("unexpected notification: %#v", n)
+		}
+
+		notice, ok := (<-events).(*Notice)
+		if !ok || notice.Message() != "watch out" {
+			t.Errorf("unexpected notice: %#v", notice)
+		}
+	})
+}
+
+type testEmail struct {
+	user, domain string
+}
+
+func (e testEmail) String() string {
+	return e.user + "@" + e.domain
+}
+
+type testMoney int64
+
+func (m testMoney) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d.%02d", m/100, m%100)), nil
+}
+
+func (m testMoney) String() string {
+	return "not used"
+}
+
+type testBlob []byte
+
+func (b testBlob) Value() (driver.Value, error) {
+	return []byte(b), nil
+}
+
+func Test_formatParamValue_Interfaces(t *testing.T) {
+	tests := []struct {
+		typ    Type
+		value  interface{}
+		want   string
+		isNull bool
+	}{
+		{Text, testEmail{"joe", "example.com"}, "joe@example.com", false},
+		{Custom, testMoney(1234), "12.34", false},
+		{Text, (*testEmail)(nil), "", true},
+		{Date, time.Date(2013, 1, 2, 3, 4, 5, 0, time.UTC), "2013-01-02", false},
+		{Bytea, testBlob{0xde, 0xad}, `\xdead`, false},
+		{Text, testBlob("hi"), "hi", false},
+		{Bytea, testBlob(nil), "", true},
+		{Text, time.Date(2013, 1, 2, 3, 4, 5, 0, time.FixedZone("", 3600)), "2013-01-02 03:04:05+01:00", false},
+	}
+
+	for _, test := range tests {
+		s, isNull := formatParamValue(test.typ, test.value)
+		if s != test.want || isNull != test.isNull {
+			t.Errorf("%T: have: '%s' (null: %t), but want: '%s' (null: %t)", test.value, s, isNull, test.want, test.isNull)
+		}
+	}
+}
+
+func Test_newPositionalParameter_Bytes(t *testing.T) {
+	if s, isNull := formatParamValue(Bytea, newPositionalParameter(1, []byte{0xde, 0xad}).value); isNull || s != `\xdead` {
+		t.Errorf("have: '%s' (null: %t), but want: '\\xdead'", s, isNull)
+	}
+	if _, isNull := formatParamValue(Bytea, newPositionalParameter(1, []byte(nil)).value); !isNull {
+		t.Error("expected nil []byte to be NULL")
+	}
+}
+
+func Test_Parameter_SetValue_Stringer(t *testing.T) {
+	p := NewParameter("@email", Text)
+	if err := p.SetValue(testEmail{"joe", "example.com"}); err != nil {
+		t.Error("SetValue failed:", err)
+	}
+}
+
+func Test_ResultSet_Err(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		rs, err := conn.Query("SELECT 1/(2-x) FROM generate_series(1, 3) x;")
+		if err != nil {
+			t.Error("failed to query:", err)
+			return
+		}
+		defer rs.Close()
+
+		rows := 0
+		for {
+			if hasRow, _ := rs.FetchNext(); !hasRow {
+				break
+			}
+			rows++
+		}
+
+		if rows != 1 {
+			t.Errorf("have %d rows, but want 1", rows)
+		}
+		if pgErr, ok := rs.Err().(*Error); !ok || pgErr.Code() != "22012" {
+			t.Errorf("expected division_by_zero error, have: %v", rs.Err())
+		}
+	})
+
+	withConn(t, func(conn *Conn) {
+		rs, err := conn.Query("SELECT 1;")
+		if err != nil {
+			t.Error("failed to query:", err)
+			return
+		}
+		defer rs.Close()
+
+		for {
+			if hasRow, _ := rs.FetchNext(); !hasRow {
+				break
+			}
+		}
+
+		if err := rs.Err(); err != nil {
+			t.Error("expected nil error, have:", err)
+		}
+	})
+}
+
+func Test_encodeBinaryNumeric(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []int16
+	}{
+		// ndigits, weight, sign, dscale, digits...
+		{"0", []int16{0, 0, 0, 0}},
+		{"1", []int16{1, 0, 0, 0, 1}},
+		{"12345.678", []int16{3, 1, 0, 3, 1, 2345, 6780}},
+		{"-0.0001", []int16{1, -1, 0x4000, 4, 1}},
+		{"100000000", []int16{1, 2, 0, 0, 1}},
+	}
+
+	for _, test := range tests {
+		buf := bytes.NewBuffer(nil)
+		encodeBinaryNumeric(buf, test.s)
+
+		want := bytes.NewBuffer(nil)
+		binary.Write(want, binary.BigEndian, test.want)
+
+		if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+			t.Errorf("'%s': have: %v, but want: %v", test.s, buf.Bytes(), want.Bytes())
+		}
+	}
+}
+
+func Test_Conn_CopyFromBinary(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		_, err := conn.Execute(`CREATE TEMPORARY TABLE copybinary (
+			i integer, b bigint, f double precision, n numeric, s text,
+			ts timestamp with time zone, ok boolean);`)
+		if err != nil {
+			t.Error("failed to create table:", err)
+			return
+		}
+
+		ts := time.Date(2013, 4, 5, 6, 7, 8, 0, time.UTC)
+
+		rows := make(chan []interface{}, 2)
+		rows <- []interface{}{1, int64(1 << 40), 1.5, big.NewRat(-1234567, 1000), "one", ts, true}
+		rows <- []interface{}{2, nil, nil, nil, nil, nil, nil}
+		close(rows)
+
+		n, err := conn.CopyFromBinary("copybinary", []string{"i", "b", "f", "n", "s", "ts", "ok"}, rows)
+		if err != nil {
+			t.Error("failed to copy:", err)
+			return
+		}
+		if n != 2 {
+			t.Errorf("have %d rows affected, but want 2", n)
+		}
+
+		var b int64
+		var f float64
+		var num *big.Rat
+		var s string
+		var tsHave time.Time
+		var ok bool
+		if _, err := conn.Scan("SELECT b, f, n, s, ts, ok FROM copybinary WHERE i = 1;", &b, &f, &num, &s, &tsHave, &ok); err != nil {
+			t.Error("failed to scan:", err)
+			return
+		}
+		if b != 1<<40 || f != 1.5 || num.Cmp(big.NewRat(-1234567, 1000)) != 0 || s != "one" || !tsHave.Equal(ts) || !ok {
+			t.Errorf("unexpected values: %v, %v, %v, %v, %v, %v", b, f, num, s, tsHave, ok)
+		}
+
+		bad := make(chan []interface{}, 1)
+		bad <- []interface{}{"not an int"}
+		close(bad)
+		if _, err := conn.CopyFromBinary("copybinary", []string{"i"}, bad); err == nil {
+			t.Error("expected error for invalid value")
+		}
+		if _, err := conn.Execute("SELECT 1;"); err != nil {
+			t.Error("connection unusable after failed copy:", err)
+		}
+	})
+}
+
+func Test_Conn_CopyToBinary(t *testing.T) {
+	var server, client bytes.Buffer
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0, 'Z', 0, 0, 0, 5, 'I'})
+
+	writeMessage := func(code byte, body []byte) {
+		server.WriteByte(code)
+		binary.Write(&server, binary.BigEndian, int32(4+len(body)))
+		server.Write(body)
+	}
+
+	// RowDescription, CommandComplete and ReadyForQuery for the type lookup
+	var desc bytes.Buffer
+	binary.Write(&desc, binary.BigEndian, int16(3))
+	for _, f := range []struct {
+		name    string
+		typeOID int32
+	}{{"i", _INT4OID}, {"n", _NUMERICOID}, {"s", _TEXTOID}} {
+		desc.WriteString(f.name + "\x00")
+		// Table OID, column, type OID, type size, type modifier and format
+		binary.Write(&desc, binary.BigEndian, int32(0))
+		binary.Write(&desc, binary.BigEndian, int16(0))
+		binary.Write(&desc, binary.BigEndian, f.typeOID)
+		binary.Write(&desc, binary.BigEndian, int16(-1))
+		binary.Write(&desc, binary.BigEndian, int32(-1))
+		binary.Write(&desc, binary.BigEndian, int16(0))
+	}
+	writeMessage('T', desc.Bytes())
+	writeMessage('C', []byte("SELECT 0\x00"))
+	writeMessage('Z', []byte{'I'})
+
+	// CopyOutResponse
+	writeMessage('H', []byte{1, 0, 3, 0, 1, 0, 1, 0, 1})
+
+	var data bytes.Buffer
+	data.WriteString(copyBinarySignature)
+	binary.Write(&data, binary.BigEndian, []int32{0, 0})
+
+	binary.Write(&data, binary.BigEndian, int16(3))
+	binary.Write(&data, binary.BigEndian, []int32{4, 42})
+	var num bytes.Buffer
+	encodeBinaryNumeric(&num, "-12345.678")
+	binary.Write(&data, binary.BigEndian, int32(num.Len()))
+	data.Write(num.Bytes())
+	binary.Write(&data, binary.BigEndian, int32(3))
+	data.WriteString("one")
+
+	binary.Write(&data, binary.BigEndian, int16(3))
+	binary.Write(&data, binary.BigEndian, []int32{4, 7, -1, -1})
+
+	binary.Write(&data, binary.BigEndian, int16(-1))
+
+	// Split the data in the middle of the first tuple.
+	b := data.Bytes()
+	writeMessage('d', b[:30])
+	writeMessage('d', b[30:])
+	writeMessage('c', nil)
+	writeMessage('C', []byte("COPY 2\x00"))
+	writeMessage('Z', []byte{'I'})
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	rows := make(chan []interface{}, 2)
+	n, err := conn.CopyToBinary("copybinary", nil, rows)
+	if err != nil {
+		t.Fatal("failed to copy:", err)
+	}
+	if n != 2 {
+		t.Errorf("have %d rows affected, but want 2", n)
+	}
+
+	var have [][]interface{}
+	for row := range rows {
+		have = append(have, row)
+	}
+	if len(have) != 2 {
+		t.Fatalf("have %d rows, but want 2", len(have))
+	}
+
+	if i, ok := have[0][0].(int); !ok || i != 42 {
+		t.Errorf("have i: %v, but want 42", have[0][0])
+	}
+	if r, ok := have[0][1].(*big.Rat); !ok || r.Cmp(big.NewRat(-12345678, 1000)) != 0 {
+		t.Errorf("have n: %v, but want -12345.678", have[0][1])
+	}
+	if s, ok := have[0][2].(string); !ok || s != "one" {
+		t.Errorf("have s: %v, but want 'one'", have[0][2])
+	}
+	if i, ok := have[1][0].(int); !ok || i != 7 || have[1][1] != nil || have[1][2] != nil {
+		t.Errorf("have second row: %v, but want [7 <nil> <nil>]", have[1])
+	}
+}
+
+func Test_Statement_Name(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		stmt, err := conn.Prepare("SELECT 1;")
+		if err != nil {
+			t.Error("failed to prepare statement:", err)
+			return
+		}
+		defer stmt.Close()
+
+		if stmt.Name() == "" || stmt.PortalName() == "" {
+			t.Errorf("expected non-empty names, have: '%s', '%s'", stmt.Name(), stmt.PortalName())
+		}
+
+		var count int
+		if _, err := conn.Scan("SELECT count(*) FROM pg_prepared_statements WHERE name = '"+stmt.Name()+"';", &count); err != nil {
+			t.Error("failed to scan:", err)
+		} else if count != 1 {
+			t.Errorf("statement '%s' not found in pg_prepared_statements", stmt.Name())
+		}
+	})
+}
+
+func Test_ResultSet_SetNullValue(t *testing.T) {
+	withSimpleQueryResultSet(t, "SELECT 1 AS _1, null AS _null;", func(rs *ResultSet) {
+		rs.SetNullValue(`\N`)
+
+		m := make(map[string]interface{})
+		if _, err := rs.ScanMap(m); err != nil {
+			t.Error("failed to scan map:", err)
+			return
+		}
+		if m["_1"] != 1 || m["_null"] != `\N` {
+			t.Errorf("unexpected map: %v", m)
+		}
+	})
+}
+
+func Test_MacAddr(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		mac, _ := net.ParseMAC("08:00:2b:01:02:03")
+
+		stmt, err := conn.Prepare("SELECT @mac, '08002b:010203'::macaddr;", param("@mac", MacAddr, mac))
+		if err != nil {
+			t.Error("failed to prepare statement:", err)
+			return
+		}
+		defer stmt.Close()
+
+		var have1, have2 net.HardwareAddr
+		if _, err := stmt.Scan(&have1, &have2); err != nil {
+			t.Error("failed to scan:", err)
+			return
+		}
+
+		if have1.String() != mac.String() || have2.String() != mac.String() {
+			t.Errorf("have: %s, %s, but want: %s", have1, have2, mac)
+		}
+	})
+}
+
+func Test_positionalParamRefs(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []int
+	}{
+		{"SELECT $1, $2::int, $10;", []int{1, 2, 10}},
+		{"SELECT '$1', \"$2\", $3 -- $4\n, /* $5 */ $6;", []int{3, 6}},
+		{"CREATE FUNCTION f(int) RETURNS int AS $$ SELECT $1 $$ LANGUAGE sql;", nil},
+		{"DO $body$ BEGIN PERFORM $1; END $body$; SELECT $2;", []int{2}},
+		{"SELECT a$1 FROM t;", nil},
+		{"SELECT E'it\\'s $1', $2;", []int{2}},
+		{"SELECT e'\\\\', $1, 'it''s $2', \"a\"\"$3\", $4;", []int{1, 4}},
+		{"SELECT '\\', $1;", []int{1}},
+	}
+
+	for _, test := range tests {
+		have := positionalParamRefs(test.command)
+		if fmt.Sprint(have) != fmt.Sprint(test.want) {
+			t.Errorf("'%s': have: %v, but want: %v", test.command, have, test.want)
+		}
+	}
+}
+
+func Test_Statement_checkParameters(t *testing.T) {
+	conn := &Conn{}
+
+	check := func(command string, params ...*Parameter) (err error) {
+		defer func() {
+			if x := recover(); x != nil {
+				err = x.(error)
+			}
+		}()
+
+		stmt := newStatement(conn, command, params, true)
+		stmt.actualCommand = adjustCommand(command, params)
+		stmt.checkParameters()
+
+		return
+	}
+
+	if err := check("SELECT @a, @b;", NewParameter("@a", Integer), NewParameter("@b", Integer)); err != nil {
+		t.Error("unexpected error:", err)
+	}
+	if err := check("SELECT @a;", NewParameter("@a", Integer), NewParameter("@foo", Integer)); err == nil || !strings.Contains(err.Error(), "@foo") {
+		t.Errorf("expected error naming @foo, have: %v", err)
+	}
+	if err := check("SELECT @a, $3;", NewParameter("@a", Integer)); err == nil || !strings.Contains(err.Error(), "$3") {
+		t.Errorf("expected error naming $3, have: %v", err)
+	}
+	if err := check(`SELECT @a, E'it\'s $3';`, NewParameter("@a", Integer)); err != nil {
+		t.Error("unexpected error for $3 in escape string literal:", err)
+	}
+}
+
+func Test_readDataRow_ScanBuffer(t *testing.T) {
+	// DataRow message body without the message code: length, field count,
+	// 'abc' and NULL.
+	row := []byte{0, 0, 0, 17, 0, 2, 0, 0, 0, 3, 'a', 'b', 'c', 0xff, 0xff, 0xff, 0xff}
+
+	conn := &Conn{maxMessageSize: defaultMaxMessageSize}
+	conn.reader = bufio.NewReader(bytes.NewReader(append(append([]byte{}, row...), row...)))
+
+	rs := &ResultSet{conn: conn, values: make([][]byte, 2)}
+	rs.scanBuffer = &ScanBuffer{}
+
+	conn.readDataRow(rs)
+	if string(rs.values[0]) != "abc" || rs.values[1] != nil {
+		t.Errorf("unexpected values: %q", rs.values)
+	}
+	first := &rs.scanBuffer.data[0]
+
+	conn.readDataRow(rs)
+	if string(rs.values[0]) != "abc" || rs.values[1] != nil {
+		t.Errorf("unexpected values: %q", rs.values)
+	}
+	if &rs.scanBuffer.data[0] != first {
+		t.Error("buffer was not reused")
+	}
+}
+
+func Test_NewConnFromStreams(t *testing.T) {
+	var server bytes.Buffer
+	// AuthenticationOk
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	// ParameterStatus server_version = 9.2.4
+	server.Write([]byte{'S', 0, 0, 0, 25})
+	server.WriteString("server_version\x009.2.4\x00")
+	// ReadyForQuery
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+	// RowDescription with a single int4 field "x"
+	server.Write([]byte{'T', 0, 0, 0, 26, 0, 1, 'x', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 23, 0, 4, 0xff, 0xff, 0xff, 0xff, 0, 0})
+	// DataRow, CommandComplete and ReadyForQuery
+	server.Write([]byte{'D', 0, 0, 0, 12, 0, 1, 0, 0, 0, 2, '4', '2'})
+	server.Write([]byte{'C', 0, 0, 0, 13})
+	server.WriteString("SELECT 1\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	if major, minor, _ := conn.ServerVersion(); major != 9 || minor != 2 {
+		t.Errorf("have server version %d.%d, but want 9.2", major, minor)
+	}
+
+	var x int
+	if _, err := conn.Scan("SELECT 42 AS x;", &x); err != nil {
+		t.Error("failed to scan:", err)
+	} else if x != 42 {
+		t.Errorf("have: %d, but want: 42", x)
+	}
+
+	if !bytes.Contains(client.Bytes(), []byte("SELECT 42 AS x;")) {
+		t.Error("query not written to the client stream")
+	}
+}
+
+func Test_Conn_BackendPID(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		var pid int
+		if _, err := conn.Scan("SELECT pg_backend_pid();", &pid); err != nil {
+			t.Error("failed to scan:", err)
+			return
+		}
+
+		if have := conn.BackendPID(); have != pid {
+			t.Errorf("have: %d, but want: %d", have, pid)
+		}
+	})
+}
+
+func Test_CustomTypeParameter_Jsonb(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		filter := NewCustomTypeParameter("@filter", "jsonb")
+		filter.SetValue(`{"a": 1}`)
+
+		var contains bool
+		stmt, err := conn.Prepare(`SELECT '{"a": 1, "b": 2}'::jsonb @> @filter;`, filter)
+		if err != nil {
+			t.Error("failed to prepare statement:", err)
+			return
+		}
+		defer stmt.Close()
+
+		if _, err := stmt.Scan(&contains); err != nil {
+			t.Error("failed to scan:", err)
+		} else if !contains {
+			t.Error("have: false, but want: true")
+		}
+	})
+}
+
+func Test_ResultSet_AllMaps_MaxBufferedRows(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		conn.SetMaxBufferedRows(3)
+
+		rs, err := conn.Query("SELECT x FROM generate_series(1, 3) x;")
+		if err != nil {
+			t.Error("failed to query:", err)
+			return
+		}
+		maps, err := rs.AllMaps()
+		rs.Close()
+		if err != nil || len(maps) != 3 || maps[2]["x"] != 3 {
+			t.Errorf("unexpected result: %v, %v", maps, err)
+		}
+
+		rs, err = conn.Query("SELECT x FROM generate_series(1, 4) x;")
+		if err != nil {
+			t.Error("failed to query:", err)
+			return
+		}
+		if _, err := rs.AllMaps(); err == nil {
+			t.Error("expected error for too many rows")
+		}
+		rs.Close()
+	})
+}
+
+func Test_parseTimeOfDay(t *testing.T) {
+	tests := []struct {
+		s    string
+		want TimeOfDay
+	}{
+		{"04:05:06", TimeOfDay{Hour: 4, Minute: 5, Second: 6}},
+		{"23:59:59.5", TimeOfDay{23, 59, 59, 500000, false, 0}},
+		{"04:05:06.789-08", TimeOfDay{4, 5, 6, 789000, true, -8 * 3600}},
+		{"04:05:06+05:30", TimeOfDay{4, 5, 6, 0, true, 5*3600 + 30*60}},
+		{"24:00:00+00", TimeOfDay{24, 0, 0, 0, true, 0}},
+	}
+
+	for _, test := range tests {
+		have, err := parseTimeOfDay(test.s)
+		if err != nil {
+			t.Errorf("'%s': %v", test.s, err)
+			continue
+		}
+		if have != test.want {
+			t.Errorf("'%s': have: %+v, but want: %+v", test.s, have, test.want)
+		}
+		if s := have.String(); s != test.s {
+			t.Errorf("have: '%s', but want: '%s'", s, test.s)
+		}
+	}
+
+	if _, err := parseTimeOfDay("04:05"); err == nil {
+		t.Error("expected error for '04:05'")
+	}
+}
+
+func Test_TimeOfDay(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		slot := TimeOfDay{Hour: 9, Minute: 30, Second: 0, HasZone: true, ZoneOffset: -5 * 3600}
+
+		stmt, err := conn.Prepare("SELECT @slot, '12:34:56.789'::time;", param("@slot", TimeTZ, slot))
+		if err != nil {
+			t.Error("failed to prepare statement:", err)
+			return
+		}
+		defer stmt.Close()
+
+		var have1, have2 TimeOfDay
+		if _, err := stmt.Scan(&have1, &have2); err != nil {
+			t.Error("failed to scan:", err)
+			return
+		}
+
+		if have1 != slot {
+			t.Errorf("have: %+v, but want: %+v", have1, slot)
+		}
+		if want := (TimeOfDay{12, 34, 56, 789000, false, 0}); have2 != want {
+			t.Errorf("have: %+v, but want: %+v", have2, want)
+		}
+	})
+}
+
+func Test_ResultSet_FieldDescriptions(t *testing.T) {
+	// RowDescription message body without the message code: a single
+	// varchar(50) field "name", column 2 of the table with OID 16384.
+	desc := []byte{0, 0, 0, 29, 0, 1, 'n', 'a', 'm', 'e', 0, 0, 0, 0x40, 0, 0, 2, 0, 0, 4, 0x13, 0xff, 0xff, 0, 0, 0, 54, 0, 0}
+
+	conn := &Conn{maxMessageSize: defaultMaxMessageSize}
+	conn.reader = bufio.NewReader(bytes.NewReader(desc))
+
+	rs := newResultSet(conn)
+	conn.readRowDescription(rs)
+
+	want := FieldDesc{
+		Name:            "name",
+		TableOID:        16384,
+		AttributeNumber: 2,
+		TypeOID:         _VARCHAROID,
+		TypeSize:        -1,
+		TypeModifier:    54,
+		Format:          0,
+	}
+
+	have := rs.FieldDescriptions()
+	if len(have) != 1 {
+		t.Fatalf("have %d field descriptions, but want 1", len(have))
+	}
+	if have[0] != want {
+		t.Errorf("have: %+v, but want: %+v", have[0], want)
+	}
+}
+
+func Test_Conn_Cancel(t *testing.T) {
+	received := make(chan []byte, 1)
+
+	serve := func(c net.Conn) {
+		buf := make([]byte, 16)
+		if _, err := io.ReadFull(c, buf); err == nil {
+			received <- buf
+		}
+	}
+
+	withFakeServer(t, serve, func(host string) {
+		conn := &Conn{
+			params:           &ConnParams{Host: host, Port: 5432},
+			backendPID:       42,
+			backendSecretKey: 7,
+		}
+
+		if err := conn.Cancel(); err != nil {
+			t.Fatal("failed to cancel:", err)
+		}
+	})
+
+	want := []byte{0, 0, 0, 16, 0x04, 0xd2, 0x16, 0x2e, 0, 0, 0, 42, 0, 0, 0, 7}
+	select {
+	case have := <-received:
+		if !bytes.Equal(have, want) {
+			t.Errorf("have: %v, but want: %v", have, want)
+		}
+
+	default:
+		t.Error("no CancelRequest received")
+	}
+}
+
+func Test_Conn_Cancel_TimeoutKeepsConnection(t *testing.T) {
+	var server, client bytes.Buffer
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0, 'Z', 0, 0, 0, 5, 'I'})
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	// Dialing the cancel connection times out right away.
+	conn.dial = nil
+	conn.params.Host = "127.0.0.1"
+	conn.params.Port = 5432
+	conn.params.ConnectTimeout = time.Nanosecond
+
+	err = conn.Cancel()
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Fatalf("expected timeout error, have: %v", err)
+	}
+	if status := conn.Status(); status != StatusReady {
+		t.Errorf("have status: %s, but want: %s", status, StatusReady)
+	}
+}
+
+func Test_ParallelQuery_ParamSetCountMismatch(t *testing.T) {
+	if _, err := ParallelQuery([]*Conn{{}}, "SELECT $1;", nil); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func Test_ParallelQuery_FailureCancelsOthers(t *testing.T) {
+	startup := []byte{'R', 0, 0, 0, 8, 0, 0, 0, 0, 'Z', 0, 0, 0, 5, 'I'}
+
+	// The first partition fails right away.
+	var server1, client1 bytes.Buffer
+	server1.Write(startup)
+	message := "SERROR\x0042P01\x00Mno such table\x00\x00"
+	server1.WriteByte('E')
+	binary.Write(&server1, binary.BigEndian, int32(4+len(message)))
+	server1.WriteString(message)
+
+	conn1, err := NewConnFromStreams(&server1, &client1, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	// The second one is in a long query, which only ends when canceled.
+	canceled := make(chan bool)
+	r, w := io.Pipe()
+	go func() {
+		w.Write(startup)
+		// ParseComplete, ParameterDescription, RowDescription, BindComplete
+		// and RowDescription
+		rowDescription := []byte{'T', 0, 0, 0, 26, 0, 1, 'x', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 23, 0, 4, 0xff, 0xff, 0xff, 0xff, 0, 0}
+		w.Write([]byte{'1', 0, 0, 0, 4, 't', 0, 0, 0, 6, 0, 0})
+		w.Write(rowDescription)
+		w.Write([]byte{'2', 0, 0, 0, 4})
+		w.Write(rowDescription)
+
+		<-canceled
+
+		message := "SERROR\x0057014\x00Mcanceled\x00\x00"
+		var buf bytes.Buffer
+		buf.WriteByte('E')
+		binary.Write(&buf, binary.BigEndian, int32(4+len(message)))
+		buf.WriteString(message)
+		buf.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+		w.Write(buf.Bytes())
+	}()
+
+	var client2 bytes.Buffer
+	conn2, err := NewConnFromStreams(r, &client2, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	serve := func(c net.Conn) {
+		buf := make([]byte, 16)
+		if _, err := io.ReadFull(c, buf); err == nil {
+			close(canceled)
+		}
+	}
+
+	withFakeServer(t, serve, func(host string) {
+		// Cancel requires the server address, which streams don't have.
+		conn2.dial = nil
+		conn2.params.Host = host
+		conn2.params.Port = 5432
+
+		rows, err := ParallelQuery([]*Conn{conn1, conn2}, "SELECT pg_sleep(3600), 1 AS x;", [][]interface{}{{}, {}})
+		if err != nil {
+			t.Fatal("failed to start queries:", err)
+		}
+
+		var results []RowResult
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case row, ok := <-rows:
+				if ok {
+					results = append(results, row)
+					continue
+				}
+
+			case <-timeout:
+				t.Fatal("queries have not been canceled")
+			}
+			break
+		}
+
+		if len(results) != 1 || results[0].Partition != 0 || results[0].Err == nil {
+			t.Errorf("have: %+v, but want only the error of partition 0", results)
+		}
+	})
+}
+func Test_ParallelQuery(t *testing.T) {
+	withConn(t, func(conn1 *Conn) {
+		withConn(t, func(conn2 *Conn) {
+			rows, err := ParallelQuery([]*Conn{conn1, conn2},
+				"SELECT x FROM generate_series($1::int, $2::int) AS x;",
+				[][]interface{}{{1, 50}, {51, 100}})
+			if err != nil {
+				t.Fatal("failed to start queries:", err)
+			}
+
+			var sum, count int
+			for row := range rows {
+				if row.Err != nil {
+					t.Error("query failed:", row.Err)
+					continue
+				}
+				sum += row.Values[0].(int)
+				count++
+			}
+
+			if count != 100 || sum != 5050 {
+				t.Errorf("have %d rows with sum %d, but want 100 rows with sum 5050", count, sum)
+			}
+		})
+	})
+}
+
+func Test_Statement_ReturnsRows(t *testing.T) {
+	var server bytes.Buffer
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+	// ParseComplete, ParameterDescription without parameters and NoData
+	server.Write([]byte{'1', 0, 0, 0, 4, 't', 0, 0, 0, 6, 0, 0, 'n', 0, 0, 0, 4})
+	// ParseComplete, ParameterDescription without parameters and
+	// RowDescription with a single int4 field "x"
+	server.Write([]byte{'1', 0, 0, 0, 4, 't', 0, 0, 0, 6, 0, 0})
+	server.Write([]byte{'T', 0, 0, 0, 26, 0, 1, 'x', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 23, 0, 4, 0xff, 0xff, 0xff, 0xff, 0, 0})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	update, err := conn.Prepare("UPDATE table1 SET strreq = 'x';")
+	if err != nil {
+		t.Fatal("failed to prepare UPDATE:", err)
+	}
+	if update.ReturnsRows() {
+		t.Error("UPDATE: expected ReturnsRows() == false")
+	}
+
+	query, err := conn.Prepare("SELECT 1 AS x;")
+	if err != nil {
+		t.Fatal("failed to prepare SELECT:", err)
+	}
+	if !query.ReturnsRows() {
+		t.Error("SELECT: expected ReturnsRows() == true")
+	}
+}
+
+func Test_Conn_SetDefaultTransactionIsolation_InvalidLevel(t *testing.T) {
+	conn := &Conn{}
+
+	err := conn.SetDefaultTransactionIsolation("READ COMMITED")
+	if err == nil || !strings.Contains(err.Error(), "invalid isolation level") {
+		t.Errorf("expected invalid isolation level error, have: %v", err)
+	}
+}
+
+func Test_Conn_SetDefaultTransactionCharacteristics(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		if err := conn.SetDefaultTransactionIsolation("repeatable  read"); err != nil {
+			t.Fatal("failed to set isolation level:", err)
+		}
+		if err := conn.SetDefaultTransactionReadOnly(true); err != nil {
+			t.Fatal("failed to set read-only:", err)
+		}
+
+		var isolation, readOnly string
+		if _, err := conn.Scan("SELECT current_setting('default_transaction_isolation'), current_setting('default_transaction_read_only');", &isolation, &readOnly); err != nil {
+			t.Fatal("failed to scan:", err)
+		}
+
+		if isolation != "repeatable read" || readOnly != "on" {
+			t.Errorf("have: '%s', '%s', but want: 'repeatable read', 'on'", isolation, readOnly)
+		}
+	})
+}
+
+// chunkReader returns one chunk per Read, so a bufio.Reader reading from it
+// doesn't read ahead of the chunk it needs.
+type chunkReader [][]byte
+
+func (r *chunkReader) Read(b []byte) (n int, err error) {
+	if len(*r) == 0 {
+		return 0, io.EOF
+	}
+
+	n = copy(b, (*r)[0])
+	if n == len((*r)[0]) {
+		*r = (*r)[1:]
+	} else {
+		(*r)[0] = (*r)[0][n:]
+	}
+
+	return
+}
+
+func Test_Conn_SetMessageTracer(t *testing.T) {
+	server := &chunkReader{
+		// AuthenticationOk and ReadyForQuery
+		{'R', 0, 0, 0, 8, 0, 0, 0, 0, 'Z', 0, 0, 0, 5, 'I'},
+		// CommandComplete, split across reads, and ReadyForQuery
+		{'C', 0, 0, 0, 11, 'L', 'I', 'S'},
+		{'T', 'E', 'N', 0, 'Z', 0, 0, 0, 5, 'I'},
+	}
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	var trace []string
+	conn.SetMessageTracer(func(direction byte, msgType byte, payload []byte) {
+		trace = append(trace, fmt.Sprintf("%c %c %q", direction, msgType, payload))
+	})
+
+	if _, err := conn.Execute("LISTEN x;"); err != nil {
+		t.Fatal("failed to execute:", err)
+	}
+
+	want := []string{
+		`F Q "LISTEN x;\x00"`,
+		`B C "LISTEN\x00"`,
+		`B Z "I"`,
+	}
+	if len(trace) != len(want) {
+		t.Fatalf("have trace: %q, but want: %q", trace, want)
+	}
+	for i := range want {
+		if trace[i] != want[i] {
+			t.Errorf("message %d: have: %s, but want: %s", i, trace[i], want[i])
+		}
+	}
+}
+
+func Test_Conn_QueryScalar(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		var count int64
+		if err := conn.QueryScalar("SELECT count(*) FROM generate_series(1, @n);", &count, param("@n", Integer, 42)); err != nil {
+			t.Error("failed to query scalar:", err)
+		} else if count != 42 {
+			t.Errorf("have: %d, but want: 42", count)
+		}
+
+		for _, command := range []string{
+			"SELECT 1 WHERE false;",
+			"SELECT 1, 2;",
+			"SELECT generate_series(1, 2);",
+		} {
+			if err := conn.QueryScalar(command, &count); err == nil {
+				t.Errorf("'%s': expected error", command)
+			}
+		}
+
+		// The connection must still be usable.
+		stmt, err := conn.Prepare("SELECT 'x';")
+		if err != nil {
+			t.Fatal("failed to prepare:", err)
+		}
+		defer stmt.Close()
+
+		var s string
+		if err := stmt.ScanScalar(&s); err != nil || s != "x" {
+			t.Errorf("have: '%s', %v, but want: 'x', nil", s, err)
+		}
+	})
+}
+
+func Test_Conn_QueryScalar_ScanError(t *testing.T) {
+	var server, client bytes.Buffer
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0, 'Z', 0, 0, 0, 5, 'I'})
+	// RowDescription with a single int4 field "x", DataRow, CommandComplete
+	// and ReadyForQuery
+	server.Write([]byte{'T', 0, 0, 0, 26, 0, 1, 'x', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 23, 0, 4, 0xff, 0xff, 0xff, 0xff, 0, 0})
+	server.Write([]byte{'D', 0, 0, 0, 12, 0, 1, 0, 0, 0, 2, '4', '2'})
+	server.Write([]byte{'C', 0, 0, 0, 13})
+	server.WriteString("SELECT 1\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	// An integer can't be converted to time.Time, so scanning fails.
+	var x time.Time
+	if err := conn.QueryScalar("SELECT 42 AS x;", &x); err == nil {
+		t.Fatal("expected error")
+	}
+	if status := conn.Status(); status != StatusReady {
+		t.Errorf("have status: %s, but want: %s", status, StatusReady)
+	}
+	if server.Len() != 0 {
+		t.Errorf("%d bytes left unread", server.Len())
+	}
+}
+
+func Test_CustomTypeParameter_Jsonpath(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		path := NewCustomTypeParameter("@path", "jsonpath")
+		path.SetValue("$.a[*] ? (@ > 1)")
+
+		rs, err := conn.Query(`SELECT jsonb_path_query('{"a": [1, 2, 3]}', @path), @path;`, path)
+		if err != nil {
+			t.Error("failed to query:", err)
+			return
+		}
+		defer rs.Close()
+
+		var values []string
+		var pathText interface{}
+		for {
+			var v string
+			fetched, err := rs.ScanNext(&v, &pathText)
+			if err != nil {
+				t.Error("failed to scan:", err)
+				return
+			}
+			if !fetched {
+				break
+			}
+			values = append(values, v)
+		}
+
+		if len(values) != 2 || values[0] != "2" || values[1] != "3" {
+			t.Errorf("have: %q, but want: [\"2\" \"3\"]", values)
+		}
+		if s, ok := pathText.(string); !ok || s != `$."a"[*]?(@ > 1)` {
+			t.Errorf("unexpected jsonpath value: %#v", pathText)
+		}
+	})
+}
+
+func Test_Parameter_Clone(t *testing.T) {
+	template := param("@id", Integer, 7)
+
+	stmt := newStatement(&Conn{}, "SELECT @id;", []*Parameter{template}, true)
+
+	clone := template.Clone()
+	if clone.Statement() != nil {
+		t.Error("clone must not be associated with a statement")
+	}
+	if clone.Name() != "@id" || clone.Type() != Integer || clone.Value() != template.Value() {
+		t.Errorf("unexpected clone: %q %v %v", clone.Name(), clone.Type(), clone.Value())
+	}
+
+	stmt2 := newStatement(&Conn{}, "SELECT @id;", []*Parameter{clone}, true)
+	if stmt2.Parameter("@id") != clone || stmt.Parameter("@id") != template {
+		t.Error("parameters not associated with their statements")
+	}
+}
+
+func Test_Pipeline_SendSync(t *testing.T) {
+	var server bytes.Buffer
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+	// ParseComplete, BindComplete, NoData and CommandComplete
+	server.Write([]byte{'1', 0, 0, 0, 4, '2', 0, 0, 0, 4, 'n', 0, 0, 0, 4})
+	server.Write([]byte{'C', 0, 0, 0, 15})
+	server.WriteString("INSERT 0 1\x00")
+	// ErrorResponse for the second Send
+	server.Write([]byte{'E', 0, 0, 0, 25})
+	server.WriteString("SERROR\x00C42601\x00Mfail\x00\x00")
+	// ReadyForQuery after the Sync
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	p := conn.Pipeline()
+	if err := p.Execute("INSERT INTO table1 (strreq) VALUES ('x');"); err != nil {
+		t.Fatal("failed to queue:", err)
+	}
+
+	client.Reset()
+	rowsAffected, err := p.Send()
+	if err != nil {
+		t.Fatal("failed to send:", err)
+	}
+	if len(rowsAffected) != 1 || rowsAffected[0] != 1 {
+		t.Errorf("have rows affected: %v, but want: [1]", rowsAffected)
+	}
+	if sent := client.Bytes(); !bytes.HasSuffix(sent, []byte{'H', 0, 0, 0, 4}) || bytes.Contains(sent, []byte{'S', 0, 0, 0, 4}) {
+		t.Errorf("expected Flush and no Sync, have sent: %q", sent)
+	}
+
+	p.Execute("INSERT INTO table1 (strreq) VALUES (;")
+	if _, err := p.Send(); err == nil {
+		t.Error("expected error")
+	}
+
+	client.Reset()
+	if err := p.Sync(); err != nil {
+		t.Fatal("failed to sync:", err)
+	}
+	if sent := client.Bytes(); !bytes.HasPrefix(sent, []byte{'S', 0, 0, 0, 4}) {
+		t.Errorf("expected Sync, have sent: %q", sent)
+	}
+	if status := conn.Status(); status != StatusReady {
+		t.Errorf("have status: %s, but want: %s", status, StatusReady)
+	}
+}
+
+func Test_parseBytea(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []byte
+	}{
+		{`\x`, []byte{}},
+		{`\x00ff2f`, []byte{0, 0xff, '/'}},
+		{`a\001\\b`, []byte{'a', 1, '\\', 'b'}},
+	}
+
+	for _, test := range tests {
+		if have := parseBytea([]byte(test.s)); !bytes.Equal(have, test.want) {
+			t.Errorf("'%s': have: %v, but want: %v", test.s, have, test.want)
+		}
+	}
+}
+
+func Test_ResultSet_ScanInterface(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		rs, err := conn.Query(`SELECT 1::int8, 1.5::float8, true, 'x'::text, '\x0102'::bytea, NULL::int4;`)
+		if err != nil {
+			t.Error("failed to query:", err)
+			return
+		}
+		defer rs.Close()
+
+		values := make([]interface{}, 6)
+		args := make([]interface{}, len(values))
+		for i := range values {
+			args[i] = &values[i]
+		}
+
+		if _, err := rs.ScanNext(args...); err != nil {
+			t.Error("failed to scan:", err)
+			return
+		}
+
+		if values[0] != int64(1) || values[1] != 1.5 || values[2] != true || values[3] != "x" || values[5] != nil {
+			t.Errorf("unexpected values: %#v", values)
+		}
+		if b, ok := values[4].([]byte); !ok || !bytes.Equal(b, []byte{1, 2}) {
+			t.Errorf("have: %#v, but want: []byte{1, 2}", values[4])
+		}
+	})
+}
+
+func Test_Conn_DeallocateAll(t *testing.T) {
+	var server bytes.Buffer
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+	// CommandComplete and ReadyForQuery
+	server.Write([]byte{'C', 0, 0, 0, 19})
+	server.WriteString("DEALLOCATE ALL\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	stmt := newStatement(conn, "SELECT 1;", nil, false)
+	conn.statements[stmt] = true
+
+	client.Reset()
+	if err := conn.DeallocateAll(); err != nil {
+		t.Fatal("failed to deallocate:", err)
+	}
+
+	if !bytes.Contains(client.Bytes(), []byte("DEALLOCATE ALL;")) {
+		t.Errorf("DEALLOCATE ALL not sent, have: %q", client.Bytes())
+	}
+	if !stmt.IsClosed() {
+		t.Error("statement not marked closed")
+	}
+	if len(conn.statements) != 0 {
+		t.Errorf("have %d tracked statements, but want 0", len(conn.statements))
+	}
+}
+
+func Test_adjustCommandWithCasts(t *testing.T) {
+	casts := map[string]string{"@created_at": "timestamptz", "@tags": "text[]"}
+
+	params := []*Parameter{
+		NewParameter("@created_at", Custom),
+		NewCustomTypeParameter("@tags", "varchar[]"),
+		NewParameter("@id", Integer),
+	}
+
+	have := adjustCommandWithCasts("SELECT @created_at, @tags, @id;", params, casts)
+	if want := "SELECT $1::timestamptz, $2::varchar[], $3;"; have != want {
+		t.Errorf("have: '%s', but want: '%s'", have, want)
+	}
+}
+
+func Test_Conn_SetParameterCast(t *testing.T) {
+	conn := &Conn{}
+
+	conn.SetParameterCast("@created_at", "timestamptz")
+	if have := conn.ParameterCast("@created_at"); have != "timestamptz" {
+		t.Errorf("have: '%s', but want: 'timestamptz'", have)
+	}
+
+	conn.SetParameterCast("@created_at", "")
+	if have := conn.ParameterCast("@created_at"); have != "" {
+		t.Errorf("have: '%s', but want: ''", have)
+	}
+}
+
+func Test_Conn_TransactionIsReadOnly(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		if readOnly, err := conn.TransactionIsReadOnly(); err != nil || readOnly {
+			t.Errorf("outside transaction: have: %v, %v, but want: false, nil", readOnly, err)
+		}
+
+		err := conn.WithTransaction(ReadCommittedIsolation, func() error {
+			if _, err := conn.Execute("SET TRANSACTION READ ONLY;"); err != nil {
+				return err
+			}
+
+			for i := 0; i < 2; i++ {
+				if readOnly, err := conn.TransactionIsReadOnly(); err != nil || !readOnly {
+					t.Errorf("in transaction: have: %v, %v, but want: true, nil", readOnly, err)
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Error("transaction failed:", err)
+		}
+
+		if readOnly, err := conn.TransactionIsReadOnly(); err != nil || readOnly {
+			t.Errorf("after transaction: have: %v, %v, but want: false, nil", readOnly, err)
+		}
+	})
+}
+
+func Test_Conn_TransactionIsReadOnly_Cache(t *testing.T) {
+	var server bytes.Buffer
+	// AuthenticationOk and ReadyForQuery within a transaction block
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'T'})
+
+	writeShow := func(value string) {
+		// RowDescription with a single text field
+		server.Write([]byte{'T', 0, 0, 0, 46, 0, 1})
+		server.WriteString("transaction_read_only\x00")
+		server.Write([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 25, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0})
+		writeDataRow(&server, value)
+		server.Write([]byte{'C', 0, 0, 0, 9})
+		server.WriteString("SHOW\x00")
+		server.Write([]byte{'Z', 0, 0, 0, 5, 'T'})
+	}
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	writeShow("off")
+	for i := 0; i < 2; i++ {
+		if readOnly, err := conn.TransactionIsReadOnly(); err != nil || readOnly {
+			t.Errorf("before SET: have: %v, %v, but want: false, nil", readOnly, err)
+		}
+	}
+	if n := bytes.Count(client.Bytes(), []byte("SHOW transaction_read_only;")); n != 1 {
+		t.Errorf("have %d SHOW queries, but want 1", n)
+	}
+
+	// CommandComplete and ReadyForQuery, still within the transaction
+	server.Write([]byte{'C', 0, 0, 0, 8})
+	server.WriteString("SET\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'T'})
+	if _, err := conn.Execute("SET TRANSACTION READ ONLY;"); err != nil {
+		t.Fatal("failed to execute:", err)
+	}
+
+	writeShow("on")
+	if readOnly, err := conn.TransactionIsReadOnly(); err != nil || !readOnly {
+		t.Errorf("after SET: have: %v, %v, but want: true, nil", readOnly, err)
+	}
+	if server.Len() != 0 {
+		t.Errorf("%d bytes left unread", server.Len())
+	}
+}
+
+func Test_ResultSet_Vector(t *testing.T) {
+	rs := &ResultSet{
+		conn:          &Conn{},
+		hasCurrentRow: true,
+		fields:        []field{{name: "indkey", typeOID: _INT2VECTOROID}, {name: "empty", typeOID: _OIDVECTOROID}},
+		values:        [][]byte{[]byte("1 3"), []byte("")},
+	}
+
+	var indkey, empty []int
+	if err := rs.Scan(&indkey, &empty); err != nil {
+		t.Fatal("failed to scan:", err)
+	}
+
+	if len(indkey) != 2 || indkey[0] != 1 || indkey[1] != 3 {
+		t.Errorf("have: %v, but want: [1 3]", indkey)
+	}
+	if empty == nil || len(empty) != 0 {
+		t.Errorf("have: %#v, but want: []int{}", empty)
+	}
+}
+
+func Test_Statement_QueryArgs_WrongCount(t *testing.T) {
+	stmt := newStatement(&Conn{}, "SELECT @a, @b;", []*Parameter{NewParameter("@a", Integer), NewParameter("@b", Integer)}, true)
+
+	if _, err := stmt.QueryArgs(1); err == nil || !strings.Contains(err.Error(), "wrong argument count") {
+		t.Errorf("expected wrong argument count error, have: %v", err)
+	}
+}
+
+func Test_Statement_QueryArgs(t *testing.T) {
+	withStatement(t, "SELECT @a + @b;", []*Parameter{NewParameter("@a", Integer), NewParameter("@b", Integer)}, func(stmt *Statement) {
+		for _, args := range [][]interface{}{{1, 2}, {40, 2}} {
+			rs, err := stmt.QueryArgs(args...)
+			if err != nil {
+				t.Error("failed to query:", err)
+				return
+			}
+
+			var sum int
+			_, err = rs.ScanNext(&sum)
+			rs.Close()
+			if err != nil {
+				t.Error("failed to scan:", err)
+			} else if want := args[0].(int) + args[1].(int); sum != want {
+				t.Errorf("have: %d, but want: %d", sum, want)
+			}
+		}
+	})
+}
+
+func Test_ResultSet_FieldReader(t *testing.T) {
+	rs := &ResultSet{
+		conn:          &Conn{},
+		hasCurrentRow: true,
+		fields:        []field{{name: "t", typeOID: _TEXTOID}, {name: "b", typeOID: _BYTEAOID}, {name: "n", typeOID: _BYTEAOID}},
+		values:        [][]byte{[]byte("large text"), []byte(`\x01ff`), nil},
+	}
+
+	for ord, want := range [][]byte{[]byte("large text"), {1, 0xff}} {
+		r, isNull, err := rs.FieldReader(ord)
+		if err != nil || isNull {
+			t.Fatalf("field %d: unexpected result: %v, %v", ord, isNull, err)
+		}
+
+		have, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("field %d: failed to read: %v", ord, err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("field %d: have: %q, but want: %q", ord, have, want)
+		}
+	}
+
+	if r, isNull, err := rs.FieldReader(2); err != nil || !isNull || r != nil {
+		t.Errorf("null field: have: %v, %v, %v", r, isNull, err)
+	}
+}
+
+func Test_isTransientConnectError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, true},
+		{&Error{code: "57P03"}, true},
+		{&Error{code: "28P01"}, false},
+		{errors.New("server requested unsupported authentication method"), false},
+	}
+
+	for _, test := range tests {
+		if have := isTransientConnectError(test.err); have != test.want {
+			t.Errorf("%v: have: %v, but want: %v", test.err, have, test.want)
+		}
+	}
+}
+
+func Test_ConnectParams_Retry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopgsql")
+	if err != nil {
+		t.Fatal("failed to create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Start listening only after the first attempts have failed.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+
+		l, err := net.Listen("unix", dir+"/.s.PGSQL.5432")
+		if err != nil {
+			return
+		}
+		defer l.Close()
+
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+
+		buf := make([]byte, 1024)
+		c.Read(buf)
+
+		// AuthenticationOk and ReadyForQuery
+		c.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0, 'Z', 0, 0, 0, 5, 'I'})
+
+		c.Read(buf)
+	}()
+
+	params := &ConnParams{
+		Host:              dir,
+		User:              "testuser",
+		ConnectAttempts:   10,
+		ConnectRetryDelay: 20 * time.Millisecond,
+		ConnectTimeout:    5 * time.Second,
+	}
+
+	conn, err := ConnectParams(params, LogNothing)
+	if err != nil {
+		t.Fatal("failed to connect:", err)
+	}
+	conn.Close()
+
+	// Without retrying, the missing socket fails immediately.
+	os.Remove(dir + "/.s.PGSQL.5432")
+	params.ConnectAttempts = 0
+	if _, err := ConnectParams(params, LogNothing); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func Test_Conn_IsClosed(t *testing.T) {
+	var server bytes.Buffer
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+	// FATAL ErrorResponse
+	server.Write([]byte{'E', 0, 0, 0, 25})
+	server.WriteString("SFATAL\x00C57P01\x00Mbye\x00\x00")
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	if conn.IsClosed() {
+		t.Error("new connection reported closed")
+	}
+
+	if _, err := conn.Execute("SELECT 1;"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if !conn.IsClosed() {
+		t.Error("connection not reported closed after FATAL error")
+	}
+}
+
+func Test_NewConnFromNetConn(t *testing.T) {
+	client, server := net.Pipe()
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+
+		buf := make([]byte, 1024)
+		server.Read(buf)
+
+		// AuthenticationOk and ReadyForQuery
+		server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0, 'Z', 0, 0, 0, 5, 'I'})
+
+		// Terminate, then EOF after Close
+		server.Read(buf)
+		if _, err := server.Read(buf); err != io.EOF {
+			t.Errorf("have: %v, but want: EOF", err)
+		}
+	}()
+
+	conn, err := NewConnFromNetConn(client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	if err := conn.Reconnect(); err == nil {
+		t.Error("expected reconnect to fail")
+	}
+
+	conn.Close()
+	<-done
+}
+
+func Test_BinaryDateTimeDecoding(t *testing.T) {
+	intBytes := func(v ...interface{}) []byte {
+		buf := bytes.NewBuffer(nil)
+		for _, x := range v {
+			binary.Write(buf, binary.BigEndian, x)
+		}
+		return buf.Bytes()
+	}
+
+	want := time.Date(2000, 1, 1, 0, 0, 1, 500000000, time.UTC)
+	if have := decodeBinaryTimestamp(intBytes(int64(1500000)), true); !have.Equal(want) {
+		t.Errorf("integer timestamp: have: %v, but want: %v", have, want)
+	}
+	if have := decodeBinaryTimestamp(intBytes(1.5), false); !have.Equal(want) {
+		t.Errorf("float timestamp: have: %v, but want: %v", have, want)
+	}
+	want = time.Date(1999, 12, 31, 23, 59, 59, 0, time.UTC)
+	if have := decodeBinaryTimestamp(intBytes(int64(-1000000)), true); !have.Equal(want) {
+		t.Errorf("timestamp before epoch: have: %v, but want: %v", have, want)
+	}
+
+	if have, want := decodeBinaryDate(intBytes(int32(-1))), time.Date(1999, 12, 31, 0, 0, 0, 0, time.UTC); !have.Equal(want) {
+		t.Errorf("date: have: %v, but want: %v", have, want)
+	}
+
+	// 04:05:06.25+02, the zone is sent in seconds west of UTC.
+	tod := decodeBinaryTimeOfDay(intBytes(int64(((4*60+5)*60+6)*1000000+250000), int32(-7200)), true, true)
+	if want := (TimeOfDay{4, 5, 6, 250000, true, 7200}); tod != want {
+		t.Errorf("timetz: have: %+v, but want: %+v", tod, want)
+	}
+
+	interval := intBytes(float64((4*60+5)*60+6)+0.5, int32(3), int32(14))
+	if have, want := decodeBinaryInterval(interval, false), "1 year 2 mons 3 days 04:05:06.5"; have != want {
+		t.Errorf("interval: have: '%s', but want: '%s'", have, want)
+	}
+	if have := decodeBinaryInterval(intBytes(int64(0), int32(0), int32(0)), true); have != "00:00:00" {
+		t.Errorf("zero interval: have: '%s', but want: '00:00:00'", have)
+	}
+	if have, want := decodeBinaryInterval(intBytes(int64(-3600000000), int32(-1), int32(-13)), true), "-1 years -1 mons -1 days -01:00:00"; have != want {
+		t.Errorf("negative interval: have: '%s', but want: '%s'", have, want)
+	}
+}
+
+func Test_Conn_Abort(t *testing.T) {
+	var server bytes.Buffer
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+	// DataRow of the running query, then the error caused by the
+	// cancellation and ReadyForQuery within a failed transaction
+	server.Write([]byte{'D', 0, 0, 0, 11, 0, 1, 0, 0, 0, 1, '1'})
+	server.Write([]byte{'E', 0, 0, 0, 29})
+	server.WriteString("SERROR\x00C57014\x00Mcanceled\x00\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'E'})
+	// CommandComplete and ReadyForQuery for the ROLLBACK
+	server.Write([]byte{'C', 0, 0, 0, 13})
+	server.WriteString("ROLLBACK\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	canceled := make(chan bool, 1)
+	serve := func(c net.Conn) {
+		buf := make([]byte, 16)
+		if _, err := io.ReadFull(c, buf); err == nil {
+			canceled <- true
+		}
+	}
+
+	withFakeServer(t, serve, func(host string) {
+		// Cancel requires the server address, which streams don't have.
+		conn.dial = nil
+		conn.params.Host = host
+		conn.params.Port = 5432
+
+		conn.state = processingQueryState{}
+		conn.transactionStatus = InTransaction
+
+		client.Reset()
+		if err := conn.Abort(); err != nil {
+			t.Fatal("failed to abort:", err)
+		}
+	})
+
+	select {
+	case <-canceled:
+	default:
+		t.Error("no CancelRequest received")
+	}
+
+	if !bytes.Contains(client.Bytes(), []byte("ROLLBACK;")) {
+		t.Errorf("expected ROLLBACK, have sent: %q", client.Bytes())
+	}
+	if status := conn.Status(); status != StatusReady {
+		t.Errorf("have status: %v, but want: %v", status, StatusReady)
+	}
+	if status := conn.TransactionStatus(); status != NotInTransaction {
+		t.Errorf("have transaction status: %v, but want: %v", status, NotInTransaction)
+	}
+}
+
+func Test_ResultSet_Geometry(t *testing.T) {
+	rs := &ResultSet{
+		conn:          &Conn{},
+		hasCurrentRow: true,
+		fields: []field{
+			{name: "seg", typeOID: _LSEGOID},
+			{name: "open", typeOID: _PATHOID},
+			{name: "closed", typeOID: _PATHOID},
+			{name: "region", typeOID: _POLYGONOID},
+			{name: "area", typeOID: _CIRCLEOID},
+		},
+		values: [][]byte{
+			[]byte("[(1,2),(3,4.5)]"),
+			[]byte("[(0,0),(1,1)]"),
+			[]byte("((0,0),(1,1),(2,0))"),
+			[]byte("((0,0),(1,0),(0,-1e+20))"),
+			[]byte("<(1,2),3>"),
+		},
+	}
+
+	var seg LineSegment
+	var open, closed Path
+	var region Polygon
+	var area Circle
+	if err := rs.Scan(&seg, &open, &closed, &region, &area); err != nil {
+		t.Fatal("failed to scan:", err)
+	}
+
+	if want := (LineSegment{Point{1, 2}, Point{3, 4.5}}); seg != want {
+		t.Errorf("have: %+v, but want: %+v", seg, want)
+	}
+	if open.Closed || len(open.Points) != 2 {
+		t.Errorf("have open path: %+v", open)
+	}
+	if !closed.Closed || len(closed.Points) != 3 {
+		t.Errorf("have closed path: %+v", closed)
+	}
+	if len(region) != 3 || region[2] != (Point{0, -1e20}) {
+		t.Errorf("have polygon: %+v", region)
+	}
+	if want := (Circle{Point{1, 2}, 3}); area != want {
+		t.Errorf("have: %+v, but want: %+v", area, want)
+	}
+
+	for i, s := range []string{seg.String(), open.String(), closed.String(), region.String(), area.String()} {
+		if want := string(rs.values[i]); s != want {
+			t.Errorf("have: '%s', but want: '%s'", s, want)
+		}
+	}
+
+	if _, err := parseCircle("<(1,2)>"); err == nil {
+		t.Error("expected error for incomplete circle")
+	}
+}
+
+func Test_ResultSet_ScanStructs(t *testing.T) {
+	type user struct {
+		ID     int
+		Name   string `pgsql:"username"`
+		Secret string `pgsql:"-"`
+	}
+	type order struct {
+		ID     int
+		UserID int
+		Total  float64
+	}
+
+	rs := &ResultSet{
+		conn:          &Conn{},
+		hasCurrentRow: true,
+		fields: []field{
+			{name: "id", typeOID: _INT4OID, tableOID: 100},
+			{name: "username", typeOID: _TEXTOID, tableOID: 100},
+			{name: "id", typeOID: _INT4OID, tableOID: 200},
+			{name: "user_id", typeOID: _INT4OID, tableOID: 200},
+			{name: "count", typeOID: _INT8OID},
+			{name: "total", typeOID: _FLOAT8OID, tableOID: 200},
+		},
+		values: [][]byte{[]byte("1"), []byte("alice"), []byte("7"), []byte("1"), []byte("3"), []byte("9.5")},
+	}
+
+	var u user
+	var o order
+	if err := rs.ScanStructs(&u, &o); err != nil {
+		t.Fatal("failed to scan:", err)
+	}
+
+	if want := (user{ID: 1, Name: "alice"}); u != want {
+		t.Errorf("have: %+v, but want: %+v", u, want)
+	}
+	if want := (order{ID: 7, UserID: 1, Total: 9.5}); o != want {
+		t.Errorf("have: %+v, but want: %+v", o, want)
+	}
+
+	if err := rs.ScanStructs(&u); err == nil {
+		t.Error("expected error for wrong destination count")
+	}
+	if err := rs.ScanStructs(u, &o); err == nil {
+		t.Error("expected error for non-pointer destination")
+	}
+}
+
+func Test_Conn_EmptyStringAsNull(t *testing.T) {
+	var server bytes.Buffer
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	stmt := newStatement(conn, "SELECT @a, @b;", []*Parameter{param("@a", Varchar, ""), param("@b", Varchar, "x")}, false)
+
+	// Bind values: length -1 for NULL, 0 for an empty value.
+	for _, test := range []struct {
+		emptyStringAsNull bool
+		want              []byte
+	}{
+		{false, []byte{0, 2, 0, 0, 0, 0, 0, 0, 0, 1, 'x'}},
+		{true, []byte{0, 2, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 1, 'x'}},
+	} {
+		conn.SetEmptyStringAsNull(test.emptyStringAsNull)
+
+		client.Reset()
+		conn.writeBind(stmt)
+
+		if !bytes.Contains(client.Bytes(), test.want) {
+			t.Errorf("EmptyStringAsNull %t: have sent: %v", test.emptyStringAsNull, client.Bytes())
+		}
+	}
+}
+
+func Test_ResultSet_TID(t *testing.T) {
+	rs := &ResultSet{
+		conn:          &Conn{},
+		hasCurrentRow: true,
+		fields: []field{
+			{name: "ctid", typeOID: _TIDOID},
+			{name: "ctid", typeOID: _TIDOID, format: binaryFormat},
+		},
+		values: [][]byte{[]byte("(4294967295,7)"), {0, 0, 1, 0, 0, 2}},
+	}
+
+	var text, bin TID
+	if err := rs.Scan(&text, &bin); err != nil {
+		t.Fatal("failed to scan:", err)
+	}
+
+	if want := (TID{4294967295, 7}); text != want {
+		t.Errorf("have: %+v, but want: %+v", text, want)
+	}
+	if want := (TID{256, 2}); bin != want {
+		t.Errorf("have: %+v, but want: %+v", bin, want)
+	}
+	if s := text.String(); s != "(4294967295,7)" {
+		t.Errorf("have: '%s', but want: '(4294967295,7)'", s)
+	}
+
+	for _, s := range []string{"(1)", "1,2", "(1,65536)"} {
+		if _, err := parseTID(s); err == nil {
+			t.Errorf("expected error for '%s'", s)
+		}
+	}
+}
+
+func Test_Statement_BindStruct(t *testing.T) {
+	type user struct {
+		ID     int
+		Name   string `pgsql:"username"`
+		Secret string `pgsql:"-"`
+		Email  string
+	}
+
+	conn := &Conn{}
+	stmt := newStatement(conn, "INSERT INTO users (id, username) VALUES (@id, :username);",
+		[]*Parameter{NewParameter("@id", Integer), NewParameter(":username", Varchar)}, false)
+
+	if err := stmt.BindStruct(&user{ID: 3, Name: "bob", Email: "bob@example.com"}); err != nil {
+		t.Fatal("failed to bind:", err)
+	}
+
+	if v := stmt.Parameter("@id").Value(); fmt.Sprint(v) != "3" {
+		t.Errorf("have @id: %v, but want: 3", v)
+	}
+	if v := stmt.Parameter(":username").Value(); v != "bob" {
+		t.Errorf("have :username: %v, but want: bob", v)
+	}
+
+	stmt = newStatement(conn, "SELECT @secret;", []*Parameter{NewParameter("@secret", Varchar)}, false)
+	if err := stmt.BindStruct(user{}); err == nil {
+		t.Error("expected error for parameter without field")
+	}
+}
+
+func Test_LSN(t *testing.T) {
+	lsn, err := ParseLSN("16/B374D848")
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+	if lsn != 0x16B374D848 {
+		t.Errorf("have: %X, but want: 16B374D848", uint64(lsn))
+	}
+	if s := lsn.String(); s != "16/B374D848" {
+		t.Errorf("have: '%s', but want: '16/B374D848'", s)
+	}
+	if s, _ := formatParamValue(Custom, lsn); s != "16/B374D848" {
+		t.Errorf("have parameter value: '%s', but want: '16/B374D848'", s)
+	}
+
+	rs := &ResultSet{
+		conn:          &Conn{},
+		hasCurrentRow: true,
+		fields:        []field{{name: "replay_lsn", typeOID: _PG_LSNOID}},
+		values:        [][]byte{[]byte("0/3000060")},
+	}
+
+	var have LSN
+	if err := rs.Scan(&have); err != nil {
+		t.Fatal("failed to scan:", err)
+	}
+	if have != 0x3000060 || have >= lsn {
+		t.Errorf("have: %s", have)
+	}
+
+	for _, s := range []string{"16", "16/", "G/0", "100000000/0"} {
+		if _, err := ParseLSN(s); err == nil {
+			t.Errorf("expected error for '%s'", s)
+		}
+	}
+}
+
+func Test_Statement_QueryInSchema(t *testing.T) {
+	var server bytes.Buffer
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+	// set_config: ParseComplete, BindComplete, RowDescription, DataRow and
+	// CommandComplete
+	server.Write([]byte{'1', 0, 0, 0, 4, '2', 0, 0, 0, 4})
+	server.Write([]byte{'T', 0, 0, 0, 35, 0, 1})
+	server.WriteString("set_config\x00")
+	server.Write([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 25, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0})
+	server.Write([]byte{'D', 0, 0, 0, 18, 0, 1, 0, 0, 0, 8})
+	server.WriteString("tenant_1")
+	server.Write([]byte{'C', 0, 0, 0, 13})
+	server.WriteString("SELECT 1\x00")
+	// Statement: BindComplete, NoData, CommandComplete and ReadyForQuery
+	server.Write([]byte{'2', 0, 0, 0, 4, 'n', 0, 0, 0, 4})
+	server.Write([]byte{'C', 0, 0, 0, 13})
+	server.WriteString("DELETE 2\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	stmt := newStatement(conn, "DELETE FROM items;", nil, false)
+
+	client.Reset()
+	rs, err := stmt.QueryInSchema("tenant_1")
+	if err != nil {
+		t.Fatal("failed to query:", err)
+	}
+	if err := rs.Close(); err != nil {
+		t.Fatal("failed to close result set:", err)
+	}
+
+	if rs.rowsAffected != 2 {
+		t.Errorf("have rows affected: %d, but want: 2", rs.rowsAffected)
+	}
+
+	sent := client.Bytes()
+	if !bytes.Contains(sent, []byte("set_config('search_path', $1, true)")) || !bytes.Contains(sent, []byte("tenant_1")) {
+		t.Errorf("expected set_config, have sent: %q", sent)
+	}
+	sync := []byte{'S', 0, 0, 0, 4}
+	if bytes.Count(sent, sync) != 1 || bytes.Index(sent, sync) < bytes.LastIndex(sent, []byte("prtl0")) {
+		t.Errorf("expected a single Sync after the statement, have sent: %q", sent)
+	}
+	if status := conn.Status(); status != StatusReady {
+		t.Errorf("have status: %v, but want: %v", status, StatusReady)
+	}
+}
+
+func Test_Statement_QueryInSchema_Unnamed(t *testing.T) {
+	var server bytes.Buffer
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+	// PrepareUnnamed: ParseComplete, ParameterDescription and NoData
+	server.Write([]byte{'1', 0, 0, 0, 4, 't', 0, 0, 0, 6, 0, 0, 'n', 0, 0, 0, 4})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	stmt, err := conn.PrepareUnnamed("DELETE FROM items;")
+	if err != nil {
+		t.Fatal("failed to prepare:", err)
+	}
+
+	// set_config: ParseComplete, BindComplete, RowDescription, DataRow and
+	// CommandComplete
+	server.Write([]byte{'1', 0, 0, 0, 4, '2', 0, 0, 0, 4})
+	server.Write([]byte{'T', 0, 0, 0, 35, 0, 1})
+	server.WriteString("set_config\x00")
+	server.Write([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 25, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0})
+	server.Write([]byte{'D', 0, 0, 0, 18, 0, 1, 0, 0, 0, 8})
+	server.WriteString("tenant_1")
+	server.Write([]byte{'C', 0, 0, 0, 13})
+	server.WriteString("SELECT 1\x00")
+	// Statement: ParseComplete, BindComplete, NoData, CommandComplete and
+	// ReadyForQuery
+	server.Write([]byte{'1', 0, 0, 0, 4, '2', 0, 0, 0, 4, 'n', 0, 0, 0, 4})
+	server.Write([]byte{'C', 0, 0, 0, 13})
+	server.WriteString("DELETE 2\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	client.Reset()
+	rs, err := stmt.QueryInSchema("tenant_1")
+	if err != nil {
+		t.Fatal("failed to query:", err)
+	}
+	if err := rs.Close(); err != nil {
+		t.Fatal("failed to close result set:", err)
+	}
+
+	if rs.rowsAffected != 2 {
+		t.Errorf("have rows affected: %d, but want: 2", rs.rowsAffected)
+	}
+
+	sent := client.Bytes()
+	if i, j := bytes.Index(sent, []byte("set_config")), bytes.Index(sent, []byte("DELETE FROM items;")); i == -1 || j < i {
+		t.Errorf("expected the statement to be parsed again after set_config, have sent: %q", sent)
+	}
+	if stmt.reparse {
+		t.Error("reparse still set")
+	}
+	if server.Len() != 0 {
+		t.Errorf("%d bytes left unread", server.Len())
+	}
+}
+
+func Test_Conn_SetShareStatements(t *testing.T) {
+	var server bytes.Buffer
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+	// ParseComplete, ParameterDescription and NoData, for one Prepare only
+	server.Write([]byte{'1', 0, 0, 0, 4, 't', 0, 0, 0, 6, 0, 0, 'n', 0, 0, 0, 4})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	conn.SetShareStatements(true)
+
+	client.Reset()
+	stmt1, err := conn.Prepare("DELETE FROM items;")
+	if err != nil {
+		t.Fatal("failed to prepare statement 1:", err)
+	}
+	stmt2, err := conn.Prepare("DELETE FROM items;")
+	if err != nil {
+		t.Fatal("failed to prepare statement 2:", err)
+	}
+
+	if n := bytes.Count(client.Bytes(), []byte("DELETE FROM items;")); n != 1 {
+		t.Errorf("have %d Parse messages, but want 1", n)
+	}
+	if stmt1.Name() != stmt2.Name() {
+		t.Errorf("have names '%s' and '%s', but want them to be equal", stmt1.Name(), stmt2.Name())
+	}
+	if stmt1.PortalName() == stmt2.PortalName() {
+		t.Error("expected distinct portals")
+	}
+
+	closeMsg := append([]byte{'C', 0, 0, 0, byte(6 + len(stmt1.Name())), 'S'}, stmt1.Name()...)
+
+	client.Reset()
+	stmt1.Close()
+	stmt1.Close()
+	if bytes.Contains(client.Bytes(), closeMsg) {
+		t.Error("expected no Close while the statement is still shared")
+	}
+
+	stmt2.Close()
+	if !bytes.Contains(client.Bytes(), closeMsg) {
+		t.Errorf("expected Close after the last statement, have sent: %q", client.Bytes())
+	}
+}
+
+func Test_ResultSet_ScalarOID(t *testing.T) {
+	rs := &ResultSet{conn: &Conn{}, fields: []field{{name: "count", typeOID: _INT8OID}}}
+
+	if oid, err := rs.ScalarOID(); err != nil || oid != _INT8OID {
+		t.Errorf("have: %d, %v, but want: %d", oid, err, _INT8OID)
+	}
+
+	rs.fields = append(rs.fields, field{name: "name", typeOID: _TEXTOID})
+	if _, err := rs.ScalarOID(); err == nil {
+		t.Error("expected error for two fields")
+	}
+}
+
+func Test_Conn_CopyFromRows(t *testing.T) {
+	var server bytes.Buffer
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+	// CopyInResponse for two text columns
+	server.Write([]byte{'G', 0, 0, 0, 11, 0, 0, 2, 0, 0, 0, 0})
+	// CommandComplete and ReadyForQuery
+	server.Write([]byte{'C', 0, 0, 0, 11})
+	server.WriteString("COPY 2\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	rows := make(chan []interface{}, 2)
+	rows <- []interface{}{1, "tab\there\nback\\slash"}
+	rows <- []interface{}{2, nil}
+	close(rows)
+
+	client.Reset()
+	n, err := conn.CopyFromRows("items", []string{"id", "note"}, rows)
+	if err != nil {
+		t.Fatal("failed to copy:", err)
+	}
+	if n != 2 {
+		t.Errorf("have %d rows affected, but want 2", n)
+	}
+
+	sent := client.Bytes()
+	if !bytes.Contains(sent, []byte("COPY items (id, note) FROM STDIN;")) {
+		t.Errorf("expected COPY command, have sent: %q", sent)
+	}
+	if want := "1\ttab\\there\\nback\\\\slash\n2\t\\N\n"; !bytes.Contains(sent, []byte(want)) {
+		t.Errorf("expected data %q, have sent: %q", want, sent)
+	}
+	if status := conn.Status(); status != StatusReady {
+		t.Errorf("have status: %v, but want: %v", status, StatusReady)
+	}
+}
+
+func Test_Connect_UnexpectedStartupResponse(t *testing.T) {
+	for _, response := range []string{
+		"HTTP/1.1 400 Bad Request\r\n\r\n",
+		// Protocol 2.0 ErrorResponse without length
+		"EFATAL:  unsupported frontend protocol\n\x00",
+		"R",
+	} {
+		server := bytes.NewBufferString(response)
+		var client bytes.Buffer
+
+		_, err := NewConnFromStreams(server, &client, &ConnParams{User: "testuser"}, LogNothing)
+		if err == nil || !strings.Contains(err.Error(), "not a PostgreSQL server") {
+			t.Errorf("%q: have error: %v", response, err)
+		}
+	}
+}
+
+func Test_Connect_NegotiateProtocolVersion(t *testing.T) {
+	var server bytes.Buffer
+	// NegotiateProtocolVersion with newest minor version 0 and one
+	// unsupported option
+	server.Write([]byte{'v', 0, 0, 0, 21, 0, 0, 0, 0, 0, 0, 0, 1})
+	server.WriteString("_pq_.foo\x00")
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	if _, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing); err != nil {
+		t.Error("failed to connect:", err)
+	}
+}
+
+func Test_ConnParams_TransactionPooling(t *testing.T) {
+	var server bytes.Buffer
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+	// Prepare: ParseComplete, ParameterDescription and NoData
+	server.Write([]byte{'1', 0, 0, 0, 4, 't', 0, 0, 0, 6, 0, 0, 'n', 0, 0, 0, 4})
+	// Execute: ParseComplete, BindComplete, NoData, CommandComplete and
+	// ReadyForQuery
+	server.Write([]byte{'1', 0, 0, 0, 4, '2', 0, 0, 0, 4, 'n', 0, 0, 0, 4})
+	server.Write([]byte{'C', 0, 0, 0, 13})
+	server.WriteString("DELETE 1\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser", TransactionPooling: true}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	client.Reset()
+	stmt, err := conn.Prepare("DELETE FROM items;")
+	if err != nil {
+		t.Fatal("failed to prepare:", err)
+	}
+	if stmt.Name() != "" {
+		t.Errorf("have statement name '%s', but want the unnamed statement", stmt.Name())
+	}
+
+	n, err := stmt.Execute()
+	if err != nil {
+		t.Fatal("failed to execute:", err)
+	}
+	if n != 1 {
+		t.Errorf("have %d rows affected, but want 1", n)
+	}
+
+	if n := bytes.Count(client.Bytes(), []byte("\x00DELETE FROM items;")); n != 2 {
+		t.Errorf("have %d Parse messages, but want 2", n)
+	}
+
+	if err := conn.SetDefaultTransactionIsolation("SERIALIZABLE"); err == nil {
+		t.Error("expected error for session-level setting")
+	}
+}
+
+func Test_ConnParams_TCPNoDelay(t *testing.T) {
+	tests := []struct {
+		connStr string
+		disable bool
+	}{
+		{"user=testuser", false},
+		{"user=testuser tcp_nodelay=true", false},
+		{"user=testuser tcp_nodelay=false", true},
+	}
+
+	for _, test := range tests {
+		params := (&Conn{}).parseParams(test.connStr)
+
+		if params.DisableTCPNoDelay != test.disable {
+			t.Errorf("%q: expected DisableTCPNoDelay: %t, have: %t", test.connStr, test.disable, params.DisableTCPNoDelay)
+		}
+	}
+}
+
+func Test_Statement_SetAutoClose(t *testing.T) {
+	var server bytes.Buffer
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+	// Prepare: ParseComplete, ParameterDescription and NoData
+	server.Write([]byte{'1', 0, 0, 0, 4, 't', 0, 0, 0, 6, 0, 0, 'n', 0, 0, 0, 4})
+	// Execute: BindComplete, NoData, CommandComplete and ReadyForQuery
+	server.Write([]byte{'2', 0, 0, 0, 4, 'n', 0, 0, 0, 4})
+	server.Write([]byte{'C', 0, 0, 0, 13})
+	server.WriteString("DELETE 1\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	stmt, err := conn.Prepare("DELETE FROM items;")
+	if err != nil {
+		t.Fatal("failed to prepare:", err)
+	}
+	stmt.SetAutoClose(true)
+
+	client.Reset()
+	if _, err := stmt.Execute(); err != nil {
+		t.Fatal("failed to execute:", err)
+	}
+
+	if !stmt.IsClosed() {
+		t.Error("expected statement to be closed")
+	}
+	closeMsg := append([]byte{'C', 0, 0, 0, byte(6 + len(stmt.Name())), 'S'}, stmt.Name()...)
+	if !bytes.Contains(client.Bytes(), closeMsg) {
+		t.Errorf("expected Close, have sent: %q", client.Bytes())
+	}
+}
+
+func Test_Conn_ExecuteScript(t *testing.T) {
+	var server bytes.Buffer
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+	// CommandComplete for each command, a result with a single row in
+	// between, and ReadyForQuery
+	server.Write([]byte{'C', 0, 0, 0, 17})
+	server.WriteString("CREATE TABLE\x00")
+	server.Write([]byte{'C', 0, 0, 0, 15})
+	server.WriteString("INSERT 0 2\x00")
+	server.Write([]byte{'T', 0, 0, 0, 29, 0, 1})
+	server.WriteString("id\x00")
+	server.Write([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 23, 0, 4, 0xff, 0xff, 0xff, 0xff, 0, 0})
+	server.Write([]byte{'D', 0, 0, 0, 11, 0, 1, 0, 0, 0, 1, '1'})
+	server.Write([]byte{'C', 0, 0, 0, 13})
+	server.WriteString("SELECT 1\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	results, err := conn.ExecuteScript("CREATE TABLE t (id int); INSERT INTO t VALUES (1), (2); SELECT id FROM t LIMIT 1;")
+	if err != nil {
+		t.Fatal("failed to execute script:", err)
+	}
+
+	want := []CommandResult{{"CREATE TABLE", 0}, {"INSERT 0 2", 2}, {"SELECT 1", 1}}
+	if len(results) != len(want) {
+		t.Fatalf("have results: %v, but want: %v", results, want)
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("have result %d: %v, but want: %v", i, results[i], want[i])
+		}
+	}
+}
+
+func Test_ResultSet_Range(t *testing.T) {
+	conn := &Conn{runtimeParameters: map[string]string{"DateStyle": "ISO, MDY"}}
+	conn.updateTimeFormats()
+
+	rs := &ResultSet{
+		conn:          conn,
+		hasCurrentRow: true,
+		fields: []field{
+			{name: "seats", typeOID: _INT4RANGEOID},
+			{name: "nothing", typeOID: _INT8RANGEOID},
+			{name: "open", typeOID: _INT4RANGEOID},
+			{name: "slot", typeOID: _TSTZRANGEOID},
+		},
+		values: [][]byte{
+			[]byte("[1,10)"),
+			[]byte("empty"),
+			[]byte("(,5]"),
+			[]byte(`["2013-04-05 06:00:00+00","2013-04-05 07:30:00+00")`),
+		},
+	}
+
+	var seats, nothing, open, slot Range
+	if err := rs.Scan(&seats, &nothing, &open, &slot); err != nil {
+		t.Fatal("failed to scan:", err)
+	}
+
+	if want := (Range{1, 10, true, false, false}); seats != want {
+		t.Errorf("have: %+v, but want: %+v", seats, want)
+	}
+	if !nothing.Empty || nothing.String() != "empty" {
+		t.Errorf("have: %+v, but want the empty range", nothing)
+	}
+	if want := (Range{nil, 5, false, true, false}); open != want {
+		t.Errorf("have: %+v, but want: %+v", open, want)
+	}
+	if lower, ok := slot.Lower.(time.Time); !ok || !lower.Equal(time.Date(2013, 4, 5, 6, 0, 0, 0, time.UTC)) {
+		t.Errorf("have lower bound: %v", slot.Lower)
+	}
+	if upper, ok := slot.Upper.(time.Time); !ok || !upper.Equal(time.Date(2013, 4, 5, 7, 30, 0, 0, time.UTC)) {
+		t.Errorf("have upper bound: %v", slot.Upper)
+	}
+
+	if s := seats.String(); s != `["1","10")` {
+		t.Errorf(`have: '%s', but want: '["1","10")'`, s)
+	}
+	if s := open.String(); s != `(,"5"]` {
+		t.Errorf(`have: '%s', but want: '(,"5"]'`, s)
+	}
+
+	for _, s := range []string{"[1,10", "[1)", `["1,10)`} {
+		rs.values[0] = []byte(s)
+		if _, _, err := rs.Range(0); err == nil {
+			t.Errorf("expected error for '%s'", s)
+		}
+	}
+}
+
+func Test_Error_OriginalPosition(t *testing.T) {
+	command := "SELECT 'ä', @name::text || @id, @name FROM foo WHERE bar = @id;"
+	params := []*Parameter{NewParameter("@id", Integer), NewCustomTypeParameter("@name", "varchar")}
+
+	stmt := newStatement(&Conn{}, command, params, true)
+	stmt.adjustCommand(nil)
+
+	if want := "SELECT 'ä', $2::varchar::text || $1, $2::varchar FROM foo WHERE bar = $1;"; stmt.actualCommand != want {
+		t.Fatalf("actual command: have: %s, but want: %s", stmt.actualCommand, want)
+	}
+
+	// Positions are 1-based character indexes.
+	position := func(s, sub string) int {
+		return utf8.RuneCountInString(s[:strings.Index(s, sub)]) + 1
+	}
+
+	tests := []struct {
+		actual, original string
+	}{
+		{"SELECT", "SELECT"},
+		{"::text", "::text"},
+		{"$1,", "@id,"},
+		{"1, $2", "@id, @name"},
+		{"FROM", "FROM"},
+		{"= $1", "= @id"},
+		{";", ";"},
+	}
+
+	for _, test := range tests {
+		e := &Error{position: strconv.Itoa(position(stmt.actualCommand, test.actual))}
+		if have, want := e.OriginalPosition(stmt), position(command, test.original); have != want {
+			t.Errorf("'%s': have: %d, but want: %d", test.actual, have, want)
+		}
+	}
+
+	if have := (&Error{}).OriginalPosition(stmt); have != 0 {
+		t.Errorf("no position: have: %d, but want: 0", have)
+	}
+}
+
+func Test_writeBind_CustomTimeType(t *testing.T) {
+	var server bytes.Buffer
+
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	at := time.Date(2013, 4, 5, 6, 7, 8, 0, time.FixedZone("", 2*60*60))
+
+	for _, test := range []struct {
+		customTypeName string
+		want           string
+	}{
+		{"date", "2013-04-05"},
+		{"timestamp", "2013-04-05 06:07:08"},
+		{"TIMESTAMPTZ", "2013-04-05 06:07:08+02:00"},
+		{"timestamp with time zone", "2013-04-05 06:07:08+02:00"},
+	} {
+		p := NewCustomTypeParameter("@at", test.customTypeName)
+		p.SetValue(at)
+
+		stmt := newStatement(conn, "SELECT @at;", []*Parameter{p}, true)
+
+		client.Reset()
+		conn.writeBind(stmt)
+
+		want := append([]byte{0, 0, 0, byte(len(test.want))}, test.want...)
+		if !bytes.Contains(client.Bytes(), want) {
+			t.Errorf("%s: have sent: %q", test.customTypeName, client.Bytes())
+		}
+	}
+}
+
+func Test_parameterNames(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"SELECT 1;", nil},
+		{"SELECT @a, :b, @a;", []string{"@a", ":b"}},
+		{"SELECT * FROM t WHERE x = @x AND y = ANY(@ys);", []string{"@x", "@ys"}},
+		{"SELECT @filter::jsonb, (1)::int, x->>'@no';", []string{"@filter"}},
+		{"SELECT '@no', \"@no\" /* @no */, @yes;", []string{"@yes"}},
+	}
+
+	for _, test := range tests {
+		if have := parameterNames(test.command); fmt.Sprint(have) != fmt.Sprint(test.want) {
+			t.Errorf("'%s': have: %v, but want: %v", test.command, have, test.want)
+		}
+	}
+}
+
+func Test_Conn_ClosedMidMessage(t *testing.T) {
+	var server bytes.Buffer
+
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	// CommandComplete, cut off after 3 bytes of the tag.
+	server.Write([]byte{'C', 0, 0, 0, 13, 'S', 'E', 'L'})
+
+	if _, err := conn.Execute("SELECT 1;"); err != errConnClosedMidMessage {
+		t.Errorf("have: %v, but want: %v", err, errConnClosedMidMessage)
+	}
+	if status := conn.Status(); status != StatusDisconnected {
+		t.Errorf("status: have: %s, but want: %s", status, StatusDisconnected)
+	}
+}
+
+func Test_Statement_ParametersInOrder(t *testing.T) {
+	params := []*Parameter{NewParameter("@c", Integer), NewParameter("@a", Integer), NewParameter("@b", Integer)}
+
+	stmt := newStatement(&Conn{}, "SELECT @a, @b, @a, @c;", params, true)
+	stmt.adjustCommand(nil)
+
+	var names []string
+	for _, p := range stmt.ParametersInOrder() {
+		names = append(names, p.Name())
+	}
+
+	if have, want := strings.Join(names, ", "), "@a, @b, @c"; have != want {
+		t.Errorf("have: %s, but want: %s", have, want)
+	}
+}
+
+func Test_ResultSet_BigInt(t *testing.T) {
+	rs := &ResultSet{
+		conn:          &Conn{},
+		hasCurrentRow: true,
+		fields: []field{
+			{name: "a", typeOID: _NUMERICOID},
+			{name: "b", typeOID: _NUMERICOID},
+			{name: "c", typeOID: _INT8OID, format: binaryFormat},
+		},
+		values: [][]byte{[]byte("123456789012345678901234567890"), []byte("-42.000"), {0, 0, 0, 0, 0, 0, 1, 0}},
+	}
+
+	var a, b, c *big.Int
+	if err := rs.Scan(&a, &b, &c); err != nil {
+		t.Fatal("failed to scan:", err)
+	}
+
+	for _, test := range []struct {
+		have *big.Int
+		want string
+	}{
+		{a, "123456789012345678901234567890"},
+		{b, "-42"},
+		{c, "256"},
+	} {
+		if test.have.String() != test.want {
+			t.Errorf("have: %s, but want: %s", test.have, test.want)
+		}
+	}
+
+	rs.values[1] = []byte("1.5")
+	if _, _, err := rs.BigInt(1); err == nil {
+		t.Error("expected error for a fractional value")
+	}
+
+	p := NewParameter("@n", Numeric)
+	if err := p.SetValue(a); err != nil {
+		t.Fatal("SetValue failed:", err)
+	}
+	if s, _ := formatParamValue(p.Type(), p.Value()); s != "123456789012345678901234567890" {
+		t.Errorf("formatted: have: %s", s)
+	}
+}
+
+func Test_Conn_Activity(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		withConn(t, func(observer *Conn) {
+			a, found, err := observer.Activity(conn.BackendPID())
+			if err != nil {
+				t.Fatal("Activity failed:", err)
+			}
+			if !found {
+				t.Fatal("backend not found")
+			}
+			if a.State != "idle" {
+				t.Errorf("state: have: %s, but want: idle", a.State)
+			}
+			if a.WaitEvent != "ClientRead" {
+				t.Errorf("wait event: have: %s, but want: ClientRead", a.WaitEvent)
+			}
+		})
+	})
+}
+
+func Test_Conn_Close_ServerGone(t *testing.T) {
+	client, server := net.Pipe()
+
+	go func() {
+		buf := make([]byte, 1024)
+		server.Read(buf)
+
+		// AuthenticationOk and ReadyForQuery
+		server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0, 'Z', 0, 0, 0, 5, 'I'})
+
+		server.Close()
+	}()
+
+	conn, err := NewConnFromNetConn(client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	if err := conn.Close(); err == nil {
+		t.Error("expected error sending Terminate")
+	}
+	if !conn.IsClosed() {
+		t.Error("connection not reported closed")
+	}
+}
+
+func Test_quoteIdentifier(t *testing.T) {
+	for _, test := range []struct{ name, want string }{
+		{"<unnamed portal 1>", `"<unnamed portal 1>"`},
+		{`a"b`, `"a""b"`},
+	} {
+		if have := quoteIdentifier(test.name); have != test.want {
+			t.Errorf("have: %s, but want: %s", have, test.want)
+		}
+	}
+}
+
+func Test_Conn_FetchCursor(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		conn.Execute(`CREATE FUNCTION pg_temp.two_cursors() RETURNS SETOF refcursor AS $$
+DECLARE
+	a refcursor;
+	b refcursor := 'Cursor B';
+BEGIN
+	OPEN a FOR SELECT 1;
+	RETURN NEXT a;
+	OPEN b FOR SELECT 2 UNION ALL SELECT 3;
+	RETURN NEXT b;
+END;
+$$ LANGUAGE plpgsql;`)
+
+		if _, err := conn.Execute("BEGIN;"); err != nil {
+			t.Fatal("BEGIN failed:", err)
+		}
+		defer conn.Execute("ROLLBACK;")
+
+		rs, err := conn.Query("SELECT pg_temp.two_cursors();")
+		if err != nil {
+			t.Fatal("failed to query:", err)
+		}
+
+		var names []string
+		for {
+			var name string
+			fetched, err := rs.ScanNext(&name)
+			if err != nil {
+				t.Fatal("failed to scan:", err)
+			}
+			if !fetched {
+				break
+			}
+			names = append(names, name)
+		}
+		rs.Close()
+
+		var sums []int
+		for _, name := range names {
+			rs, err := conn.FetchCursor(name)
+			if err != nil {
+				t.Fatal("FetchCursor failed:", err)
+			}
+
+			sum := 0
+			for {
+				var i int
+				fetched, err := rs.ScanNext(&i)
+				if err != nil {
+					t.Fatal("failed to scan:", err)
+				}
+				if !fetched {
+					break
+				}
+				sum += i
+			}
+			rs.Close()
+
+			sums = append(sums, sum)
+		}
+
+		if fmt.Sprint(sums) != "[1 5]" {
+			t.Errorf("have: %v, but want: [1 5]", sums)
+		}
+	})
+}
+
+func Test_Statement_Bind(t *testing.T) {
+	var server bytes.Buffer
+
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	stmt := newStatement(conn, "SELECT @a, @b;", []*Parameter{NewParameter("@a", Integer), NewParameter("@b", Integer)}, true)
+	stmt.adjustCommand(nil)
+
+	if err := stmt.Bind("@a", 1); err != nil {
+		t.Error("failed to bind @a:", err)
+	}
+	if err := stmt.Bind("@c", 2); err == nil || !strings.Contains(err.Error(), "@c") {
+		t.Errorf("expected error naming @c, have: %v", err)
+	}
+
+	client.Reset()
+	if _, err := stmt.Query(); err == nil || !strings.Contains(err.Error(), "@b") {
+		t.Errorf("expected error naming @b, have: %v", err)
+	}
+	if client.Len() != 0 {
+		t.Errorf("have sent: %v", client.Bytes())
+	}
+
+	// NULL must be set explicitly.
+	if err := stmt.Bind("@b", nil); err != nil {
+		t.Error("failed to bind @b:", err)
+	}
+	if !stmt.Parameter("@b").IsSet() {
+		t.Error("@b not reported set")
+	}
+}
+
+func Test_Conn_SetRowCountObserver(t *testing.T) {
+	var server bytes.Buffer
+
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	// RowDescription with a single int4 field "x", two DataRows,
+	// CommandComplete and ReadyForQuery
+	server.Write([]byte{'T', 0, 0, 0, 26, 0, 1, 'x', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 23, 0, 4, 0xff, 0xff, 0xff, 0xff, 0, 0})
+	server.Write([]byte{'D', 0, 0, 0, 11, 0, 1, 0, 0, 0, 1, '1'})
+	server.Write([]byte{'D', 0, 0, 0, 11, 0, 1, 0, 0, 0, 1, '2'})
+	server.Write([]byte{'C', 0, 0, 0, 13})
+	server.WriteString("SELECT 2\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	// CommandComplete and ReadyForQuery
+	server.Write([]byte{'C', 0, 0, 0, 13})
+	server.WriteString("DELETE 7\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	var reports []string
+	conn.SetRowCountObserver(func(command string, rows int64) {
+		reports = append(reports, fmt.Sprintf("%s %d", command, rows))
+	})
+
+	// Close without fetching, the rows are counted anyway.
+	rs, err := conn.Query("SELECT x FROM t;")
+	if err != nil {
+		t.Fatal("failed to query:", err)
+	}
+	rs.Close()
+	rs.Close()
+
+	if _, err := conn.Execute("DELETE FROM t;"); err != nil {
+		t.Fatal("failed to execute:", err)
+	}
+
+	if have, want := strings.Join(reports, ", "), "SELECT x FROM t; 2, DELETE FROM t; 7"; have != want {
+		t.Errorf("have: %s, but want: %s", have, want)
+	}
+}
+
+func Test_adjustCommand_JsonbOperators(t *testing.T) {
+	params := []*Parameter{NewParameter("@key", Text), NewCustomTypeParameter("@keys", "text[]"), NewCustomTypeParameter("@path", "jsonpath")}
+
+	command := "SELECT data ? @key, data ?| @keys, data?&@keys, data @? @path, data @@ @path, data @> '{}';"
+	want := "SELECT data ? $1, data ?| $2::text[], data?&$2::text[], data @? $3::jsonpath, data @@ $3::jsonpath, data @> '{}';"
+
+	if have := adjustCommand(command, params); have != want {
+		t.Errorf("have: %s, but want: %s", have, want)
+	}
+	if have := parameterNames(command); fmt.Sprint(have) != "[@key @keys @path]" {
+		t.Errorf("parameter names: have: %v", have)
+	}
+}
+
+func Test_formatParamValue_Slice(t *testing.T) {
+	tests := []struct {
+		typ    Type
+		value  interface{}
+		want   string
+		isNull bool
+	}{
+		{Custom, []string{"a", `b"c`, `d\e`}, `{"a","b\"c","d\\e"}`, false},
+		{Custom, []int{1, 2}, `{"1","2"}`, false},
+		{Custom, []interface{}{"a", nil}, `{"a",NULL}`, false},
+		{Custom, []string{}, `{}`, false},
+		{Custom, []string(nil), "", true},
+		{Type(_DATEARRAYOID), []time.Time{time.Date(2013, 1, 2, 3, 4, 5, 0, time.UTC)}, `{"2013-01-02"}`, false},
+	}
+
+	for _, test := range tests {
+		s, isNull := formatParamValue(test.typ, test.value)
+		if s != test.want || isNull != test.isNull {
+			t.Errorf("%#v: have: '%s' (null: %t), but want: '%s' (null: %t)", test.value, s, isNull, test.want, test.isNull)
+		}
+	}
+}
+
+func Test_JsonbOperators(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		key := NewParameter("@key", Text)
+		key.SetValue("a")
+		keys := NewCustomTypeParameter("@keys", "text[]")
+		keys.SetValue([]string{"a", "c"})
+
+		rs, err := conn.Query(`SELECT data ? @key, data ?| @keys, data ?& @keys FROM (SELECT '{"a": 1, "b": 2}'::jsonb AS data) t;`, key, keys)
+		if err != nil {
+			t.Fatal("failed to query:", err)
+		}
+		defer rs.Close()
+
+		var exists, any, all bool
+		if _, err := rs.ScanNext(&exists, &any, &all); err != nil {
+			t.Fatal("failed to scan:", err)
+		}
+
+		if !exists || !any || all {
+			t.Errorf("have: %t, %t, %t, but want: true, true, false", exists, any, all)
+		}
+	})
+}
+
+// writeDataRow writes a DataRow message with the specified text values to
+// buf, "NULL" stands for NULL.
+func writeDataRow(buf *bytes.Buffer, values ...string) {
+	var body bytes.Buffer
+	binary.Write(&body, binary.BigEndian, int16(len(values)))
+	for _, v := range values {
+		if v == "NULL" {
+			binary.Write(&body, binary.BigEndian, int32(-1))
+			continue
+		}
+		binary.Write(&body, binary.BigEndian, int32(len(v)))
+		body.WriteString(v)
+	}
+
+	buf.WriteByte('D')
+	binary.Write(buf, binary.BigEndian, int32(4+body.Len()))
+	buf.Write(body.Bytes())
+}
+
+func Test_ResultSet_WriteJSONLines(t *testing.T) {
+	var server bytes.Buffer
+
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	writeDataRow(&server, "t", "42", "1.50", `a"b`, `{"x": [1]}`, "{1,NULL}", `\xdeadbeef`, "{1.5,2}")
+	writeDataRow(&server, "f", "NULL", "NaN", "", "null", "{}", `\x`, "{}")
+
+	// CommandComplete and ReadyForQuery
+	server.Write([]byte{'C', 0, 0, 0, 13})
+	server.WriteString("SELECT 2\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	rs := newResultSet(conn)
+	rs.fields = []field{
+		{name: "b", typeOID: _BOOLOID},
+		{name: "i", typeOID: _INT4OID},
+		{name: "n", typeOID: _NUMERICOID},
+		{name: "s", typeOID: _TEXTOID},
+		{name: "j", typeOID: _JSONBOID},
+		{name: "a", typeOID: _INT4ARRAYOID},
+		{name: "bin", typeOID: _BYTEAOID},
+		{name: "ns", typeOID: _NUMERICARRAYOID},
+	}
+	rs.values = make([][]byte, len(rs.fields))
+	conn.state = processingQueryState{}
+
+	var out bytes.Buffer
+	rows, err := rs.WriteJSONLines(&out)
+	if err != nil {
+		t.Fatal("WriteJSONLines failed:", err)
+	}
+
+	want := `{"b":true,"i":42,"n":1.50,"s":"a\"b","j":{"x":[1]},"a":[1,null],"bin":"\\xdeadbeef","ns":[1.5,2]}
+{"b":false,"i":null,"n":"NaN","s":"","j":null,"a":[],"bin":"\\x","ns":[]}
+`
+	if rows != 2 || out.String() != want {
+		t.Errorf("have %d rows:\n%s\nbut want 2 rows:\n%s", rows, out.String(), want)
+	}
+	if status := conn.Status(); status != StatusReady {
+		t.Errorf("status: have: %s, but want: %s", status, StatusReady)
+	}
+}
+
+func Test_ResultSet_ScanAll(t *testing.T) {
+	var server bytes.Buffer
+
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	type user struct {
+		ID   int
+		Name string `pgsql:"user_name"`
+	}
+
+	writeDataRow(&server, "1", "alice")
+	writeDataRow(&server, "2", "bob")
+	server.Write([]byte{'C', 0, 0, 0, 13})
+	server.WriteString("UPDATE 2\x00")
+
+	rs := newResultSet(conn)
+	rs.fields = []field{{name: "id", typeOID: _INT4OID}, {name: "user_name", typeOID: _TEXTOID}}
+	rs.values = make([][]byte, len(rs.fields))
+	conn.state = processingQueryState{}
+
+	var users []*user
+	if err := rs.ScanAll(&users); err != nil {
+		t.Fatal("ScanAll failed:", err)
+	}
+	if len(users) != 2 || *users[0] != (user{1, "alice"}) || *users[1] != (user{2, "bob"}) {
+		t.Errorf("have: %+v", users)
+	}
+
+	writeDataRow(&server, "3")
+	writeDataRow(&server, "4")
+	server.Write([]byte{'C', 0, 0, 0, 13})
+	server.WriteString("UPDATE 2\x00")
+
+	rs.fields = rs.fields[:1]
+	rs.values = make([][]byte, len(rs.fields))
+	rs.currentResultComplete = false
+
+	ids := []int64{1}
+	if err := rs.ScanAll(&ids); err != nil {
+		t.Fatal("ScanAll failed:", err)
+	}
+	if fmt.Sprint(ids) != "[1 3 4]" {
+		t.Errorf("have: %v, but want: [1 3 4]", ids)
+	}
+
+	var names []string
+	rs.fields = []field{{name: "id", typeOID: _INT4OID}, {name: "user_name", typeOID: _TEXTOID}}
+	if err := rs.ScanAll(&names); err == nil {
+		t.Error("expected error for several fields")
+	}
+}
+
+func Test_Statement_ExecuteReturningAll(t *testing.T) {
+	withConn(t, func(conn *Conn) {
+		if _, err := conn.Execute("CREATE TEMP TABLE returning_all AS SELECT generate_series(1, 3) AS id;"); err != nil {
+			t.Fatal("failed to create table:", err)
+		}
+
+		stmt, err := conn.Prepare("UPDATE returning_all SET id = id WHERE id <= 2 RETURNING id;")
+		if err != nil {
+			t.Fatal("failed to prepare:", err)
+		}
+		defer stmt.Close()
+
+		var ids []int
+		if err := stmt.ExecuteReturningAll(&ids); err != nil {
+			t.Fatal("ExecuteReturningAll failed:", err)
+		}
+
+		sort.Ints(ids)
+		if fmt.Sprint(ids) != "[1 2]" {
+			t.Errorf("have: %v, but want: [1 2]", ids)
+		}
+	})
+}
+
+func Test_Statement_ExecuteReturningAll_ScanError(t *testing.T) {
+	var server, client bytes.Buffer
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0, 'Z', 0, 0, 0, 5, 'I'})
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	// RowDescription with a single int4 field "x"
+	rowDescription := []byte{'T', 0, 0, 0, 26, 0, 1, 'x', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 23, 0, 4, 0xff, 0xff, 0xff, 0xff, 0, 0}
+
+	// ParseComplete, ParameterDescription and RowDescription
+	server.Write([]byte{'1', 0, 0, 0, 4, 't', 0, 0, 0, 6, 0, 0})
+	server.Write(rowDescription)
+
+	stmt, err := conn.Prepare("UPDATE foo SET x = x + 1 RETURNING x;")
+	if err != nil {
+		t.Fatal("failed to prepare:", err)
+	}
+
+	// BindComplete, RowDescription, DataRow, CommandComplete and
+	// ReadyForQuery
+	server.Write([]byte{'2', 0, 0, 0, 4})
+	server.Write(rowDescription)
+	server.Write([]byte{'D', 0, 0, 0, 12, 0, 1, 0, 0, 0, 2, '4', '2'})
+	server.Write([]byte{'C', 0, 0, 0, 13})
+	server.WriteString("UPDATE 1\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	// An integer can't be converted to time.Time, so scanning fails.
+	var times []time.Time
+	if err := stmt.ExecuteReturningAll(&times); err == nil {
+		t.Fatal("expected error")
+	}
+	if status := conn.Status(); status != StatusReady {
+		t.Errorf("have status: %s, but want: %s", status, StatusReady)
+	}
+	if server.Len() != 0 {
+		t.Errorf("%d bytes left unread", server.Len())
+	}
+}
+
+func Test_ResultSet_NumericScale(t *testing.T) {
+	rs := &ResultSet{
+		conn: &Conn{},
+		fields: []field{
+			{name: "a", typeOID: _NUMERICOID, typeMod: 10<<16 | 2 + 4},
+			{name: "b", typeOID: _NUMERICOID, typeMod: -1},
+			{name: "c", typeOID: _FLOAT8OID, typeMod: -1},
+			{name: "d", typeOID: _NUMERICOID, typeMod: 5<<16 + 4},
+		},
+	}
+
+	for ord, want := range []int{2, -1, -1, 0, -1} {
+		if have := rs.NumericScale(ord); have != want {
+			t.Errorf("%d: have: %d, but want: %d", ord, have, want)
+		}
+	}
+}
+
+func Test_Statement_QueryWithCancel(t *testing.T) {
+	var server bytes.Buffer
+
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	canceled := make(chan bool, 1)
+	serve := func(c net.Conn) {
+		buf := make([]byte, 16)
+		if _, err := io.ReadFull(c, buf); err == nil {
+			canceled <- true
+		}
+	}
+
+	withFakeServer(t, serve, func(host string) {
+		// Cancel requires the server address, which streams don't have.
+		conn.dial = nil
+		conn.params.Host = host
+		conn.params.Port = 5432
+
+		// Stopped before done fires, so nothing is canceled.
+		done := make(chan bool)
+		conn.watchCancel(done)()
+		close(done)
+
+		select {
+		case <-canceled:
+			t.Error("unexpected CancelRequest")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		done = make(chan bool)
+		stop := conn.watchCancel(done)
+		done <- true
+
+		select {
+		case <-canceled:
+		case <-time.After(5 * time.Second):
+			t.Error("no CancelRequest received")
+		}
+
+		stop()
+	})
+
+	// If done fired already, nothing is sent.
+	done := make(chan bool)
+	close(done)
+
+	stmt := newStatement(conn, "SELECT pg_sleep(10);", nil, true)
+
+	client.Reset()
+	if _, err := stmt.QueryWithCancel(done); err != errCanceled {
+		t.Errorf("have: %v, but want: %v", err, errCanceled)
+	}
+	if client.Len() != 0 {
+		t.Errorf("have sent: %q", client.Bytes())
+	}
+}
+
+func Test_ResultSet_Scan_FixedBytes(t *testing.T) {
+	rs := &ResultSet{
+		conn:          &Conn{},
+		hasCurrentRow: true,
+		fields: []field{
+			{name: "id", typeOID: _UUIDOID},
+			{name: "hash", typeOID: _BYTEAOID},
+			{name: "raw", typeOID: _BYTEAOID, format: binaryFormat},
+			{name: "none", typeOID: _UUIDOID},
+		},
+		values: [][]byte{
+			[]byte("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"),
+			[]byte("\\x01020304"),
+			{5, 6},
+			nil,
+		},
+	}
+
+	var id, none [16]byte
+	var hash [4]byte
+	var raw [2]byte
+	none[0] = 1
+	if err := rs.Scan(&id, &hash, &raw, &none); err != nil {
+		t.Fatal("failed to scan:", err)
+	}
+
+	if have := fmt.Sprintf("%x", id); have != "a0eebc999c0b4ef8bb6d6bb9bd380a11" {
+		t.Errorf("id: have: %s", have)
+	}
+	if hash != [4]byte{1, 2, 3, 4} || raw != [2]byte{5, 6} || none != [16]byte{} {
+		t.Errorf("have: %v, %v, %v", hash, raw, none)
+	}
+	if string(rs.values[0]) != "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11" {
+		t.Error("field value modified")
+	}
+
+	var short [8]byte
+	if err := rs.Scan(&short, nil, nil, nil); err == nil {
+		t.Error("expected error for wrong length")
+	}
+}
+
+func Test_ResultSet_ScanNextGeneric(t *testing.T) {
+	var server bytes.Buffer
+
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	writeDataRow(&server, "1", "alice", "t")
+	writeDataRow(&server, "2", "NULL", "f")
+	server.Write([]byte{'C', 0, 0, 0, 13})
+	server.WriteString("SELECT 2\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	rs := newResultSet(conn)
+	rs.fields = []field{{name: "x", typeOID: _INT4OID}, {name: "x", typeOID: _TEXTOID}, {name: "x", typeOID: _BOOLOID}}
+	rs.values = make([][]byte, len(rs.fields))
+	conn.state = processingQueryState{}
+
+	var rows []string
+	for {
+		values, fetched, err := rs.ScanNextGeneric()
+		if err != nil {
+			t.Fatal("ScanNextGeneric failed:", err)
+		}
+		if !fetched {
+			break
+		}
+
+		rows = append(rows, fmt.Sprint(values))
+	}
+
+	if want := "[[1 alice true] [2 <nil> false]]"; fmt.Sprint(rows) != want {
+		t.Errorf("have: %v, but want: %s", rows, want)
+	}
+}
+
+func Test_Statement_RenderSQL(t *testing.T) {
+	data := NewCustomTypeParameter("@data", "bytea")
+	if err := data.SetValue(`\x00ff`); err != nil {
+		t.Fatal("failed to set value:", err)
+	}
+
+	params := []*Parameter{
+		param("@id", Integer, -5),
+		param("@name", Varchar, `O'Brien \ Co`),
+		param("@note", Text, nil),
+		param("@price", Numeric, big.NewRat(3, 2)),
+		data,
+	}
+	command := "SELECT 1-@id, @name, '@note', @note, @price, @data, @name::text;"
+
+	stmt := newStatement(&Conn{}, command, params, true)
+	stmt.adjustCommand(nil)
+
+	sql, err := stmt.RenderSQL()
+	if err != nil {
+		t.Fatal("RenderSQL failed:", err)
+	}
+
+	want := `SELECT 1-(-5), E'O''Brien \\ Co'::varchar, '@note', NULL::text, 1.5, E'\\x00ff'::bytea, E'O''Brien \\ Co'::text;`
+	if sql != want {
+		t.Errorf("have: %s, but want: %s", sql, want)
+	}
+
+	if s := quoteLiteral("it's"); s != "'it''s'" {
+		t.Errorf("have: %s, but want: 'it''s'", s)
+	}
+}
+
+func Test_Conn_StartReplication(t *testing.T) {
+	var server bytes.Buffer
+
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser", Database: "db", Replication: "database"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+	if !strings.Contains(client.String(), "replication\x00database\x00\x00") {
+		t.Errorf("replication parameter missing in startup message: %q", client.String())
+	}
+
+	// CopyBothResponse, CopyData, CopyDone, CommandComplete and ReadyForQuery
+	server.Write([]byte{'W', 0, 0, 0, 7, 0, 0, 0})
+	server.Write([]byte{'d', 0, 0, 0, 7, 'k', 'a', 'b'})
+	server.Write([]byte{'c', 0, 0, 0, 4})
+	server.Write([]byte{'C', 0, 0, 0, 11})
+	server.WriteString("COPY 0\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	client.Reset()
+
+	stream, err := conn.StartReplication("my slot", LSN(0x16B374D848), `"proto_version" '1'`)
+	if err != nil {
+		t.Fatal("StartReplication failed:", err)
+	}
+	if want := `START_REPLICATION SLOT "my slot" LOGICAL 16/B374D848 ("proto_version" '1')`; !strings.Contains(client.String(), want) {
+		t.Errorf("have: %q, but want command: %s", client.String(), want)
+	}
+	if status := conn.Status(); status != StatusCopy {
+		t.Errorf("status: have: %s, but want: %s", status, StatusCopy)
+	}
+
+	data, err := stream.Next()
+	if err != nil || string(data) != "kab" {
+		t.Fatalf("have: %q, %v, but want: kab", data, err)
+	}
+
+	client.Reset()
+	if err := stream.Send([]byte("r")); err != nil {
+		t.Fatal("Send failed:", err)
+	}
+	if want := "d\x00\x00\x00\x05r"; client.String() != want {
+		t.Errorf("have: %q, but want: %q", client.String(), want)
+	}
+
+	client.Reset()
+	if _, err := stream.Next(); err != io.EOF {
+		t.Fatalf("have: %v, but want: io.EOF", err)
+	}
+	if want := "c\x00\x00\x00\x04"; client.String() != want {
+		t.Errorf("have: %q, but want CopyDone: %q", client.String(), want)
+	}
+	if status := conn.Status(); status != StatusReady {
+		t.Errorf("status: have: %s, but want: %s", status, StatusReady)
+	}
+	if err := stream.Close(); err != nil {
+		t.Error("Close failed:", err)
+	}
+	if err := stream.Send([]byte("r")); err == nil {
+		t.Error("expected error for Send after the end of the stream")
+	}
+}
+
+func Test_ReplicationStream_SendStatus(t *testing.T) {
+	var server bytes.Buffer
+
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser", Replication: "database"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	// CopyBothResponse and a primary keepalive message requesting a reply
+	server.Write([]byte{'W', 0, 0, 0, 7, 0, 0, 0})
+	server.Write([]byte{'d', 0, 0, 0, 22, 'k'})
+	server.Write(make([]byte, 16))
+	server.WriteByte(1)
+
+	stream, err := conn.StartReplication("slot", 0)
+	if err != nil {
+		t.Fatal("StartReplication failed:", err)
+	}
+
+	// status checks a standby status update written by the client.
+	status := func(written, flushed, applied LSN, replyRequested byte) {
+		msg := client.Bytes()
+		client.Reset()
+
+		if len(msg) != 39 || msg[0] != 'd' || msg[5] != 'r' {
+			t.Fatalf("not a standby status update: %q", msg)
+		}
+		for i, want := range []LSN{written, flushed, applied} {
+			if have := LSN(binary.BigEndian.Uint64(msg[6+i*8:])); have != want {
+				t.Errorf("LSN %d: have: %s, but want: %s", i, have, want)
+			}
+		}
+		if msg[38] != replyRequested {
+			t.Errorf("reply requested: have: %d, but want: %d", msg[38], replyRequested)
+		}
+	}
+
+	client.Reset()
+	if err := stream.SendStatus(3, 2, 1, true); err != nil {
+		t.Fatal("SendStatus failed:", err)
+	}
+	status(3, 2, 1, 1)
+
+	// The keepalive is answered with the last reported positions.
+	if data, err := stream.Next(); err != nil || data[0] != 'k' {
+		t.Fatalf("have: %q, %v, but want a keepalive message", data, err)
+	}
+	status(3, 2, 1, 0)
+}
+
+func Test_ResultSet_AppendValue(t *testing.T) {
+	rs := &ResultSet{
+		conn:          &Conn{},
+		hasCurrentRow: true,
+		fields: []field{
+			{name: "hex", typeOID: _BYTEAOID},
+			{name: "escape", typeOID: _BYTEAOID},
+			{name: "text", typeOID: _TEXTOID},
+			{name: "none", typeOID: _BYTEAOID},
+		},
+		values: [][]byte{
+			[]byte("\\x0102"),
+			[]byte("a\\001\\\\"),
+			[]byte("xyz"),
+			nil,
+		},
+	}
+
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '>')
+
+	var isNull bool
+	var err error
+	for ord := range rs.fields {
+		if buf, isNull, err = rs.AppendValue(ord, buf); err != nil {
+			t.Fatal("AppendValue failed:", err)
+		}
+		if isNull != (ord == 3) {
+			t.Errorf("ord %d: isNull: %t", ord, isNull)
+		}
+	}
+
+	if want := ">\x01\x02a\x01\\xyz"; string(buf) != want {
+		t.Errorf("have: %q, but want: %q", buf, want)
+	}
+	if cap(buf) != 64 {
+		t.Error("buffer has been reallocated")
+	}
+}
+
+func Test_Statement_Refresh(t *testing.T) {
+	var server bytes.Buffer
+
+	// AuthenticationOk and ReadyForQuery
+	server.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	var client bytes.Buffer
+
+	conn, err := NewConnFromStreams(&server, &client, &ConnParams{User: "testuser"}, LogNothing)
+	if err != nil {
+		t.Fatal("failed to create connection:", err)
+	}
+
+	// ParseComplete, ParameterDescription and NoData
+	prepared := []byte{'1', 0, 0, 0, 4, 't', 0, 0, 0, 6, 0, 0, 'n', 0, 0, 0, 4}
+
+	server.Write(prepared)
+
+	stmt, err := conn.Prepare("UPDATE foo SET bar = 1;")
+	if err != nil {
+		t.Fatal("failed to prepare:", err)
+	}
+
+	// Bind fails with the stale plan error, then ReadyForQuery
+	message := "SERROR\x00C0A000\x00Mcached plan must not change result type\x00RRevalidateCachedQuery\x00\x00"
+	server.WriteByte('E')
+	binary.Write(&server, binary.BigEndian, int32(4+len(message)))
+	server.WriteString(message)
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+	// CloseComplete and the responses to preparing again
+	server.Write([]byte{'3', 0, 0, 0, 4})
+	server.Write(prepared)
+	// BindComplete, NoData, CommandComplete and ReadyForQuery
+	server.Write([]byte{'2', 0, 0, 0, 4, 'n', 0, 0, 0, 4})
+	server.Write([]byte{'C', 0, 0, 0, 13})
+	server.WriteString("UPDATE 1\x00")
+	server.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+
+	client.Reset()
+
+	rowsAffected, err := stmt.Execute()
+	if err != nil || rowsAffected != 1 {
+		t.Fatalf("have: %d, %v, but want: 1, <nil>", rowsAffected, err)
+	}
+	if close := "S" + stmt.Name() + "\x00"; !bytes.Contains(client.Bytes(), append([]byte{'C', 0, 0, 0, byte(6 + len(stmt.Name()))}, close...)) {
+		t.Errorf("statement has not been closed before preparing it again: %q", client.String())
+	}
+
+	server.Write([]byte{'3', 0, 0, 0, 4})
+	server.Write(prepared)
+
+	if err := stmt.Refresh(); err != nil {
+		t.Error("Refresh failed:", err)
+	}
+	if server.Len() != 0 {
+		t.Errorf("%d bytes left unread", server.Len())
+	}
+}
+
+func Test_isStalePlanError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&Error{code: "0A000", message: "cached plan must not change result type", routine: "RevalidateCachedQuery"}, true},
+		// Translated message, e.g. with lc_messages = 'de_DE'
+		{&Error{code: "0A000", message: "gecachter Plan darf den Ergebnistyp nicht ändern", routine: "RevalidateCachedQuery"}, true},
+		// No routine reported
+		{&Error{code: "0A000", message: "cached plan must not change result type"}, true},
+		{&Error{code: "0A000", message: "cached plan must not change result type", routine: "exec_simple_query"}, false},
+		{&Error{code: "0A000", message: "feature not supported"}, false},
+		{&Error{code: "42P01", routine: "RevalidateCachedQuery"}, false},
+		{errors.New("cached plan must not change result type"), false},
+	}
+
+	for i, test := range tests {
+		if have := isStalePlanError(test.err); have != test.want {
+			t.Errorf("%d: have: %t, but want: %t", i, have, test.want)
+		}
+	}
+}
+
+func Test_paramsFromValues_Bytea(t *testing.T) {
+	params := paramsFromValues(nil, []driver.Value{[]byte{0, '\\', 0xff}, "x"})
+
+	if params[0].Type() != Bytea || params[1].Type() != Varchar {
+		t.Fatalf("have types: %s, %s, but want: Bytea, Varchar", params[0].Type(), params[1].Type())
+	}
+	if s, isNull := formatParamValue(params[0].Type(), params[0].Value()); isNull || s != `\x005cff` {
+		t.Errorf("have: '%s' (null: %t), but want: '\\x005cff'", s, isNull)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2013 The go-pgsql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgsql
+
+import (
+	"errors"
+)
+
+type pipelineItem struct {
+	stmt  *Statement
+	parse bool
+}
+
+// Pipeline queues commands and prepared statements, so they can be sent to
+// the server together, followed by a single Sync.
+//
+// Call *Conn.Pipeline to create a new Pipeline.
+//
+// The server processes the queued items in order. If one of them fails, the
+// server skips the remaining ones until the Sync, so their rows affected will
+// not be reported. Since all items share the same Sync, they are executed in
+// a single implicit transaction, unless a transaction is already in progress.
+// Send and Sync allow to send items in several batches within one such group.
+type Pipeline struct {
+	conn  *Conn
+	items []pipelineItem
+}
+
+// Pipeline returns a new, empty Pipeline for the connection.
+func (conn *Conn) Pipeline() *Pipeline {
+	return &Pipeline{conn: conn}
+}
+
+// Conn returns the *Conn this Pipeline is associated with.
+func (p *Pipeline) Conn() *Conn {
+	return p.conn
+}
+
+// Len returns the number of items queued in the Pipeline.
+func (p *Pipeline) Len() int {
+	return len(p.items)
+}
+
+// Execute queues a SQL command, which will be executed through the unnamed
+// statement and portal, when the Pipeline is flushed.
+//
+// The command must contain a single SQL statement and must not be empty.
+func (p *Pipeline) Execute(command string, params ...*Parameter) (err error) {
+	err = p.conn.withRecover("*Pipeline.Execute", func() {
+		if command == "" {
+			panic(errors.New("empty command"))
+		}
+
+		stmt := newStatement(p.conn, command, params, true)
+		stmt.adjustCommand(p.conn.paramCasts)
+		stmt.checkParameters()
+
+		p.items = append(p.items, pipelineItem{stmt: stmt, parse: true})
+	})
+
+	return
+}
+
+// ExecuteStatement queues the prepared Statement, which will be executed with
+// its current parameter values, when the Pipeline is flushed.
+func (p *Pipeline) ExecuteStatement(stmt *Statement) (err error) {
+	err = p.conn.withRecover("*Pipeline.ExecuteStatement", func() {
+		if stmt.conn != p.conn {
+			panic(errors.New("statement belongs to another connection"))
+		}
+		if stmt.isClosed {
+			panic(errors.New("statement is closed"))
+		}
+
+		p.items = append(p.items, pipelineItem{stmt: stmt, parse: stmt.reparse})
+	})
+
+	return
+}
+
+// writeItems writes the messages for all queued items and empties the queue.
+func (p *Pipeline) writeItems() (items []pipelineItem) {
+	conn := p.conn
+
+	// Check all items first, so nothing has been written, if one fails.
+	for _, item := range p.items {
+		item.stmt.checkValuesSet()
+	}
+
+	items = p.items
+	p.items = nil
+
+	for _, item := range items {
+		if item.parse {
+			conn.writeParse(item.stmt)
+		}
+		conn.writeBind(item.stmt)
+		conn.writeDescribe(item.stmt)
+		conn.writeExecute(item.stmt)
+	}
+
+	return
+}
+
+// readItems reads the responses for items.
+func (p *Pipeline) readItems(items []pipelineItem) (rowsAffected []int64) {
+	conn := p.conn
+
+	for _, item := range items {
+		rs := newResultSet(conn)
+
+		if item.parse {
+			// ParseComplete
+			conn.readBackendMessages(rs)
+		}
+
+		// BindComplete
+		conn.readBackendMessages(rs)
+
+		// RowDescription or NoData
+		conn.readBackendMessages(rs)
+
+		for !rs.currentResultComplete {
+			conn.readBackendMessages(rs)
+		}
+
+		rowsAffected = append(rowsAffected, rs.rowsAffected)
+	}
+
+	return
+}
+
+func (p *Pipeline) flush() (rowsAffected []int64) {
+	conn := p.conn
+
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Pipeline.flush"))
+	}
+
+	if stateCode := conn.state.code(); stateCode != StatusReady {
+		panic("wrong state, expected: StatusReady, have: " + stateCode.String())
+	}
+
+	items := p.writeItems()
+	conn.writeSync()
+
+	conn.state = processingQueryState{}
+
+	// If an item fails, the error is raised after the ReadyForQuery
+	// that follows the Sync has been read.
+	rowsAffected = p.readItems(items)
+
+	// ReadyForQuery
+	conn.readBackendMessages(nil)
+
+	return
+}
+
+// Flush sends all queued items to the server, followed by a Sync, and reads
+// the responses in order.
+//
+// The returned slice contains the number of rows affected for each item.
+// Rows returned by queries are discarded. If an item fails, the error of that
+// item is returned. The Pipeline is empty afterwards and can be reused.
+func (p *Pipeline) Flush() (rowsAffected []int64, err error) {
+	err = p.conn.withRecover("*Pipeline.Flush", func() {
+		rowsAffected = p.flush()
+	})
+
+	return
+}
+
+func (p *Pipeline) send() (rowsAffected []int64) {
+	conn := p.conn
+
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Pipeline.send"))
+	}
+
+	if stateCode := conn.state.code(); stateCode != StatusReady {
+		panic("wrong state, expected: StatusReady, have: " + stateCode.String())
+	}
+
+	items := p.writeItems()
+	conn.writeFlush()
+
+	conn.state = processingQueryState{}
+
+	// Without a Sync, there will be no ReadyForQuery after an error.
+	conn.onErrorDontRequireReadyForQuery = true
+	defer func() {
+		conn.onErrorDontRequireReadyForQuery = false
+	}()
+
+	rowsAffected = p.readItems(items)
+
+	conn.state = readyState{}
+
+	return
+}
+
+// Send sends all queued items to the server, followed by a Flush instead of
+// a Sync, and reads the responses in order, like Flush does.
+//
+// Since no Sync is sent, the items of all calls to Send up to the next Sync
+// form a single group, which is executed in one implicit transaction, unless
+// a transaction is already in progress. Call Sync to end the group.
+//
+// If an item fails, its error is returned and the server ignores all
+// messages it receives until the next Sync, so Sync must be called before
+// the connection can be used again.
+func (p *Pipeline) Send() (rowsAffected []int64, err error) {
+	err = p.conn.withRecover("*Pipeline.Send", func() {
+		rowsAffected = p.send()
+	})
+
+	return
+}
+
+func (p *Pipeline) sync() {
+	conn := p.conn
+
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Pipeline.sync"))
+	}
+
+	conn.writeSync()
+
+	conn.state = processingQueryState{}
+
+	// ReadyForQuery
+	conn.readBackendMessages(nil)
+}
+
+// Sync sends a Sync to the server and waits until it is ready for the next
+// query, ending the group of items sent by Send. The implicit transaction of
+// the group, if any, is committed, unless an item failed.
+//
+// Items still queued are not sent.
+func (p *Pipeline) Sync() (err error) {
+	err = p.conn.withRecover("*Pipeline.Sync", func() {
+		p.sync()
+	})
+
+	return
+}
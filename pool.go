@@ -23,7 +23,7 @@ type poolConn struct {
 }
 
 type pool struct {
-	params  string        // Params to create new Conn
+	params  *ConnParams   // Params to create new Conn
 	conns   *list.List    // List of available Conns
 	max     int           // Maximum number of connections to create
 	min     int           // min number of connections to create
@@ -71,7 +71,7 @@ func timeoutCloser(p *pool) {
 		}
 		// don't let the pool fall below the min
 		for i := p.n; i < p.min; i++ {
-			c, err := Connect(p.params, LogError)
+			c, err := ConnectParams(p.params, LogError)
 			if err != nil {
 				p.log("can't create connection")
 			} else {
@@ -91,6 +91,12 @@ func timeoutCloser(p *pool) {
 // Connections that have been idle for idleTimeout seconds will be automatically
 // closed.
 func NewPool(connectParams string, minConns, maxConns int, idleTimeout time.Duration) (p *Pool, err error) {
+	return NewPoolParams((&Conn{}).parseParams(connectParams), minConns, maxConns, idleTimeout)
+}
+
+// NewPoolParams is like NewPool, but uses the settings in params to create
+// new connections.
+func NewPoolParams(params *ConnParams, minConns, maxConns int, idleTimeout time.Duration) (p *Pool, err error) {
 	if minConns < 1 {
 		return nil, errors.New("minConns must be >= 1")
 	}
@@ -101,14 +107,14 @@ func NewPool(connectParams string, minConns, maxConns int, idleTimeout time.Dura
 		return nil, errors.New("idleTimeout must be >= 5")
 	}
 
-	// Create initial connection to verify connectParams will work.
-	c, err := Connect(connectParams, LogError)
+	// Create initial connection to verify params will work.
+	c, err := ConnectParams(params, LogError)
 	if err != nil {
 		return
 	}
 	p = &Pool{
 		&pool{
-			params:  connectParams,
+			params:  params,
 			conns:   list.New(),
 			max:     maxConns,
 			min:     minConns,
@@ -121,7 +127,7 @@ func NewPool(connectParams string, minConns, maxConns int, idleTimeout time.Dura
 
 	for i := 0; i < minConns-1; i++ {
 		// pre-fill the pool
-		_c, err := Connect(connectParams, LogError)
+		_c, err := ConnectParams(params, LogError)
 		if err != nil {
 			return nil, err
 		}
@@ -147,7 +153,7 @@ func (p *Pool) Acquire() (c *Conn, err error) {
 	if p.conns.Len() > 0 {
 		c = p.conns.Remove(p.conns.Front()).(poolConn).Conn
 	} else if p.conns.Len() == 0 && p.n < p.max {
-		c, err = Connect(p.params, LogError)
+		c, err = ConnectParams(p.params, LogError)
 		if err != nil {
 			return
 		}
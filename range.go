@@ -0,0 +1,218 @@
+// Copyright 2013 The go-pgsql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgsql
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// rangeElemOIDs maps the OIDs of supported range types to the OIDs of their
+// element types.
+var rangeElemOIDs = map[int32]int32{
+	_INT4RANGEOID: _INT4OID,
+	_INT8RANGEOID: _INT8OID,
+	_NUMRANGEOID:  _NUMERICOID,
+	_TSRANGEOID:   _TIMESTAMPOID,
+	_TSTZRANGEOID: _TIMESTAMPTZOID,
+	_DATERANGEOID: _DATEOID,
+}
+
+func isRangeType(oid int32) bool {
+	_, ok := rangeElemOIDs[oid]
+	return ok
+}
+
+// Range represents a value of a PostgreSQL range type, like int4range,
+// int8range, numrange, tsrange, tstzrange or daterange.
+//
+// Bounds are of the types Any returns for the element type of the range,
+// e.g. int for int4range or time.Time for tstzrange. A nil bound is infinite.
+type Range struct {
+	Lower, Upper interface{}
+
+	// LowerInclusive and UpperInclusive are true for inclusive bounds,
+	// like in [1,10], and false for exclusive ones, like in (1,10). They
+	// are ignored for infinite bounds.
+	LowerInclusive, UpperInclusive bool
+
+	// Empty is true for the empty range, which contains no values. The
+	// bounds are ignored then.
+	Empty bool
+}
+
+// String returns r in the text format of PostgreSQL, e.g. [1,10) or empty.
+func (r Range) String() string {
+	if r.Empty {
+		return "empty"
+	}
+
+	buf := bytes.NewBuffer(nil)
+
+	if r.LowerInclusive && r.Lower != nil {
+		buf.WriteByte('[')
+	} else {
+		buf.WriteByte('(')
+	}
+
+	writeRangeBound(buf, r.Lower)
+	buf.WriteByte(',')
+	writeRangeBound(buf, r.Upper)
+
+	if r.UpperInclusive && r.Upper != nil {
+		buf.WriteByte(']')
+	} else {
+		buf.WriteByte(')')
+	}
+
+	return buf.String()
+}
+
+// writeRangeBound writes the quoted text representation of v to buf, or
+// nothing, if v is nil.
+func writeRangeBound(buf *bytes.Buffer, v interface{}) {
+	if v == nil || isNilPtr(v) {
+		return
+	}
+
+	var s string
+	if t, ok := v.(time.Time); ok {
+		// The element type is unknown, but this is accepted for date and
+		// timestamp ranges alike.
+		s = t.Format("2006-01-02 15:04:05.999999999Z07:00")
+	} else {
+		s, _ = formatParamValue(Custom, v)
+	}
+
+	buf.WriteByte('"')
+	buf.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s))
+	buf.WriteByte('"')
+}
+
+// parseRange splits the text representation of a range into its bounds. An
+// infinite bound is returned as nil.
+func parseRange(s []byte) (lower, upper []byte, lowerInclusive, upperInclusive, empty bool) {
+	if bytes.EqualFold(bytes.TrimSpace(s), []byte("empty")) {
+		empty = true
+		return
+	}
+
+	if len(s) < 3 || s[0] != '[' && s[0] != '(' || s[len(s)-1] != ']' && s[len(s)-1] != ')' {
+		panic(fmt.Sprintf("invalid range: '%s'", s))
+	}
+
+	lowerInclusive = s[0] == '['
+	upperInclusive = s[len(s)-1] == ']'
+
+	inner := s[1 : len(s)-1]
+	i := 0
+
+	bound := func() []byte {
+		if i == len(inner) || inner[i] == ',' {
+			return nil
+		}
+
+		b := []byte{}
+		quoted := false
+		for ; i < len(inner); i++ {
+			c := inner[i]
+			switch {
+			case c == '\\' && i+1 < len(inner):
+				i++
+				b = append(b, inner[i])
+
+			case c == '"' && quoted && i+1 < len(inner) && inner[i+1] == '"':
+				i++
+				b = append(b, '"')
+
+			case c == '"':
+				quoted = !quoted
+
+			case c == ',' && !quoted:
+				return b
+
+			default:
+				b = append(b, c)
+			}
+		}
+
+		if quoted {
+			panic(fmt.Sprintf("invalid range: '%s'", s))
+		}
+
+		return b
+	}
+
+	if lower = bound(); i == len(inner) {
+		panic(fmt.Sprintf("invalid range: '%s'", s))
+	}
+	i++
+	if upper = bound(); i != len(inner) {
+		panic(fmt.Sprintf("invalid range: '%s'", s))
+	}
+
+	return
+}
+
+func (rs *ResultSet) rangeValue(ord int) (value Range, isNull bool) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.rangeValue"))
+	}
+
+	isNull = rs.isNull(ord)
+	if isNull {
+		return
+	}
+
+	f := rs.fields[ord]
+
+	elemOID, ok := rangeElemOIDs[f.typeOID]
+	if !ok {
+		panic(fmt.Sprintf("field '%s' is not of a supported range type, OID: %d", f.name, f.typeOID))
+	}
+	if f.format != textFormat {
+		panicNotImplemented()
+	}
+
+	lower, upper, lowerInclusive, upperInclusive, empty := parseRange(rs.values[ord])
+
+	if empty {
+		value.Empty = true
+		return
+	}
+
+	// Decode the bounds like the fields of a row, nil bounds like NULLs.
+	bounds := &ResultSet{
+		conn:          rs.conn,
+		hasCurrentRow: true,
+		fields:        []field{{name: f.name, typeOID: elemOID}, {name: f.name, typeOID: elemOID}},
+		values:        [][]byte{lower, upper},
+	}
+
+	if lower != nil {
+		value.Lower, _ = bounds.any(0)
+	}
+	if upper != nil {
+		value.Upper, _ = bounds.any(1)
+	}
+	value.LowerInclusive = lowerInclusive && lower != nil
+	value.UpperInclusive = upperInclusive && upper != nil
+
+	return
+}
+
+// Range returns the value of the range field with the specified ordinal.
+//
+// Bounds are decoded according to the element type of the range, as
+// described for Any.
+func (rs *ResultSet) Range(ord int) (value Range, isNull bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.Range", func() {
+		value, isNull = rs.rangeValue(ord)
+	})
+
+	return
+}
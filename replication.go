@@ -0,0 +1,284 @@
+// Copyright 2013 The go-pgsql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgsql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ReplicationStream is the bidirectional stream of CopyData messages of a
+// replication connection, started with *Conn.StartReplication.
+//
+// The stream occupies the connection until it has ended, either by the server
+// or by calling Close.
+type ReplicationStream struct {
+	conn       *Conn
+	clientDone bool
+	serverDone bool
+	written    LSN
+	flushed    LSN
+	applied    LSN
+}
+
+func (conn *Conn) startReplication(slot string, start LSN, options []string) *ReplicationStream {
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Conn.startReplication"))
+	}
+
+	if stateCode := conn.state.code(); stateCode != StatusReady {
+		panic("wrong state, expected: StatusReady, have: " + stateCode.String())
+	}
+
+	command := fmt.Sprintf("START_REPLICATION SLOT %s LOGICAL %s", quoteIdentifier(slot), start)
+	if len(options) > 0 {
+		command += " (" + strings.Join(options, ", ") + ")"
+	}
+
+	conn.writeQuery(command)
+	conn.readBackendMessages(nil)
+	if stateCode := conn.state.code(); stateCode != StatusCopy {
+		panic("wrong state, expected: StatusCopy, have: " + stateCode.String())
+	}
+
+	return &ReplicationStream{conn: conn}
+}
+
+// StartReplication starts streaming changes from the logical replication slot
+// slot, beginning at start, and returns the stream.
+//
+// The connection must have been established with ConnParams.Replication set
+// to "database". options are passed to the output plugin of the slot as they
+// are, e.g. `"proto_version" '1'` or `"publication_names" 'pub'`.
+//
+// The payloads of the CopyData messages sent by the server, i.e. XLogData and
+// primary keepalive messages, are returned by Next without being decoded.
+func (conn *Conn) StartReplication(slot string, start LSN, options ...string) (stream *ReplicationStream, err error) {
+	err = conn.withRecover("*Conn.StartReplication", func() {
+		stream = conn.startReplication(slot, start, options)
+	})
+
+	return
+}
+
+// Conn returns the *Conn this ReplicationStream is associated with.
+func (s *ReplicationStream) Conn() *Conn {
+	return s.conn
+}
+
+// readMessage reads the next message sent by the server within the stream. It
+// returns the payload of a CopyData message or, if the server has ended the
+// stream with a CopyDone, done as true.
+func (s *ReplicationStream) readMessage() (data []byte, done bool) {
+	conn := s.conn
+
+	for {
+		msgCode := conn.readMessageCode()
+
+		conn.checkMessageLength()
+
+		if conn.LogLevel >= LogDebug {
+			conn.logf(LogDebug, "received '%s' backend message", msgCode)
+		}
+
+		switch msgCode {
+		case _CopyData_BE:
+			msgLen := conn.readInt32()
+
+			data = make([]byte, msgLen-4)
+			conn.read(data)
+			return
+
+		case _CopyDone_BE:
+			conn.readInt32()
+
+			s.serverDone = true
+			done = true
+			return
+
+		case _ErrorResponse:
+			s.serverDone = true
+			s.clientDone = true
+			conn.readErrorOrNoticeResponse(true)
+
+		case _NoticeResponse:
+			conn.readErrorOrNoticeResponse(false)
+
+		case _ParameterStatus:
+			conn.readParameterStatus()
+
+		default:
+			conn.markDead()
+			panic(fmt.Errorf("unexpected '%s' backend message in replication stream, connection closed", msgCode))
+		}
+	}
+}
+
+// end completes the shutdown of the stream, after which the connection is
+// ready for the next command.
+func (s *ReplicationStream) end() {
+	conn := s.conn
+
+	if !s.clientDone {
+		conn.writeFrontendMessageCode(_CopyDone_FE)
+		conn.writeInt32(4)
+		conn.flush()
+
+		s.clientDone = true
+	}
+
+	// Discard what the server sent before it noticed our CopyDone.
+	for !s.serverDone {
+		s.readMessage()
+	}
+
+	rs := newResultSet(conn)
+	conn.readBackendMessages(rs)
+	rs.close()
+}
+
+func (s *ReplicationStream) next() (data []byte, done bool) {
+	conn := s.conn
+
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*ReplicationStream.next"))
+	}
+
+	if s.serverDone {
+		return nil, true
+	}
+
+	data, done = s.readMessage()
+	if done {
+		s.end()
+		return
+	}
+
+	// A primary keepalive message requesting a reply must be answered
+	// soon, or the server terminates the connection.
+	if len(data) >= 18 && data[0] == 'k' && data[17] == 1 && !s.clientDone {
+		s.sendStatus(s.written, s.flushed, s.applied, false)
+	}
+
+	return
+}
+
+// Next waits for the next message from the server and returns its payload.
+//
+// The first byte of the payload identifies the message, e.g. 'w' for XLogData
+// or 'k' for a primary keepalive message. The payload is newly allocated, so
+// it may be retained. If a primary keepalive message requests a reply, a
+// standby status update with the positions last passed to SendStatus is sent
+// before Next returns.
+//
+// If the server ends the stream, it is closed and io.EOF is returned.
+func (s *ReplicationStream) Next() (data []byte, err error) {
+	var done bool
+
+	err = s.conn.withRecover("*ReplicationStream.Next", func() {
+		data, done = s.next()
+	})
+
+	if err == nil && done {
+		err = io.EOF
+	}
+
+	return
+}
+
+func (s *ReplicationStream) send(data []byte) {
+	conn := s.conn
+
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*ReplicationStream.send"))
+	}
+
+	if s.clientDone {
+		panic(errors.New("replication stream closed"))
+	}
+
+	conn.writeCopyData(data)
+	conn.flush()
+}
+
+// Send sends data to the server as the payload of a CopyData message, e.g. a
+// standby status update.
+func (s *ReplicationStream) Send(data []byte) (err error) {
+	err = s.conn.withRecover("*ReplicationStream.Send", func() {
+		s.send(data)
+	})
+
+	return
+}
+
+func (s *ReplicationStream) sendStatus(written, flushed, applied LSN, replyRequested bool) {
+	conn := s.conn
+
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*ReplicationStream.sendStatus"))
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte('r')
+	binary.Write(buf, binary.BigEndian, written)
+	binary.Write(buf, binary.BigEndian, flushed)
+	binary.Write(buf, binary.BigEndian, applied)
+	binary.Write(buf, binary.BigEndian, pgMicroseconds(time.Now()))
+	if replyRequested {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+
+	s.send(buf.Bytes())
+
+	s.written, s.flushed, s.applied = written, flushed, applied
+}
+
+// SendStatus sends a standby status update to the server, reporting the WAL
+// positions up to which changes have been received and written, flushed to
+// durable storage and applied. The server may then discard WAL up to the
+// flushed position. If replyRequested is true, the server responds with a
+// primary keepalive message right away.
+//
+// Call SendStatus regularly, at the latest within wal_sender_timeout, since
+// the server terminates the connection otherwise.
+func (s *ReplicationStream) SendStatus(written, flushed, applied LSN, replyRequested bool) (err error) {
+	err = s.conn.withRecover("*ReplicationStream.SendStatus", func() {
+		s.sendStatus(written, flushed, applied, replyRequested)
+	})
+
+	return
+}
+
+func (s *ReplicationStream) close() {
+	conn := s.conn
+
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*ReplicationStream.close"))
+	}
+
+	if s.clientDone && s.serverDone {
+		return
+	}
+
+	s.end()
+}
+
+// Close ends the stream, if the server has not already done so, and waits
+// until the connection is ready for the next command. Messages received in
+// the meantime are discarded.
+func (s *ReplicationStream) Close() (err error) {
+	err = s.conn.withRecover("*ReplicationStream.Close", func() {
+		s.close()
+	})
+
+	return
+}
@@ -5,10 +5,16 @@
 package pgsql
 
 import (
+	"bytes"
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/big"
+	"net"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -22,9 +28,42 @@ const (
 )
 
 type field struct {
-	name    string
-	format  fieldFormat
-	typeOID int32
+	name     string
+	format   fieldFormat
+	typeOID  int32
+	tableOID int32
+	attNum   int16
+	typeSize int16
+	typeMod  int32
+}
+
+// FieldDesc describes a field of a ResultSet, as reported by the server in
+// the RowDescription message.
+type FieldDesc struct {
+	// Name is the name of the field.
+	Name string
+
+	// TableOID is the OID of the table the field belongs to, or 0, if the
+	// field is not a column of a table.
+	TableOID int32
+
+	// AttributeNumber is the attribute number of the column within its table,
+	// or 0, if the field is not a column of a table.
+	AttributeNumber int16
+
+	// TypeOID is the OID of the data type of the field.
+	TypeOID int32
+
+	// TypeSize is the size of the data type as in pg_type.typlen. Negative
+	// values denote variable-width types.
+	TypeSize int16
+
+	// TypeModifier is the type-specific modifier, e.g. the length of a
+	// varchar plus 4, or -1, if there is none.
+	TypeModifier int32
+
+	// Format is 0 for text and 1 for binary format.
+	Format int16
 }
 
 // ResultSet reads the results of a query, row by row, and provides methods to
@@ -34,15 +73,35 @@ type field struct {
 type ResultSet struct {
 	conn                  *Conn
 	stmt                  *Statement
+	autoCloseStmt         *Statement
+	stopCancelWatch       func()
 	hasCurrentRow         bool
+	rawText               bool
 	currentResultComplete bool
 	allResultsComplete    bool
 	rowsAffected          int64
+	rowsFetched           int64
+	command               string
+	commandResults        []CommandResult
+	err                   error
+	nullValue             interface{}
+	scanBuffer            *ScanBuffer
 	name2ord              map[string]int
 	fields                []field
 	values                [][]byte
 }
 
+// CommandResult describes the completion of a single SQL command.
+type CommandResult struct {
+	// Tag is the command tag reported by the server, e.g. "INSERT 0 5" or
+	// "CREATE TABLE".
+	Tag string
+
+	// RowsAffected is the number of rows affected, taken from the tag, or 0
+	// for commands that don't report one.
+	RowsAffected int64
+}
+
 func newResultSet(conn *Conn) *ResultSet {
 	if conn.LogLevel >= LogDebug {
 		defer conn.logExit(conn.logEnter("newResultSet"))
@@ -76,6 +135,7 @@ func (rs *ResultSet) readRow() {
 	rs.conn.readDataRow(rs)
 
 	rs.hasCurrentRow = true
+	rs.rowsFetched++
 }
 
 func (rs *ResultSet) eatCurrentResultRows() {
@@ -130,6 +190,10 @@ func (rs *ResultSet) NextResult() (hasResult bool, err error) {
 		hasResult = rs.nextResult()
 	})
 
+	if err != nil && rs.err == nil {
+		rs.err = err
+	}
+
 	return
 }
 
@@ -148,6 +212,10 @@ func (rs *ResultSet) fetchNext() bool {
 }
 
 func (rs *ResultSet) setCompletedOnPgsqlError(err error) {
+	if err != nil && rs.err == nil {
+		rs.err = err
+	}
+
 	if err != nil && !rs.hasCurrentRow {
 		if _, ok := err.(*Error); ok {
 			// This is likely an exception raised by a user defined PostgreSQL
@@ -177,6 +245,11 @@ func (rs *ResultSet) close() {
 		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.close"))
 	}
 
+	if stop := rs.stopCancelWatch; stop != nil {
+		rs.stopCancelWatch = nil
+		stop()
+	}
+
 	if rs.stmt != nil {
 		defer rs.conn.writeClose('P', rs.stmt.portalName)
 	}
@@ -186,6 +259,43 @@ func (rs *ResultSet) close() {
 	rs.eatAllResultRows()
 
 	rs.conn.state = readyState{}
+
+	if observer := rs.conn.rowCountObserver; observer != nil && rs.command != "" {
+		rows := rs.rowsFetched
+		if rows == 0 {
+			rows = rs.rowsAffected
+		}
+
+		// Report only once, even if closed again.
+		command := rs.command
+		rs.command = ""
+
+		observer(command, rows)
+	}
+
+	if stmt := rs.autoCloseStmt; stmt != nil {
+		rs.autoCloseStmt = nil
+		stmt.close()
+	}
+}
+
+// Err returns the first error that occurred while reading rows or results
+// with FetchNext, NextResult, ScanNext or ScanMap, or nil if there was none.
+//
+// This allows to tell whether the rows of a ResultSet ended normally or
+// because of an error, after a loop like this:
+//
+//	for {
+//		if hasRow, _ := rs.FetchNext(); !hasRow {
+//			break
+//		}
+//		...
+//	}
+//	if err := rs.Err(); err != nil {
+//		...
+//	}
+func (rs *ResultSet) Err() error {
+	return rs.err
 }
 
 // Close closes the ResultSet, so another query or command can be sent to
@@ -221,6 +331,14 @@ func (rs *ResultSet) IsNull(ord int) (isNull bool, err error) {
 	return
 }
 
+// CommandResults returns the results of the commands completed so far, one
+// for each SQL statement of the command the ResultSet belongs to, in order.
+func (rs *ResultSet) CommandResults() []CommandResult {
+	results := make([]CommandResult, len(rs.commandResults))
+	copy(results, rs.commandResults)
+	return results
+}
+
 // FieldCount returns the number of fields in the current result of the ResultSet.
 func (rs *ResultSet) FieldCount() int {
 	if rs.conn.LogLevel >= LogVerbose {
@@ -244,8 +362,9 @@ func (rs *ResultSet) Type(ord int) (typ Type, err error) {
 	err = rs.conn.withRecover("*ResultSet.Type", func() {
 		switch t := rs.fields[ord].typeOID; t {
 		case _BOOLOID, _CHAROID, _DATEOID, _FLOAT4OID, _FLOAT8OID, _INT2OID,
-			_INT4OID, _INT8OID, _NUMERICOID, _TEXTOID, _TIMEOID, _TIMETZOID,
-			_TIMESTAMPOID, _TIMESTAMPTZOID, _VARCHAROID:
+			_INT4OID, _INT8OID, _MACADDROID, _MACADDR8OID, _NAMEOID, _NUMERICOID,
+			_OIDOID, _TEXTOID, _TIMEOID, _TIMETZOID, _TIMESTAMPOID,
+			_TIMESTAMPTZOID, _VARCHAROID:
 			typ = Type(t)
 			return
 		}
@@ -256,6 +375,64 @@ func (rs *ResultSet) Type(ord int) (typ Type, err error) {
 	return
 }
 
+// FieldDescriptions returns the complete descriptions of all fields in the
+// current result of the ResultSet.
+func (rs *ResultSet) FieldDescriptions() []FieldDesc {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.FieldDescriptions"))
+	}
+
+	descs := make([]FieldDesc, len(rs.fields))
+	for i, f := range rs.fields {
+		descs[i] = FieldDesc{
+			Name:            f.name,
+			TableOID:        f.tableOID,
+			AttributeNumber: f.attNum,
+			TypeOID:         f.typeOID,
+			TypeSize:        f.typeSize,
+			TypeModifier:    f.typeMod,
+			Format:          int16(f.format),
+		}
+	}
+
+	return descs
+}
+
+// ScalarOID returns the OID of the data type of the single field in the
+// current result of the ResultSet, so generic code can choose how to decode
+// the value of a scalar query. An error is returned, if the result does not
+// have exactly one field.
+func (rs *ResultSet) ScalarOID() (oid int32, err error) {
+	err = rs.conn.withRecover("*ResultSet.ScalarOID", func() {
+		if len(rs.fields) != 1 {
+			panic(fmt.Errorf("result has %d fields, expected exactly one", len(rs.fields)))
+		}
+
+		oid = rs.fields[0].typeOID
+	})
+
+	return
+}
+
+// NumericScale returns the scale, i.e. the number of fractional digits, of
+// the numeric field with the specified ordinal, as declared by its type
+// modifier, e.g. 2 for numeric(10,2). This allows to format values scanned
+// into float64 correctly. -1 is returned, if the field is not of type numeric
+// or has no declared scale, like the result of most numeric expressions.
+func (rs *ResultSet) NumericScale(ord int) int {
+	if ord < 0 || ord >= len(rs.fields) {
+		return -1
+	}
+
+	f := rs.fields[ord]
+	if f.typeOID != _NUMERICOID || f.typeMod < 4 {
+		return -1
+	}
+
+	// The type modifier is ((precision << 16) | scale) + 4.
+	return int((f.typeMod - 4) & 0xffff)
+}
+
 // Ordinal returns the 0-based ordinal position of the field with the
 // specified name, or -1 if the ResultSet has no field with such a name.
 func (rs *ResultSet) Ordinal(name string) int {
@@ -285,7 +462,7 @@ func (rs *ResultSet) bool(ord int) (value, isNull bool) {
 
 	switch rs.fields[ord].format {
 	case textFormat:
-		value = val[0] == 't'
+		value = parseBool(string(val))
 
 	case binaryFormat:
 		value = val[0] != 0
@@ -294,6 +471,20 @@ func (rs *ResultSet) bool(ord int) (value, isNull bool) {
 	return
 }
 
+// parseBool parses the text representation of a boolean value, accepting all
+// forms PostgreSQL accepts as input.
+func parseBool(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "t", "true", "y", "yes", "on", "1":
+		return true
+
+	case "f", "false", "n", "no", "off", "0":
+		return false
+	}
+
+	panic(fmt.Sprintf("invalid boolean value: '%s'", s))
+}
+
 // Bool returns the value of the field with the specified ordinal as bool.
 func (rs *ResultSet) Bool(ord int) (value, isNull bool, err error) {
 	err = rs.conn.withRecover("*ResultSet.Bool", func() {
@@ -303,6 +494,248 @@ func (rs *ResultSet) Bool(ord int) (value, isNull bool, err error) {
 	return
 }
 
+func (rs *ResultSet) bytes(ord int) (value []byte, isNull bool) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.bytes"))
+	}
+
+	isNull = rs.isNull(ord)
+	if isNull {
+		return
+	}
+
+	val := rs.values[ord]
+
+	if rs.fields[ord].typeOID == _BYTEAOID && rs.fields[ord].format == textFormat {
+		value = parseBytea(val)
+		return
+	}
+
+	// The values of the row may be overwritten by the next one.
+	value = append([]byte{}, val...)
+
+	return
+}
+
+// fixedBytes decodes the value of the field with the specified ordinal into
+// dest, which must have exactly the length of the value, like [16]byte for
+// uuid fields. Text values of bytea fields in hex format and of uuid fields
+// are decoded without allocating memory, other values are copied as they
+// are. dest is zeroed for NULL.
+func (rs *ResultSet) fixedBytes(ord int, dest []byte) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.fixedBytes"))
+	}
+
+	if rs.isNull(ord) {
+		for i := range dest {
+			dest[i] = 0
+		}
+		return
+	}
+
+	f := rs.fields[ord]
+	val := rs.values[ord]
+
+	if f.format == textFormat {
+		switch f.typeOID {
+		case _BYTEAOID:
+			if !bytes.HasPrefix(val, []byte("\\x")) {
+				val = parseBytea(val)
+				break
+			}
+
+			val = val[2:]
+			if hex.DecodedLen(len(val)) != len(dest) {
+				panicFixedBytesLength(f.name, hex.DecodedLen(len(val)), len(dest))
+			}
+			_, err := hex.Decode(dest, val)
+			panicIfErr(err)
+			return
+
+		case _UUIDOID:
+			decodeUUID(f.name, val, dest)
+			return
+		}
+	}
+
+	if len(val) != len(dest) {
+		panicFixedBytesLength(f.name, len(val), len(dest))
+	}
+
+	copy(dest, val)
+}
+
+func panicFixedBytesLength(name string, have, want int) {
+	panic(fmt.Errorf("field '%s' has %d bytes, but the destination takes %d", name, have, want))
+}
+
+// decodeUUID decodes the text representation of a uuid, e.g.
+// a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11, into dest.
+func decodeUUID(name string, val, dest []byte) {
+	var digits [32]byte
+	n := 0
+	for _, c := range val {
+		if c == '-' || c == '{' || c == '}' {
+			continue
+		}
+		if n == len(digits) {
+			panic(fmt.Errorf("field '%s' is not a valid uuid: '%s'", name, val))
+		}
+		digits[n] = c
+		n++
+	}
+
+	if n/2 != len(dest) {
+		panicFixedBytesLength(name, n/2, len(dest))
+	}
+
+	_, err := hex.Decode(dest, digits[:n])
+	panicIfErr(err)
+}
+
+// parseBytea decodes the text representation of a bytea value, which is in
+// hex format, e.g. \x012f, or, before PostgreSQL 9.0, in escape format, e.g.
+// a\001\\.
+func parseBytea(s []byte) []byte {
+	if bytes.HasPrefix(s, []byte("\\x")) {
+		return appendBytea(make([]byte, 0, hex.DecodedLen(len(s)-2)), s)
+	}
+
+	return appendBytea(make([]byte, 0, len(s)), s)
+}
+
+// appendBytea appends the decoded text representation of a bytea value, as
+// described for parseBytea, to b and returns the extended slice.
+func appendBytea(b, s []byte) []byte {
+	if bytes.HasPrefix(s, []byte("\\x")) {
+		n := len(b)
+		b = append(b, make([]byte, hex.DecodedLen(len(s)-2))...)
+		_, err := hex.Decode(b[n:], s[2:])
+		panicIfErr(err)
+
+		return b
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b = append(b, s[i])
+			continue
+		}
+
+		if i+1 < len(s) && s[i+1] == '\\' {
+			b = append(b, '\\')
+			i++
+			continue
+		}
+
+		if i+3 >= len(s) {
+			panic(fmt.Sprintf("invalid bytea value: '%s'", s))
+		}
+		x, err := strconv.ParseUint(string(s[i+1:i+4]), 8, 8)
+		panicIfErr(err)
+
+		b = append(b, byte(x))
+		i += 3
+	}
+
+	return b
+}
+
+// Bytes returns the value of the field with the specified ordinal as []byte.
+//
+// Values of bytea fields are decoded, the raw text of other fields is
+// returned as it is.
+func (rs *ResultSet) Bytes(ord int) (value []byte, isNull bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.Bytes", func() {
+		value, isNull = rs.bytes(ord)
+	})
+
+	return
+}
+
+func (rs *ResultSet) appendValue(ord int, dst []byte) (value []byte, isNull bool) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.appendValue"))
+	}
+
+	isNull = rs.isNull(ord)
+	if isNull {
+		return dst, true
+	}
+
+	val := rs.values[ord]
+
+	if rs.fields[ord].typeOID == _BYTEAOID && rs.fields[ord].format == textFormat {
+		return appendBytea(dst, val), false
+	}
+
+	return append(dst, val...), false
+}
+
+// AppendValue appends the value of the field with the specified ordinal to dst
+// and returns the extended slice, like Bytes, but without allocating memory,
+// if dst has enough capacity. This allows to reuse a buffer for all rows.
+//
+// Values of bytea fields are decoded, the raw text of other fields is
+// appended as it is. For NULL, isNull is true and dst is returned unchanged.
+func (rs *ResultSet) AppendValue(ord int, dst []byte) (value []byte, isNull bool, err error) {
+	value = dst
+
+	err = rs.conn.withRecover("*ResultSet.AppendValue", func() {
+		value, isNull = rs.appendValue(ord, dst)
+	})
+
+	return
+}
+
+func (rs *ResultSet) fieldReader(ord int) (r io.Reader, isNull bool) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.fieldReader"))
+	}
+
+	isNull = rs.isNull(ord)
+	if isNull {
+		return
+	}
+
+	val := rs.values[ord]
+
+	if rs.fields[ord].typeOID == _BYTEAOID && rs.fields[ord].format == textFormat {
+		if bytes.HasPrefix(val, []byte("\\x")) {
+			// Decode while reading instead of materializing the value.
+			r = hex.NewDecoder(bytes.NewReader(val[2:]))
+		} else {
+			r = bytes.NewReader(parseBytea(val))
+		}
+		return
+	}
+
+	r = bytes.NewReader(val)
+
+	return
+}
+
+// FieldReader returns an io.Reader over the value of the field with the
+// specified ordinal, e.g. to stream a large text or bytea value to an HTTP
+// response. Values of bytea fields are decoded while reading, except for
+// values in the escape format used before PostgreSQL 9.0.
+//
+// The server sends each row in a single message, so the whole row has already
+// been read into memory when the reader is returned. The reader avoids
+// copying the value into another buffer, but does not reduce the memory
+// required for the row. To stream values that don't fit into memory, read
+// them in pieces, e.g. with substring() or as large objects.
+//
+// The reader is only valid until the next row is fetched.
+func (rs *ResultSet) FieldReader(ord int) (r io.Reader, isNull bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.FieldReader", func() {
+		r, isNull = rs.fieldReader(ord)
+	})
+
+	return
+}
+
 func (rs *ResultSet) float32(ord int) (value float32, isNull bool) {
 	if rs.conn.LogLevel >= LogVerbose {
 		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.float32"))
@@ -393,6 +826,41 @@ func (rs *ResultSet) Float64(ord int) (value float64, isNull bool, err error) {
 	return
 }
 
+func (rs *ResultSet) hardwareAddr(ord int) (value net.HardwareAddr, isNull bool) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.hardwareAddr"))
+	}
+
+	isNull = rs.isNull(ord)
+	if isNull {
+		return
+	}
+
+	val := rs.values[ord]
+
+	switch rs.fields[ord].format {
+	case textFormat:
+		var err error
+		value, err = net.ParseMAC(string(val))
+		panicIfErr(err)
+
+	case binaryFormat:
+		value = net.HardwareAddr(append([]byte(nil), val...))
+	}
+
+	return
+}
+
+// HardwareAddr returns the value of the field with the specified ordinal as
+// net.HardwareAddr, e.g. for macaddr and macaddr8 fields.
+func (rs *ResultSet) HardwareAddr(ord int) (value net.HardwareAddr, isNull bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.HardwareAddr", func() {
+		value, isNull = rs.hardwareAddr(ord)
+	})
+
+	return
+}
+
 func (rs *ResultSet) int16(ord int) (value int16, isNull bool) {
 	if rs.conn.LogLevel >= LogVerbose {
 		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.int16"))
@@ -496,6 +964,14 @@ func (rs *ResultSet) Int64(ord int) (value int64, isNull bool, err error) {
 }
 
 func (rs *ResultSet) int(ord int) (value int, isNull bool) {
+	if isOIDType(rs.fields[ord].typeOID) {
+		var val uint32
+		val, isNull = rs.uint32(ord)
+		value = int(val)
+
+		return
+	}
+
 	var val int32
 	val, isNull = rs.int32(ord)
 	value = int(val)
@@ -512,6 +988,53 @@ func (rs *ResultSet) Int(ord int) (value int, isNull bool, err error) {
 	return
 }
 
+func (rs *ResultSet) bigInt(ord int) (value *big.Int, isNull bool) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.bigInt"))
+	}
+
+	isNull = rs.isNull(ord)
+	if isNull {
+		return
+	}
+
+	f := rs.fields[ord]
+
+	switch f.format {
+	case textFormat:
+		val := string(rs.values[ord])
+
+		x, ok := new(big.Int).SetString(val, 10)
+		if !ok {
+			// A numeric with a scale, like 42.000.
+			r, ok := new(big.Rat).SetString(val)
+			if !ok || !r.IsInt() {
+				panic(fmt.Sprintf("field '%s' is not an integer: '%s'", f.name, val))
+			}
+			x = r.Num()
+		}
+		value = x
+
+	case binaryFormat:
+		var i int64
+		i, isNull = rs.int64(ord)
+		value = big.NewInt(i)
+	}
+
+	return
+}
+
+// BigInt returns the value of the field with the specified ordinal as
+// *big.Int, e.g. for numeric fields without fractional digits, which may
+// exceed the range of int64.
+func (rs *ResultSet) BigInt(ord int) (value *big.Int, isNull bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.BigInt", func() {
+		value, isNull = rs.bigInt(ord)
+	})
+
+	return
+}
+
 func (rs *ResultSet) rat(ord int) (value *big.Rat, isNull bool) {
 	if rs.conn.LogLevel >= LogVerbose {
 		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.rat"))
@@ -558,7 +1081,64 @@ func (rs *ResultSet) string(ord int) (value string, isNull bool) {
 		return
 	}
 
-	value = string(rs.values[ord])
+	val := rs.values[ord]
+
+	if rs.rawText {
+		value = string(val)
+		return
+	}
+
+	// The server sends "char" values >= 128 as backslash followed by three
+	// octal digits.
+	if rs.fields[ord].typeOID == _CHAROID && len(val) == 4 && val[0] == '\\' {
+		x, err := strconv.ParseUint(string(val[1:]), 8, 8)
+		panicIfErr(err)
+
+		value = string([]byte{byte(x)})
+		return
+	}
+
+	value = string(val)
+
+	return
+}
+
+// SetNullValue sets the value ScanMap stores for null fields, e.g. "\N" or
+// "NULL". The default is nil.
+func (rs *ResultSet) SetNullValue(v interface{}) {
+	rs.nullValue = v
+}
+
+// NullValue returns the value ScanMap stores for null fields.
+func (rs *ResultSet) NullValue() interface{} {
+	return rs.nullValue
+}
+
+// SetRawText sets if field values should be returned exactly as received
+// from the server.
+//
+// In raw text mode, Any, ScanMap and scanning into *interface{} return the
+// text the server sent for each field as string, without converting it to a
+// number, bool, time.Time etc. Scanning into typed destinations, like *int,
+// still converts the value.
+func (rs *ResultSet) SetRawText(rawText bool) {
+	rs.rawText = rawText
+}
+
+// RawText returns if the ResultSet is in raw text mode.
+func (rs *ResultSet) RawText() bool {
+	return rs.rawText
+}
+
+// Text returns the value of the field with the specified ordinal exactly as
+// received from the server, regardless of the raw text mode.
+func (rs *ResultSet) Text(ord int) (value string, isNull bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.Text", func() {
+		isNull = rs.isNull(ord)
+		if !isNull {
+			value = string(rs.values[ord])
+		}
+	})
 
 	return
 }
@@ -599,6 +1179,46 @@ func (rs *ResultSet) Time(ord int) (value time.Time, isNull bool, err error) {
 	return
 }
 
+func (rs *ResultSet) timeOfDay(ord int) (value TimeOfDay, isNull bool) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.timeOfDay"))
+	}
+
+	isNull = rs.isNull(ord)
+	if isNull {
+		return
+	}
+
+	switch rs.fields[ord].typeOID {
+	case _TIMEOID, _TIMETZOID:
+
+	default:
+		panic(fmt.Sprintf("field '%s' is not of type time or timetz, OID: %d", rs.fields[ord].name, rs.fields[ord].typeOID))
+	}
+
+	switch rs.fields[ord].format {
+	case textFormat:
+		var err error
+		value, err = parseTimeOfDay(string(rs.values[ord]))
+		panicIfErr(err)
+
+	case binaryFormat:
+		value = decodeBinaryTimeOfDay(rs.values[ord], rs.conn.integerDatetimes(), rs.fields[ord].typeOID == _TIMETZOID)
+	}
+
+	return
+}
+
+// TimeOfDay returns the value of the time or timetz field with the specified
+// ordinal as TimeOfDay.
+func (rs *ResultSet) TimeOfDay(ord int) (value TimeOfDay, isNull bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.TimeOfDay", func() {
+		value, isNull = rs.timeOfDay(ord)
+	})
+
+	return
+}
+
 func (rs *ResultSet) timeSeconds(ord int) (value int64, isNull bool) {
 	if rs.conn.LogLevel >= LogVerbose {
 		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.timeSeconds"))
@@ -659,7 +1279,21 @@ func (rs *ResultSet) timeSeconds(ord int) (value int64, isNull bool) {
 		panicIfErr(err)
 
 	case binaryFormat:
-		panicNotImplemented()
+		switch rs.fields[ord].typeOID {
+		case _DATEOID:
+			t = decodeBinaryDate(val)
+
+		case _TIMEOID, _TIMETZOID:
+			tod := decodeBinaryTimeOfDay(val, rs.conn.integerDatetimes(), rs.fields[ord].typeOID == _TIMETZOID)
+			// Like in text format, the time is on January 1st of year 0.
+			t = time.Date(0, 1, 1, tod.Hour, tod.Minute, tod.Second, 0, time.FixedZone("", tod.ZoneOffset))
+
+		case _TIMESTAMPOID, _TIMESTAMPTZOID:
+			t = decodeBinaryTimestamp(val, rs.conn.integerDatetimes())
+
+		default:
+			panicNotImplemented()
+		}
 	}
 
 	value = t.Unix()
@@ -710,7 +1344,34 @@ func (rs *ResultSet) Uint16(ord int) (value uint16, isNull bool, err error) {
 	return
 }
 
+func isOIDType(oid int32) bool {
+	switch oid {
+	case _OIDOID, _REGPROCOID, _REGPROCEDUREOID, _REGOPEROID, _REGOPERATOROID,
+		_REGCLASSOID, _REGTYPEOID, _REGCONFIGOID, _REGDICTIONARYOID:
+		return true
+	}
+
+	return false
+}
+
 func (rs *ResultSet) uint32(ord int) (value uint32, isNull bool) {
+	if rs.fields[ord].format == textFormat && isOIDType(rs.fields[ord].typeOID) {
+		isNull = rs.isNull(ord)
+		if isNull {
+			return
+		}
+
+		// OIDs are unsigned, so they may not fit into an int32. The reg*
+		// types are sent as names, unless the object does not exist.
+		x, err := strconv.ParseUint(string(rs.values[ord]), 10, 32)
+		if err != nil {
+			panic(fmt.Sprintf("field '%s': cannot convert '%s' to uint32, cast to oid in the query to get the numeric value",
+				rs.fields[ord].name, rs.values[ord]))
+		}
+		value = uint32(x)
+		return
+	}
+
 	var val int32
 	val, isNull = rs.int32(ord)
 	value = uint32(val)
@@ -750,11 +1411,64 @@ func (rs *ResultSet) any(ord int) (value interface{}, isNull bool) {
 		return
 	}
 
+	if rs.rawText && rs.fields[ord].format == textFormat {
+		value, isNull = rs.string(ord)
+		return
+	}
+
 	switch rs.fields[ord].typeOID {
 	case _BOOLOID:
 		value, isNull = rs.bool(ord)
 
-	case _BPCHAROID, _CHAROID, _VARCHAROID, _TEXTOID:
+	case _BPCHAROID, _CHAROID, _NAMEOID, _VARCHAROID, _TEXTOID:
+		value, isNull = rs.string(ord)
+
+	case _BOXOID, _UUIDOID, _JSONOID, _JSONBOID, _JSONPATHOID, _XMLOID,
+		_INETOID, _CIDROID:
+		value, isNull = rs.string(ord)
+
+	case _INTERVALOID:
+		if rs.fields[ord].format == binaryFormat {
+			value = decodeBinaryInterval(rs.values[ord], rs.conn.integerDatetimes())
+			break
+		}
+		value, isNull = rs.string(ord)
+
+	case _BYTEAOID:
+		value, isNull = rs.bytes(ord)
+
+	case _POINTOID:
+		value, isNull = rs.point(ord)
+
+	case _LSEGOID:
+		value, isNull = rs.lineSegment(ord)
+
+	case _PATHOID:
+		value, isNull = rs.path(ord)
+
+	case _POLYGONOID:
+		value, isNull = rs.polygon(ord)
+
+	case _CIRCLEOID:
+		value, isNull = rs.circle(ord)
+
+	case _TIDOID:
+		value, isNull = rs.tid(ord)
+
+	case _PG_LSNOID:
+		value, isNull = rs.lsn(ord)
+
+	case _INT2VECTOROID, _OIDVECTOROID:
+		value, isNull = rs.vector(ord)
+
+	case _MACADDROID, _MACADDR8OID:
+		value, isNull = rs.hardwareAddr(ord)
+
+	case _OIDOID:
+		value, isNull = rs.uint32(ord)
+
+	case _REGPROCOID, _REGPROCEDUREOID, _REGOPEROID, _REGOPERATOROID,
+		_REGCLASSOID, _REGTYPEOID, _REGCONFIGOID, _REGDICTIONARYOID:
 		value, isNull = rs.string(ord)
 
 	case _DATEOID, _TIMEOID, _TIMETZOID, _TIMESTAMPOID, _TIMESTAMPTZOID:
@@ -778,7 +1492,19 @@ func (rs *ResultSet) any(ord int) (value interface{}, isNull bool) {
 	case _NUMERICOID:
 		value, isNull = rs.rat(ord)
 
+	case _VOIDOID:
+		value = nil
+
 	default:
+		if isArrayType(rs.fields[ord].typeOID) {
+			value, isNull = rs.array(ord)
+			break
+		}
+		if isRangeType(rs.fields[ord].typeOID) {
+			value, isNull = rs.rangeValue(ord)
+			break
+		}
+
 		panic(fmt.Sprintf("unexpected field type: field: '%s' OID: %d", rs.fields[ord].name, rs.fields[ord].typeOID))
 	}
 
@@ -791,21 +1517,50 @@ func (rs *ResultSet) any(ord int) (value interface{}, isNull bool) {
 //
 //	PostgreSQL	Go
 //
+//	Array		[]interface{}
 //	Bigint		int64
 //	Boolean		bool
+//	Box		string
+//	Bytea		[]byte
 //	Char		string
-//	Date		int64
+//	Circle		Circle
+//	Date		time.Time
 //	Double		float64
+//	Inet, Cidr	string
 //	Integer		int
+//	Int2vector	[]int
+//	Interval	string
+//	JSON		string
+//	JSONB		string
+//	JSONPath	string
+//	Lseg		LineSegment
+//	MacAddr		net.HardwareAddr
+//	MacAddr8	net.HardwareAddr
+//	Name		string
 //	Numeric		*big.Rat
+//	Oid		uint32
+//	Oidvector	[]int
+//	Path		Path
+//	PgLSN		LSN
+//	Point		Point
+//	Polygon		Polygon
+//	Range		Range
 //	Real		float
+//	Reg*		string
 //	Smallint	int16
 //	Text		string
+//	TID		TID
 //	Time		time.Time
 //	TimeTZ		time.Time
 //	Timestamp	time.Time
 //	TimestampTZ	time.Time
+//	UUID		string
 //	Varchar		string
+//	Void		nil
+//	XML		string
+//
+// Null values are nil. Scanning into a *interface{} stores the same values.
+// Elements of arrays are mapped the same way, see Array.
 func (rs *ResultSet) Any(ord int) (value interface{}, isNull bool, err error) {
 	err = rs.conn.withRecover("*ResultSet.Any", func() {
 		value, isNull = rs.any(ord)
@@ -814,20 +1569,48 @@ func (rs *ResultSet) Any(ord int) (value interface{}, isNull bool, err error) {
 	return
 }
 
+func (rs *ResultSet) allFieldsVoid() bool {
+	for _, field := range rs.fields {
+		if field.typeOID != _VOIDOID {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (rs *ResultSet) scan(args ...interface{}) {
 	if rs.conn.LogLevel >= LogVerbose {
 		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.Scan"))
 	}
 
 	if len(args) != len(rs.fields) {
-		panic("wrong argument count")
+		// Rows of functions returning void have a single void field, which
+		// has no value worth scanning.
+		if len(args) != 0 || !rs.allFieldsVoid() {
+			panic("wrong argument count")
+		}
 	}
 
 	for i, arg := range args {
+		if arg == nil {
+			continue
+		}
+		if isArrayType(rs.fields[i].typeOID) && rs.scanArray(i, arg) {
+			continue
+		}
+		if a, ok := arg.(*[]int); ok && isVectorType(rs.fields[i].typeOID) {
+			*a, _ = rs.vector(i)
+			continue
+		}
+
 		switch a := arg.(type) {
 		case *bool:
 			*a, _ = rs.bool(i)
 
+		case *[]byte:
+			*a, _ = rs.bytes(i)
+
 		case *float32:
 			*a, _ = rs.float32(i)
 
@@ -855,6 +1638,14 @@ func (rs *ResultSet) scan(args ...interface{}) {
 		case *interface{}:
 			*a, _ = rs.any(i)
 
+		case *net.HardwareAddr:
+			*a, _ = rs.hardwareAddr(i)
+
+		case **big.Int:
+			var x *big.Int
+			x, _ = rs.bigInt(i)
+			*a = x
+
 		case **big.Rat:
 			var r *big.Rat
 			r, _ = rs.rat(i)
@@ -868,6 +1659,33 @@ func (rs *ResultSet) scan(args ...interface{}) {
 			t, _ = rs.time(i)
 			*a = t
 
+		case *TimeOfDay:
+			*a, _ = rs.timeOfDay(i)
+
+		case *Point:
+			*a, _ = rs.point(i)
+
+		case *LineSegment:
+			*a, _ = rs.lineSegment(i)
+
+		case *Path:
+			*a, _ = rs.path(i)
+
+		case *Polygon:
+			*a, _ = rs.polygon(i)
+
+		case *Circle:
+			*a, _ = rs.circle(i)
+
+		case *TID:
+			*a, _ = rs.tid(i)
+
+		case *LSN:
+			*a, _ = rs.lsn(i)
+
+		case *Range:
+			*a, _ = rs.rangeValue(i)
+
 		case *uint:
 			*a, _ = rs.uint(i)
 
@@ -887,6 +1705,15 @@ func (rs *ResultSet) scan(args ...interface{}) {
 			default:
 				*a, _ = rs.uint64(i)
 			}
+
+		case *[16]byte:
+			rs.fixedBytes(i, a[:])
+
+		default:
+			// Other fixed-size byte arrays.
+			if v := reflect.ValueOf(arg); v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Array && v.Elem().Type().Elem().Kind() == reflect.Uint8 {
+				rs.fixedBytes(i, v.Elem().Slice(0, v.Elem().Len()).Bytes())
+			}
 		}
 	}
 
@@ -896,7 +1723,13 @@ func (rs *ResultSet) scan(args ...interface{}) {
 // Scan scans the fields of the current row in the ResultSet, trying
 // to store field values into the specified arguments.
 //
-// The arguments must be of pointer types.
+// The arguments must be of pointer types. Array fields can be scanned into
+// pointers to slices of the types supported for scalar fields, like
+// *[]*big.Rat for numeric[] or *[]time.Time for timestamp[]. Rows without fields, or with void
+// fields only, as returned by functions returning void, can be scanned
+// without arguments. Fields with a nil argument are skipped. Fixed-size byte
+// arrays, like *[16]byte for uuid fields, receive the decoded value, which
+// must have exactly the size of the array.
 func (rs *ResultSet) Scan(args ...interface{}) (err error) {
 	err = rs.conn.withRecover("*ResultSet.Scan", func() {
 		rs.scan(args...)
@@ -930,3 +1763,171 @@ func (rs *ResultSet) ScanNext(args ...interface{}) (fetched bool, err error) {
 
 	return
 }
+
+func (rs *ResultSet) allMaps() (maps []map[string]interface{}) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.allMaps"))
+	}
+
+	maxRows := rs.conn.maxBufferedRows
+
+	for {
+		m := make(map[string]interface{}, len(rs.fields))
+		if !rs.scanMap(m) {
+			return
+		}
+
+		if maxRows > 0 && len(maps) == maxRows {
+			panic(fmt.Errorf("result exceeds the maximum of %d buffered rows, see *Conn.SetMaxBufferedRows", maxRows))
+		}
+
+		maps = append(maps, m)
+	}
+}
+
+// AllMaps reads all remaining rows of the current result and returns a map for
+// each, as described for ScanMap.
+//
+// To avoid exhausting memory, an error is returned if there are more rows
+// than the connection's MaxBufferedRows.
+func (rs *ResultSet) AllMaps() (maps []map[string]interface{}, err error) {
+	err = rs.conn.withRecover("*ResultSet.AllMaps", func() {
+		maps = rs.allMaps()
+	})
+
+	rs.setCompletedOnPgsqlError(err)
+
+	return
+}
+
+// ScanBuffer holds memory for the raw field values of a row, so it can be
+// reused for subsequent rows. The zero value is ready to use.
+type ScanBuffer struct {
+	data []byte
+}
+
+// scanScalar scans the single field of the single row of the ResultSet into
+// dest and closes the ResultSet.
+func (rs *ResultSet) scanScalar(dest interface{}) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.scanScalar"))
+	}
+
+	defer rs.close()
+
+	if !rs.fetchNext() {
+		panic(errors.New("query returned no rows, expected exactly one"))
+	}
+
+	if len(rs.fields) != 1 {
+		panic(fmt.Errorf("query returned %d fields, expected exactly one", len(rs.fields)))
+	}
+
+	rs.scan(dest)
+
+	if rs.fetchNext() {
+		panic(errors.New("query returned more than one row, expected exactly one"))
+	}
+}
+
+func (rs *ResultSet) scanNextInto(buf *ScanBuffer, args ...interface{}) (fetched bool) {
+	rs.scanBuffer = buf
+	defer func() {
+		rs.scanBuffer = nil
+	}()
+
+	return rs.scanNext(args...)
+}
+
+// ScanNextInto works like ScanNext, but reads the raw field values of the row
+// into buf, to avoid allocating memory for each row. Use the same buf for
+// all rows of a ResultSet.
+func (rs *ResultSet) ScanNextInto(buf *ScanBuffer, args ...interface{}) (fetched bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.ScanNextInto", func() {
+		fetched = rs.scanNextInto(buf, args...)
+	})
+
+	rs.setCompletedOnPgsqlError(err)
+
+	return
+}
+
+func (rs *ResultSet) scanMap(m map[string]interface{}) (fetched bool) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.scanMap"))
+	}
+
+	fetched = rs.fetchNext()
+	if !fetched {
+		return
+	}
+
+	for ord, field := range rs.fields {
+		value, isNull := rs.any(ord)
+		if isNull {
+			value = rs.nullValue
+		}
+
+		m[field.name] = value
+	}
+
+	return
+}
+
+// ScanMap reads the next row, if there is one, and stores the field values
+// into m, keyed by field name.
+//
+// Values are converted as described for Any, null values are stored as the
+// value set with SetNullValue, which is nil by default.
+// Entries of m that do not correspond to a field are left unchanged, so m can
+// be reused for all rows of a result. If a row has been fetched, fetched will
+// be true, otherwise false.
+func (rs *ResultSet) ScanMap(m map[string]interface{}) (fetched bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.ScanMap", func() {
+		fetched = rs.scanMap(m)
+	})
+
+	rs.setCompletedOnPgsqlError(err)
+
+	return
+}
+
+func (rs *ResultSet) scanNextGeneric() (values []interface{}, fetched bool) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.scanNextGeneric"))
+	}
+
+	fetched = rs.fetchNext()
+	if !fetched {
+		return
+	}
+
+	values = make([]interface{}, len(rs.fields))
+	for ord := range rs.fields {
+		value, isNull := rs.any(ord)
+		if isNull {
+			value = rs.nullValue
+		}
+
+		values[ord] = value
+	}
+
+	return
+}
+
+// ScanNextGeneric reads the next row, if there is one, and returns a newly
+// allocated slice with the field values in field order.
+//
+// Values are converted as described for Any, null values are returned as the
+// value set with SetNullValue, which is nil by default. Unlike ScanMap, this
+// keeps all values if several fields have the same name. If a row has been
+// fetched, fetched will be true, otherwise false.
+func (rs *ResultSet) ScanNextGeneric() (values []interface{}, fetched bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.ScanNextGeneric", func() {
+		values, fetched = rs.scanNextGeneric()
+	})
+
+	rs.setCompletedOnPgsqlError(err)
+
+	return
+}
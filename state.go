@@ -102,6 +102,13 @@ func (readyState) execute(stmt *Statement, rs *ResultSet) {
 		}
 	}()
 
+	if stmt.reparse {
+		conn.writeParse(stmt)
+
+		// ParseComplete
+		conn.readBackendMessages(nil)
+	}
+
 	conn.writeBind(stmt)
 
 	conn.readBackendMessages(rs)
@@ -127,11 +134,28 @@ func (readyState) prepare(stmt *Statement) {
 	}
 
 	conn.writeParse(stmt)
+	conn.writeDescribeStatement(stmt)
 
 	conn.onErrorDontRequireReadyForQuery = true
 	defer func() { conn.onErrorDontRequireReadyForQuery = false }()
 
+	// ParseComplete
 	conn.readBackendMessages(nil)
+
+	// The ParameterDescription tells us the parameter types the server
+	// expects, so writeBind can format values accordingly.
+	rs := newResultSet(conn)
+	rs.stmt = stmt
+
+	// ParameterDescription
+	conn.readBackendMessages(rs)
+
+	// RowDescription or NoData
+	conn.readBackendMessages(rs)
+
+	// NoData leaves rs.fields nil, while a RowDescription, even one without
+	// fields, does not.
+	stmt.returnsRows = rs.fields != nil
 }
 
 func (readyState) query(conn *Conn, rs *ResultSet, command string) {
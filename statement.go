@@ -6,12 +6,20 @@ package pgsql
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 var quoteRegExp = regexp.MustCompile("['][^']*[']")
 
+// opaqueRegExp matches the parts of a command that must not be searched for
+// parameter names: string literals, quoted identifiers and C-style comments.
+var opaqueRegExp = regexp.MustCompile(`(?s)'[^']*'|"[^"]*"|/\*.*?\*/`)
+
 // Statement is a means to efficiently execute a parameterized SQL command multiple times.
 //
 // Call *Conn.Prepare to create a new prepared Statement.
@@ -24,72 +32,387 @@ type Statement struct {
 	isClosed      bool
 	params        []*Parameter
 	name2param    map[string]*Parameter
+	paramTypeOIDs []int32
+	returnsRows   bool
+	shared        *sharedStatement
+	reparse       bool
+	autoClose     bool
+	commandEdits  [][]commandEdit
 }
 
-func replaceParameterNameInSubstring(s, old, new string, buf *bytes.Buffer, paramRegExp *regexp.Regexp) {
-	matchIndexPairs := paramRegExp.FindAllStringIndex(s, -1)
-	prevMatchEnd := 1
+// sharedStatement is a server-side prepared statement used by several
+// Statements, see *Conn.SetShareStatements.
+type sharedStatement struct {
+	key           string
+	name          string
+	refs          int
+	paramTypeOIDs []int32
+	returnsRows   bool
+}
 
-	for _, pair := range matchIndexPairs {
-		matchStart := pair[0]
-		matchEnd := pair[1]
+// shareKey returns the key under which the server-side prepared statement of
+// stmt can be shared with other Statements that have the same actual command
+// and parameter types.
+func (stmt *Statement) shareKey() string {
+	buf := bytes.NewBufferString(stmt.actualCommand)
 
-		buf.WriteString(s[prevMatchEnd-1 : matchStart+1])
-		buf.WriteString(new)
+	for _, p := range stmt.params {
+		fmt.Fprintf(buf, "\x00%d:%s", p.typ, p.customTypeName)
+	}
 
-		prevMatchEnd = matchEnd
+	return buf.String()
+}
+
+// paramDelimiters contains the characters that may precede or follow a
+// parameter name in a command, including those of operators like ->> or @>.
+const paramDelimiters = "- |\n\r\t,)(;=+/<>[]*%&!~^#?"
+
+func isParamDelimiter(c byte) bool {
+	return strings.IndexByte(paramDelimiters, c) != -1
+}
+
+// isParamTerminator returns if c may follow a parameter name. In addition to
+// the delimiters, this is ':', so casts like @filter::jsonb work. A ':' must
+// not precede a name though, otherwise the type name in x::name would be
+// mistaken for parameter :name.
+func isParamTerminator(c byte) bool {
+	return c == ':' || isParamDelimiter(c)
+}
+
+// commandEdit records the replacement of a parameter name by its $n form, so
+// positions in the adjusted command can be mapped back. pos is the offset of
+// the replacement in the adjusted command.
+type commandEdit struct {
+	pos    int
+	oldLen int
+	newLen int
+}
+
+// originalOffset maps the byte offset in a command adjusted by edits back to
+// the offset in the command before. Offsets within a replacement are mapped
+// to the start of the replaced name.
+func originalOffset(offset int, edits []commandEdit) int {
+	delta := 0
+
+	for _, e := range edits {
+		if offset < e.pos {
+			break
+		}
+		if offset < e.pos+e.newLen {
+			return e.pos - delta
+		}
+
+		delta += e.newLen - e.oldLen
 	}
 
-	if prevMatchEnd > 1 {
-		buf.WriteString(s[prevMatchEnd-1:])
-		return
+	return offset - delta
+}
+
+func replaceParameterNameInSubstring(s, old, new string, buf *bytes.Buffer, edits *[]commandEdit) {
+	// The name may be prefixed with either ':' or '@'.
+	name := old[1:]
+	prevMatchEnd := 0
+
+	for i := 1; i < len(s); i++ {
+		if c := s[i]; c != ':' && c != '@' {
+			continue
+		}
+		if !isParamDelimiter(s[i-1]) || !strings.HasPrefix(s[i+1:], name) {
+			continue
+		}
+
+		matchEnd := i + 1 + len(name)
+		if matchEnd < len(s) && !isParamTerminator(s[matchEnd]) {
+			continue
+		}
+
+		buf.WriteString(s[prevMatchEnd:i])
+		if edits != nil {
+			*edits = append(*edits, commandEdit{buf.Len(), matchEnd - i, len(new)})
+		}
+		buf.WriteString(new)
+
+		prevMatchEnd = matchEnd
+		i = matchEnd - 1
 	}
 
-	buf.WriteString(s)
+	buf.WriteString(s[prevMatchEnd:])
 }
 
 func replaceParameterName(command, old, new string) string {
-	paramRegExp := regexp.MustCompile("[\\- |\n\r\t,)(;=+/<>][:|@]" + old[1:] + "([\\- |\n\r\t,)(;=+/<>]|$)")
+	command, _ = replaceParameterNameWithEdits(command, old, new)
+
+	return command
+}
 
+// replaceParameterNameWithEdits works like replaceParameterName, but also
+// returns the replacements made.
+func replaceParameterNameWithEdits(command, old, new string) (string, []commandEdit) {
 	buf := bytes.NewBuffer(nil)
+	var edits []commandEdit
 
-	quoteIndexPairs := quoteRegExp.FindAllStringIndex(command, -1)
+	quoteIndexPairs := opaqueRegExp.FindAllStringIndex(command, -1)
 	prevQuoteEnd := 0
 
 	for _, pair := range quoteIndexPairs {
 		quoteStart := pair[0]
 		quoteEnd := pair[1]
 
-		replaceParameterNameInSubstring(command[prevQuoteEnd:quoteStart], old, new, buf, paramRegExp)
+		replaceParameterNameInSubstring(command[prevQuoteEnd:quoteStart], old, new, buf, &edits)
 		buf.WriteString(command[quoteStart:quoteEnd])
 
 		prevQuoteEnd = quoteEnd
 	}
 
-	if buf.Len() > 0 {
-		replaceParameterNameInSubstring(command[prevQuoteEnd:], old, new, buf, paramRegExp)
+	replaceParameterNameInSubstring(command[prevQuoteEnd:], old, new, buf, &edits)
+
+	return buf.String(), edits
+}
+
+// parameterNamesInSubstring appends the names of the parameters in s to names,
+// which are not yet in seen, applying the same rules as
+// replaceParameterNameInSubstring.
+func parameterNamesInSubstring(s string, names []string, seen map[string]bool) []string {
+	for i := 1; i < len(s); i++ {
+		if c := s[i]; c != ':' && c != '@' {
+			continue
+		}
+		if !isParamDelimiter(s[i-1]) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(s) && !isParamTerminator(s[end]) {
+			end++
+		}
+		if end == i+1 || !isIdentChar(s[i+1]) || s[i+1] == '$' {
+			continue
+		}
+
+		name := s[i+1 : end]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, s[i:end])
+		}
 
-		return buf.String()
+		i = end - 1
 	}
 
-	replaceParameterNameInSubstring(command, old, new, buf, paramRegExp)
+	return names
+}
 
-	return buf.String()
+// parameterNames returns the names of the parameters in command, including
+// their ':' or '@' prefix, in order of first appearance. String literals,
+// quoted identifiers and comments are skipped.
+func parameterNames(command string) (names []string) {
+	seen := make(map[string]bool)
+
+	quoteIndexPairs := opaqueRegExp.FindAllStringIndex(command, -1)
+	prevQuoteEnd := 0
+
+	for _, pair := range quoteIndexPairs {
+		names = parameterNamesInSubstring(command[prevQuoteEnd:pair[0]], names, seen)
+
+		prevQuoteEnd = pair[1]
+	}
+
+	return parameterNamesInSubstring(command[prevQuoteEnd:], names, seen)
 }
 
+// adjustCommand replaces each occurrence of a parameter name in command with
+// $n, where n is the 1-based position of the parameter in params. This is the
+// order writeBind sends the values in. For parameters with a custom type name,
+// a cast to that type follows, e.g. $1::jsonb, which binds more tightly than
+// any operator the parameter may be an operand of.
 func adjustCommand(command string, params []*Parameter) string {
+	return adjustCommandWithCasts(command, params, nil)
+}
+
+// adjustCommandWithCasts works like adjustCommand, but parameters without a
+// custom type name are cast to the type casts maps their name to, if any.
+func adjustCommandWithCasts(command string, params []*Parameter, casts map[string]string) string {
+	command, _ = adjustCommandWithEdits(command, params, casts)
+
+	return command
+}
+
+// adjustCommandWithEdits works like adjustCommandWithCasts, but also returns
+// the replacements made, one slice per parameter, in the order they were
+// applied.
+func adjustCommandWithEdits(command string, params []*Parameter, casts map[string]string) (string, [][]commandEdit) {
+	var passes [][]commandEdit
+
 	for i, p := range params {
 		var cast string
-		if p.customTypeName != "" {
-			cast = fmt.Sprintf("::%s", p.customTypeName)
+		if typeName := p.castTypeName(casts); typeName != "" {
+			cast = fmt.Sprintf("::%s", typeName)
 		}
-		command = replaceParameterName(command, p.name, fmt.Sprintf("$%d%s", i+1, cast))
+
+		var edits []commandEdit
+		command, edits = replaceParameterNameWithEdits(command, p.name, fmt.Sprintf("$%d%s", i+1, cast))
+		passes = append(passes, edits)
 	}
 
-	return command
+	return command, passes
+}
+
+// adjustCommand sets the actual command of stmt from its command and
+// parameters and keeps the replacements made, see *Error.OriginalPosition.
+func (stmt *Statement) adjustCommand(casts map[string]string) {
+	stmt.actualCommand, stmt.commandEdits = adjustCommandWithEdits(stmt.command, stmt.params, casts)
+}
+
+// originalOffset maps the byte offset in the actual command back to the
+// offset in the original command.
+func (stmt *Statement) originalOffset(offset int) int {
+	return stmt.originalOffsetOfPass(offset, len(stmt.commandEdits)-1)
+}
+
+// originalOffsetOfPass maps the byte offset in the command as adjusted up to
+// and including pass back to the offset in the original command.
+func (stmt *Statement) originalOffsetOfPass(offset, pass int) int {
+	for i := pass; i >= 0; i-- {
+		offset = originalOffset(offset, stmt.commandEdits[i])
+	}
+
+	return offset
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c >= 0x80
+}
+
+// closingQuote returns the index of the quote character q, which ends the
+// literal or quoted identifier starting at s[start:], or -1, if there is none.
+// A doubled quote character stands for itself and doesn't end it. If escapes
+// is true, neither do quote characters escaped with a backslash.
+func closingQuote(s string, start int, q byte, escapes bool) int {
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if escapes {
+				i++
+			}
+
+		case q:
+			if i+1 < len(s) && s[i+1] == q {
+				i++
+				continue
+			}
+
+			return i
+		}
+	}
+
+	return -1
 }
 
-func newStatement(conn *Conn, command string, params []*Parameter) *Statement {
+// positionalParamRefs returns the numbers n of all $n references in command,
+// ignoring string literals, quoted identifiers, comments and dollar-quoted
+// strings, like function bodies.
+func positionalParamRefs(command string) (refs []int) {
+	for _, ref := range positionalParamRefSpans(command) {
+		refs = append(refs, ref.n)
+	}
+
+	return
+}
+
+// paramRef is a $n reference in a command, which spans command[pos:end].
+type paramRef struct {
+	n   int
+	pos int
+	end int
+}
+
+// positionalParamRefSpans works like positionalParamRefs, but also returns
+// where the references are located in command.
+func positionalParamRefSpans(command string) (refs []paramRef) {
+	s := command
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'' || c == '"':
+			// In escape string literals like E'it\'s', a backslash
+			// escapes the next character.
+			escapes := c == '\'' && i > 0 && (s[i-1] == 'E' || s[i-1] == 'e') && (i == 1 || !isIdentChar(s[i-2]))
+
+			if end := closingQuote(s, i+1, c, escapes); end != -1 {
+				i = end
+			} else {
+				return
+			}
+
+		case strings.HasPrefix(s[i:], "--"):
+			if end := strings.IndexByte(s[i:], '\n'); end != -1 {
+				i += end
+			} else {
+				return
+			}
+
+		case strings.HasPrefix(s[i:], "/*"):
+			if end := strings.Index(s[i+2:], "*/"); end != -1 {
+				i += 2 + end + 1
+			} else {
+				return
+			}
+
+		case c == '$':
+			if i > 0 && isIdentChar(s[i-1]) {
+				// Part of an identifier.
+				continue
+			}
+
+			j := i + 1
+			for j < len(s) && '0' <= s[j] && s[j] <= '9' {
+				j++
+			}
+			if j > i+1 {
+				n, _ := strconv.Atoi(s[i+1 : j])
+				refs = append(refs, paramRef{n: n, pos: i, end: j})
+				i = j - 1
+				continue
+			}
+
+			// Maybe a dollar quote like $$ or $body$.
+			for j < len(s) && isIdentChar(s[j]) && s[j] != '$' {
+				j++
+			}
+			if j < len(s) && s[j] == '$' {
+				tag := s[i : j+1]
+				if end := strings.Index(s[j+1:], tag); end != -1 {
+					i = j + 1 + end + len(tag) - 1
+				} else {
+					return
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// checkParameters panics, if the actual command references a $n without a
+// corresponding parameter, or if a parameter does not appear in the command.
+func (stmt *Statement) checkParameters() {
+	used := make([]bool, len(stmt.params))
+
+	for _, n := range positionalParamRefs(stmt.actualCommand) {
+		if n < 1 || n > len(stmt.params) {
+			panic(fmt.Errorf("command references $%d, but %d parameters supplied", n, len(stmt.params)))
+		}
+
+		used[n-1] = true
+	}
+
+	for i, p := range stmt.params {
+		if !used[i] {
+			panic(fmt.Errorf("parameter %s does not appear in the command", p.name))
+		}
+	}
+}
+
+func newStatement(conn *Conn, command string, params []*Parameter, unnamed bool) *Statement {
 	if conn.LogLevel >= LogDebug {
 		defer conn.logExit(conn.logEnter("newStatement"))
 	}
@@ -112,14 +435,19 @@ func newStatement(conn *Conn, command string, params []*Parameter) *Statement {
 
 	stmt.conn = conn
 
-	stmt.name = fmt.Sprint("stmt", conn.nextStatementId)
-	conn.nextStatementId++
+	// The unnamed statement and portal (empty names) are discarded by the
+	// server as soon as another unnamed statement is prepared, so there is
+	// nothing to clean up after a one-shot query.
+	if !unnamed {
+		stmt.name = fmt.Sprint("stmt", conn.nextStatementId)
+		conn.nextStatementId++
 
-	stmt.portalName = fmt.Sprint("prtl", conn.nextPortalId)
-	conn.nextPortalId++
+		stmt.portalName = fmt.Sprint("prtl", conn.nextPortalId)
+		conn.nextPortalId++
+	}
 
 	stmt.command = command
-	stmt.actualCommand = adjustCommand(command, params)
+	stmt.actualCommand = command
 
 	stmt.params = make([]*Parameter, len(params))
 	copy(stmt.params, params)
@@ -132,6 +460,19 @@ func (stmt *Statement) Conn() *Conn {
 	return stmt.conn
 }
 
+// Name returns the name of the prepared statement on the server, as it
+// appears e.g. in server logs and pg_prepared_statements. It is empty for
+// unnamed statements.
+func (stmt *Statement) Name() string {
+	return stmt.name
+}
+
+// PortalName returns the name of the portal the Statement is executed in on
+// the server. It is empty for unnamed statements.
+func (stmt *Statement) PortalName() string {
+	return stmt.portalName
+}
+
 // Parameter returns the Parameter with the specified name or nil, if the Statement has no Parameter with that name.
 func (stmt *Statement) Parameter(name string) *Parameter {
 	conn := stmt.conn
@@ -148,6 +489,37 @@ func (stmt *Statement) Parameter(name string) *Parameter {
 	return param
 }
 
+func (stmt *Statement) bind(name string, value interface{}) {
+	p, ok := stmt.name2param[name]
+	if !ok {
+		panic(fmt.Errorf("statement has no parameter %s", name))
+	}
+
+	panicIfErr(p.SetValue(value))
+}
+
+// Bind sets the value of the parameter with the specified name. Unlike
+// setting the value of the Parameter returned by *Statement.Parameter, it
+// returns an error, if the Statement has no such parameter, e.g. because of a
+// typo in name.
+func (stmt *Statement) Bind(name string, value interface{}) (err error) {
+	err = stmt.conn.withRecover("*Statement.Bind", func() {
+		stmt.bind(name, value)
+	})
+
+	return
+}
+
+// checkValuesSet panics, if a parameter has not been set, so it would be
+// sent as NULL by mistake.
+func (stmt *Statement) checkValuesSet() {
+	for _, p := range stmt.params {
+		if !p.isSet {
+			panic(fmt.Errorf("parameter %s has not been set", p.name))
+		}
+	}
+}
+
 // Parameters returns a slice containing the parameters of the Statement.
 func (stmt *Statement) Parameters() []*Parameter {
 	conn := stmt.conn
@@ -161,6 +533,69 @@ func (stmt *Statement) Parameters() []*Parameter {
 	return params
 }
 
+// ParametersInOrder returns a slice containing the parameters of the
+// Statement in the order of their first occurrence in the command, unlike
+// Parameters, which returns them in the order they were supplied.
+func (stmt *Statement) ParametersInOrder() []*Parameter {
+	conn := stmt.conn
+
+	if conn.LogLevel >= LogVerbose {
+		defer conn.logExit(conn.logEnter("*Statement.ParametersInOrder"))
+	}
+
+	params := stmt.Parameters()
+	if len(stmt.commandEdits) != len(params) {
+		// Positional parameters, which are in order already.
+		return params
+	}
+
+	first := make(map[*Parameter]int, len(params))
+	for i, p := range params {
+		if edits := stmt.commandEdits[i]; len(edits) > 0 {
+			first[p] = stmt.originalOffsetOfPass(edits[0].pos, i)
+		}
+	}
+
+	sort.Stable(paramsByOffset{params, first})
+
+	return params
+}
+
+// paramsByOffset sorts parameters by the offsets of their first occurrence
+// in the command.
+type paramsByOffset struct {
+	params []*Parameter
+	first  map[*Parameter]int
+}
+
+func (p paramsByOffset) Len() int {
+	return len(p.params)
+}
+
+func (p paramsByOffset) Less(i, j int) bool {
+	return p.first[p.params[i]] < p.first[p.params[j]]
+}
+
+func (p paramsByOffset) Swap(i, j int) {
+	p.params[i], p.params[j] = p.params[j], p.params[i]
+}
+
+// ReturnsRows returns if executing the Statement produces rows, which is the
+// case for queries, but not for commands like UPDATE without RETURNING, for
+// which the server responds to the Describe with NoData.
+func (stmt *Statement) ReturnsRows() bool {
+	return stmt.returnsRows
+}
+
+// SetAutoClose controls whether the Statement is closed automatically, when
+// the ResultSet of its next execution is closed, e.g. for a Statement that is
+// prepared to be executed only once. This includes the ResultSets closed by
+// Execute and Scan. By default, Statements remain open until Close is called,
+// so they can be executed again.
+func (stmt *Statement) SetAutoClose(autoClose bool) {
+	stmt.autoClose = autoClose
+}
+
 // IsClosed returns if the Statement has been closed.
 func (stmt *Statement) IsClosed() bool {
 	conn := stmt.conn
@@ -179,9 +614,29 @@ func (stmt *Statement) close() {
 		defer conn.logExit(conn.logEnter("*Statement.close"))
 	}
 
-	stmt.conn.writeClose('S', stmt.name)
+	switch ss := stmt.shared; {
+	case stmt.reparse:
+		// The unnamed statement may well belong to another Statement by
+		// now, so there is nothing to close.
+
+	case ss != nil:
+		if stmt.isClosed {
+			return
+		}
+
+		// Only the last Statement deallocates the prepared statement.
+		ss.refs--
+		if ss.refs == 0 {
+			stmt.conn.writeClose('S', stmt.name)
+			delete(conn.sharedStatements, ss.key)
+		}
+
+	default:
+		stmt.conn.writeClose('S', stmt.name)
+	}
 
 	stmt.isClosed = true
+	delete(conn.statements, stmt)
 	return
 }
 
@@ -199,7 +654,7 @@ func (stmt *Statement) Close() (err error) {
 // The original command is automatically adjusted if it contains parameters so
 // it complies with what PostgreSQL expects. Refer to the return value of this
 // method to make sense of the position information contained in many error
-// messages.
+// messages, or use *Error.OriginalPosition.
 func (stmt *Statement) ActualCommand() string {
 	conn := stmt.conn
 
@@ -221,6 +676,100 @@ func (stmt *Statement) Command() string {
 	return stmt.command
 }
 
+// isNumberLiteral returns if s, the text representation of a parameter value
+// of type typ, can be inlined into a command as a numeric constant.
+func isNumberLiteral(typ Type, s string) bool {
+	switch typ {
+	case Smallint, Integer, Bigint, Oid, Real, Double, Numeric:
+	default:
+		return false
+	}
+
+	digits := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case '0' <= c && c <= '9':
+			digits = true
+
+		case c == '.' || c == 'e' || c == 'E' || (c == '-' || c == '+') && (i == 0 || s[i-1] == 'e' || s[i-1] == 'E'):
+
+		default:
+			return false
+		}
+	}
+
+	return digits
+}
+
+func (stmt *Statement) renderSQL() string {
+	conn := stmt.conn
+
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Statement.renderSQL"))
+	}
+
+	stmt.checkValuesSet()
+
+	command := stmt.actualCommand
+	buf := bytes.NewBuffer(nil)
+	prevEnd := 0
+
+	for _, ref := range positionalParamRefSpans(command) {
+		if ref.n < 1 || ref.n > len(stmt.params) {
+			panic(fmt.Errorf("command references $%d, but %d parameters supplied", ref.n, len(stmt.params)))
+		}
+
+		buf.WriteString(command[prevEnd:ref.pos])
+		prevEnd = ref.end
+
+		typ, s, isNull := conn.formatParam(stmt, ref.n-1)
+
+		switch {
+		case isNull:
+			buf.WriteString("NULL")
+
+		case isNumberLiteral(typ, s):
+			if s[0] == '-' {
+				// Avoid turning e.g. 1-$1 into a comment.
+				s = "(" + s + ")"
+			}
+			buf.WriteString(s)
+			continue
+
+		default:
+			buf.WriteString(quoteLiteral(s))
+		}
+
+		// Keep the type the server would have used for the parameter,
+		// unless the command casts it anyway.
+		if name, ok := sqlTypeNames[typ]; ok && !strings.HasPrefix(command[ref.end:], "::") {
+			buf.WriteString("::")
+			buf.WriteString(name)
+		}
+	}
+
+	buf.WriteString(command[prevEnd:])
+
+	return buf.String()
+}
+
+// RenderSQL returns the actual command with the current parameter values
+// inlined as SQL literals, so it can be run on its own, e.g. in psql, to
+// reproduce the results of the Statement.
+//
+// Values are formatted as they are sent to the server when the Statement is
+// executed. Strings and other non-numeric values, including bytea, are
+// inlined as properly escaped string literals, NULL values as NULL. Unless
+// the command casts a parameter explicitly, the literal is cast to the type
+// of the parameter, if it is known.
+func (stmt *Statement) RenderSQL() (sql string, err error) {
+	err = stmt.conn.withRecover("*Statement.RenderSQL", func() {
+		sql = stmt.renderSQL()
+	})
+
+	return
+}
+
 func (stmt *Statement) query() (rs *ResultSet) {
 	conn := stmt.conn
 
@@ -228,6 +777,8 @@ func (stmt *Statement) query() (rs *ResultSet) {
 		defer conn.logExit(conn.logEnter("*Statement.query"))
 	}
 
+	stmt.checkValuesSet()
+
 	if conn.LogLevel >= LogCommand {
 		buf := bytes.NewBuffer(nil)
 
@@ -239,7 +790,11 @@ func (stmt *Statement) query() (rs *ResultSet) {
 		buf.WriteString("Parameters:\n")
 
 		for i, p := range stmt.params {
-			buf.WriteString(fmt.Sprintf("$%d (%s) = '%v'\n", i+1, p.name, p.value))
+			if conn.logRedaction {
+				buf.WriteString(fmt.Sprintf("$%d (%s) = <redacted>\n", i+1, p.name))
+			} else {
+				buf.WriteString(fmt.Sprintf("$%d (%s) = '%v'\n", i+1, p.name, p.value))
+			}
 		}
 
 		buf.WriteString("=================================================\n")
@@ -248,14 +803,134 @@ func (stmt *Statement) query() (rs *ResultSet) {
 	}
 
 	r := newResultSet(conn)
+	r.command = stmt.command
+	if stmt.autoClose {
+		r.autoCloseStmt = stmt
+	}
 
-	conn.state.execute(stmt, r)
+	stmt.executeRefreshingStalePlan(r)
 
 	rs = r
 
 	return
 }
 
+// isStalePlanError returns if err has been raised, because the result type of
+// a prepared statement changed since it was prepared, e.g. by ALTER TABLE.
+//
+// The message may be translated, so the error is recognized by the routine
+// raising it. The message is only checked, if the server did not report one.
+func isStalePlanError(err error) bool {
+	pgErr, ok := err.(*Error)
+	if !ok || pgErr.Code() != "0A000" {
+		return false
+	}
+
+	if routine := pgErr.Routine(); routine != "" {
+		return routine == "RevalidateCachedQuery"
+	}
+
+	return strings.Contains(pgErr.Message(), "cached plan must not change result type")
+}
+
+// executeRefreshingStalePlan executes stmt like conn.state.execute, but if
+// the server rejects the prepared statement, because its result type changed,
+// refreshes it and executes it once more. This is only done outside of
+// transactions, since the failure aborts a transaction in progress.
+func (stmt *Statement) executeRefreshingStalePlan(rs *ResultSet) {
+	conn := stmt.conn
+
+	if stmt.reparse {
+		// Parsed again anyway.
+		conn.state.execute(stmt, rs)
+		return
+	}
+
+	stale := false
+	func() {
+		defer func() {
+			if x := recover(); x != nil {
+				if err, ok := x.(error); ok && isStalePlanError(err) &&
+					conn.transactionStatus == NotInTransaction && conn.state.code() == StatusReady {
+
+					stale = true
+					return
+				}
+
+				panic(x)
+			}
+		}()
+
+		conn.state.execute(stmt, rs)
+	}()
+
+	if !stale {
+		return
+	}
+
+	if conn.LogLevel >= LogWarning {
+		conn.logf(LogWarning, "result type of prepared statement '%s' changed, preparing it again", stmt.name)
+	}
+
+	stmt.refresh()
+
+	conn.state.execute(stmt, rs)
+}
+
+func (stmt *Statement) refresh() {
+	conn := stmt.conn
+
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Statement.refresh"))
+	}
+
+	if stmt.isClosed {
+		panic(errors.New("statement is closed"))
+	}
+
+	if stmt.reparse {
+		// Parsed again anyway, each time it is executed.
+		return
+	}
+
+	if stateCode := conn.state.code(); stateCode != StatusReady {
+		panic("wrong state, expected: StatusReady, have: " + stateCode.String())
+	}
+
+	conn.writeClose('S', stmt.name)
+	conn.state.prepare(stmt)
+
+	if ss := stmt.shared; ss != nil {
+		ss.paramTypeOIDs = stmt.paramTypeOIDs
+		ss.returnsRows = stmt.returnsRows
+
+		for other := range conn.statements {
+			if other.shared == ss {
+				other.paramTypeOIDs = ss.paramTypeOIDs
+				other.returnsRows = ss.returnsRows
+			}
+		}
+	}
+}
+
+// Refresh closes the server-side prepared statement of the Statement and
+// prepares it again with the same command and parameters, so the server plans
+// it for the current schema, e.g. after a column of a table it selects from
+// has been added or dropped. Parameter values are kept. Statements sharing
+// the prepared statement, see *Conn.SetShareStatements, are refreshed as well.
+//
+// While not in a transaction, Query and the methods built on it refresh the
+// Statement automatically and execute it once more, if the server reports
+// that its result type changed. In a transaction, the error is returned
+// instead, since the transaction is aborted by then.
+func (stmt *Statement) Refresh() (err error) {
+	err = stmt.conn.withRecover("*Statement.Refresh", func() {
+		stmt.refresh()
+	})
+
+	return
+}
+
 // Query executes the Statement and returns a
 // ResultSet for row-by-row retrieval of the results.
 //
@@ -269,6 +944,165 @@ func (stmt *Statement) Query() (rs *ResultSet, err error) {
 	return
 }
 
+func (stmt *Statement) queryArgs(args ...interface{}) *ResultSet {
+	if stmt.conn.LogLevel >= LogDebug {
+		defer stmt.conn.logExit(stmt.conn.logEnter("*Statement.queryArgs"))
+	}
+
+	stmt.setArgs(args)
+
+	return stmt.query()
+}
+
+// setArgs sets the values of the parameters to args.
+func (stmt *Statement) setArgs(args []interface{}) {
+	if len(args) != len(stmt.params) {
+		panic(fmt.Errorf("wrong argument count, expected: %d, have: %d", len(stmt.params), len(args)))
+	}
+
+	for i, p := range stmt.params {
+		panicIfErr(p.SetValue(args[i]))
+	}
+}
+
+// QueryArgs sets the values of the parameters of the Statement to args, in
+// the order the parameters were passed when preparing it, then executes the
+// Statement and returns a ResultSet for row-by-row retrieval of the results.
+//
+// The number of args must match the number of parameters. The values remain
+// set after the call.
+//
+// The returned ResultSet must be closed before sending another
+// query or command to the server over the same connection.
+func (stmt *Statement) QueryArgs(args ...interface{}) (rs *ResultSet, err error) {
+	err = stmt.conn.withRecover("*Statement.QueryArgs", func() {
+		rs = stmt.queryArgs(args...)
+	})
+
+	return
+}
+
+func (stmt *Statement) queryInSchema(schema string, args ...interface{}) (rs *ResultSet) {
+	conn := stmt.conn
+
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Statement.queryInSchema"))
+	}
+
+	if len(args) > 0 {
+		stmt.setArgs(args)
+	}
+
+	searchPath := NewParameter("@search_path", Text)
+	panicIfErr(searchPath.SetValue(schema))
+
+	p := conn.Pipeline()
+	panicIfErr(p.Execute("SELECT set_config('search_path', @search_path, true);", searchPath))
+
+	// The set_config replaces the unnamed statement, so an unnamed Statement
+	// must be parsed again.
+	if stmt.name == "" && !stmt.reparse {
+		stmt.reparse = true
+		defer func() {
+			stmt.reparse = false
+		}()
+	}
+
+	// Without a Sync, the set_config and the Statement are executed in the
+	// same implicit transaction, to which the setting is local.
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			conn.writeSync()
+
+			conn.readBackendMessages(nil)
+		}
+	}()
+
+	p.send()
+
+	succeeded = true
+
+	return stmt.query()
+}
+
+// QueryInSchema executes the Statement with search_path set to schema and
+// returns a ResultSet for row-by-row retrieval of the results, like
+// QueryArgs does, if args are given, or Query otherwise.
+//
+// schema is used as the value of search_path as it is, so it may list
+// several schemas, e.g. "tenant_42, public", which must be quoted as
+// required. The setting is local to the implicit transaction the Statement
+// is executed in, so it does not affect later commands. If a transaction is
+// in progress, the setting lasts until the transaction ends, like one made
+// by SET LOCAL.
+//
+// The returned ResultSet must be closed before sending another
+// query or command to the server over the same connection.
+func (stmt *Statement) QueryInSchema(schema string, args ...interface{}) (rs *ResultSet, err error) {
+	err = stmt.conn.withRecover("*Statement.QueryInSchema", func() {
+		rs = stmt.queryInSchema(schema, args...)
+	})
+
+	return
+}
+
+// errCanceled is returned by QueryWithCancel, if done fired before the
+// Statement was executed.
+var errCanceled = errors.New("query canceled")
+
+func (stmt *Statement) queryWithCancel(done <-chan bool, args ...interface{}) *ResultSet {
+	conn := stmt.conn
+
+	if conn.LogLevel >= LogDebug {
+		defer conn.logExit(conn.logEnter("*Statement.queryWithCancel"))
+	}
+
+	select {
+	case <-done:
+		panic(errCanceled)
+
+	default:
+	}
+
+	if len(args) > 0 {
+		stmt.setArgs(args)
+	}
+
+	stop := conn.watchCancel(done)
+
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			stop()
+		}
+	}()
+
+	rs := stmt.query()
+	rs.stopCancelWatch = stop
+
+	succeeded = true
+
+	return rs
+}
+
+// QueryWithCancel executes the Statement like QueryArgs does, if args are
+// given, or Query otherwise, but cancels it, if done receives a value or is
+// closed before the returned ResultSet is closed, e.g. when the client of a
+// request handler went away.
+//
+// Cancellation works like Cancel, so the server reports an error for the
+// canceled command, unless it completed already. If done fired before, the
+// Statement is not executed at all. The goroutine watching done ends when
+// the ResultSet is closed or an error is returned.
+func (stmt *Statement) QueryWithCancel(done <-chan bool, args ...interface{}) (rs *ResultSet, err error) {
+	err = stmt.conn.withRecover("*Statement.QueryWithCancel", func() {
+		rs = stmt.queryWithCancel(done, args...)
+	})
+
+	return
+}
+
 func (stmt *Statement) execute() (rowsAffected int64) {
 	conn := stmt.conn
 
@@ -322,3 +1156,17 @@ func (stmt *Statement) Scan(args ...interface{}) (fetched bool, err error) {
 
 	return
 }
+
+// ScanScalar executes the statement and scans the single field of the single
+// row it returns into dest, which must be of a pointer type, e.g. for
+// SELECT count(*) queries.
+//
+// An error is returned, if the statement does not return exactly one row with
+// exactly one field.
+func (stmt *Statement) ScanScalar(dest interface{}) (err error) {
+	err = stmt.conn.withRecover("*Statement.ScanScalar", func() {
+		stmt.query().scanScalar(dest)
+	})
+
+	return
+}
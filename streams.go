@@ -0,0 +1,124 @@
+// Copyright 2013 The go-pgsql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgsql
+
+import (
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"time"
+)
+
+// streamConn adapts a reader and a writer to net.Conn. Deadlines are not
+// supported and silently ignored.
+type streamConn struct {
+	io.Reader
+	io.Writer
+}
+
+func (c streamConn) Close() (err error) {
+	if closer, ok := c.Reader.(io.Closer); ok {
+		err = closer.Close()
+	}
+	if closer, ok := c.Writer.(io.Closer); ok && !c.sameReaderAndWriter() {
+		if e := closer.Close(); err == nil {
+			err = e
+		}
+	}
+
+	return
+}
+
+func (c streamConn) sameReaderAndWriter() bool {
+	// Comparing interface values panics for uncomparable dynamic types.
+	t := reflect.TypeOf(c.Reader)
+	if t != reflect.TypeOf(c.Writer) || !t.Comparable() {
+		return false
+	}
+
+	return interface{}(c.Reader) == interface{}(c.Writer)
+}
+
+func (streamConn) LocalAddr() net.Addr                { return streamAddr{} }
+func (streamConn) RemoteAddr() net.Addr               { return streamAddr{} }
+func (streamConn) SetDeadline(t time.Time) error      { return nil }
+func (streamConn) SetReadDeadline(t time.Time) error  { return nil }
+func (streamConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type streamAddr struct{}
+
+func (streamAddr) Network() string { return "stream" }
+func (streamAddr) String() string  { return "stream" }
+
+// NewConnFromStreams returns a new connection, which reads messages from the
+// server from r and writes messages to the server to w, instead of dialing a
+// server. This is mainly useful for tests, which can feed canned server
+// responses, e.g. recorded from a real session, to r.
+//
+// The startup is performed as usual, so r has to provide the messages the
+// server sends for it, at least AuthenticationOk and ReadyForQuery. params
+// may be nil. Host and port are not used and the connection can't be
+// reconnected or cloned. If r or w implement io.Closer, they are closed when the
+// connection is closed.
+func NewConnFromStreams(r io.Reader, w io.Writer, params *ConnParams, logLevel LogLevel) (conn *Conn, err error) {
+	var p ConnParams
+	if params != nil {
+		p = *params
+	}
+	p.Host, p.Port = "stream", 0
+
+	return newConnFromNetConn("NewConnFromStreams", streamConn{r, w}, &p, logLevel)
+}
+
+// NewConnFromNetConn returns a new connection, which performs the startup
+// over nc instead of dialing a server, e.g. to connect through an SSH tunnel
+// or a SOCKS proxy.
+//
+// params may be nil. Host and port are only used to look up the password in
+// the password file. The connection takes ownership of nc, which is closed
+// when the connection is closed, and can't be reconnected or cloned. Cancel
+// is not supported, because its separate network connection can't be
+// established.
+func NewConnFromNetConn(nc net.Conn, params *ConnParams, logLevel LogLevel) (conn *Conn, err error) {
+	var p ConnParams
+	if params != nil {
+		p = *params
+	}
+
+	return newConnFromNetConn("NewConnFromNetConn", nc, &p, logLevel)
+}
+
+func newConnFromNetConn(funcName string, nc net.Conn, params *ConnParams, logLevel LogLevel) (conn *Conn, err error) {
+	newConn := &Conn{}
+
+	newConn.LogLevel = logLevel
+
+	if newConn.LogLevel >= LogDebug {
+		defer newConn.logExit(newConn.logEnter(funcName))
+	}
+
+	defer func() {
+		if x := recover(); x != nil {
+			err = newConn.logAndConvertPanic(x)
+		}
+	}()
+
+	used := false
+	newConn.dial = func() (net.Conn, error) {
+		if used {
+			return nil, errors.New("cannot reconnect a connection created from an existing network connection or streams")
+		}
+		used = true
+
+		return nc, nil
+	}
+
+	newConn.connectParams(params)
+
+	conn = newConn
+
+	return
+}
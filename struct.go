@@ -0,0 +1,279 @@
+// Copyright 2013 The go-pgsql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgsql
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// scalarStructTypes contains the struct types Scan supports for a single
+// field, so slices of them are not scanned field by field by ScanAll.
+var scalarStructTypes = map[reflect.Type]bool{
+	reflect.TypeOf(big.Int{}):     true,
+	reflect.TypeOf(big.Rat{}):     true,
+	reflect.TypeOf(Circle{}):      true,
+	reflect.TypeOf(LineSegment{}): true,
+	reflect.TypeOf(Path{}):        true,
+	reflect.TypeOf(Point{}):       true,
+	reflect.TypeOf(Range{}):       true,
+	reflect.TypeOf(TID{}):         true,
+	reflect.TypeOf(time.Time{}):   true,
+	reflect.TypeOf(TimeOfDay{}):   true,
+}
+
+// isRowStruct returns if values of type t receive whole rows, one column per
+// struct field, rather than a single field.
+func isRowStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && !scalarStructTypes[t]
+}
+
+// structValue returns the struct dest points to.
+func structValue(dest interface{}) reflect.Value {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("expected pointer to struct, have: %T", dest))
+	}
+
+	return v.Elem()
+}
+
+// structField returns the field of the struct v that corresponds to the
+// column with the specified name.
+//
+// The column name of a field is given by its pgsql tag, e.g. `pgsql:"id"`,
+// fields tagged with `pgsql:"-"` are skipped. Untagged fields match columns
+// with the same name, ignoring case and underscores, so that field UserID
+// matches column user_id. Unexported fields are skipped.
+func structField(v reflect.Value, column string) (f reflect.Value, ok bool) {
+	t := v.Type()
+	plain := strings.Replace(column, "_", "", -1)
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		switch tag := sf.Tag.Get("pgsql"); tag {
+		case "-":
+			continue
+
+		case "":
+			if !strings.EqualFold(sf.Name, column) && !strings.EqualFold(sf.Name, plain) {
+				continue
+			}
+
+		default:
+			if tag != column {
+				continue
+			}
+		}
+
+		return v.Field(i), true
+	}
+
+	return
+}
+
+func (rs *ResultSet) scanStructs(dests ...interface{}) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.scanStructs"))
+	}
+
+	structs := make([]reflect.Value, len(dests))
+	for i, dest := range dests {
+		structs[i] = structValue(dest)
+	}
+
+	// The tables in order of their first column.
+	var tables []int32
+	tableIndex := make(map[int32]int)
+	for _, f := range rs.fields {
+		if _, ok := tableIndex[f.tableOID]; !ok && f.tableOID != 0 {
+			tableIndex[f.tableOID] = len(tables)
+			tables = append(tables, f.tableOID)
+		}
+	}
+
+	if len(tables) != len(dests) {
+		panic(fmt.Sprintf("wrong destination count, row has columns of %d tables, have: %d", len(tables), len(dests)))
+	}
+
+	// Columns without a matching struct field are left out by passing nil.
+	args := make([]interface{}, len(rs.fields))
+	for i, f := range rs.fields {
+		if f.tableOID == 0 {
+			continue
+		}
+
+		if sf, ok := structField(structs[tableIndex[f.tableOID]], f.name); ok {
+			args[i] = sf.Addr().Interface()
+		}
+	}
+
+	rs.scan(args...)
+}
+
+// ScanStructs scans the fields of the current row in the ResultSet into the
+// fields of the structs dests point to, e.g. the rows of a join into one
+// struct per joined table.
+//
+// Columns are assigned to structs by the table they were selected from: the
+// first struct receives the columns of the table that comes first in the row,
+// the second struct those of the next table and so on. So the number of
+// structs must match the number of tables. Columns that are not taken
+// straight from a table, like computed ones, are ignored, as are columns
+// without a matching struct field. Since tables are identified by their OID,
+// the columns of a self-join all go to the same struct.
+//
+// Columns are matched to struct fields by name, ignoring case and
+// underscores, or by the pgsql tag of a field, e.g. `pgsql:"id"`. Fields
+// tagged with `pgsql:"-"` are skipped. Field types must be supported by Scan.
+func (rs *ResultSet) ScanStructs(dests ...interface{}) (err error) {
+	err = rs.conn.withRecover("*ResultSet.ScanStructs", func() {
+		rs.scanStructs(dests...)
+	})
+
+	return
+}
+
+func (stmt *Statement) bindStruct(src interface{}) {
+	if stmt.conn.LogLevel >= LogDebug {
+		defer stmt.conn.logExit(stmt.conn.logEnter("*Statement.bindStruct"))
+	}
+
+	v := reflect.ValueOf(src)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("expected struct or pointer to struct, have: %T", src))
+	}
+
+	for _, p := range stmt.params {
+		name := p.name
+		if strings.HasPrefix(name, "@") || strings.HasPrefix(name, ":") {
+			name = name[1:]
+		}
+
+		f, ok := structField(v, name)
+		if !ok {
+			panic(fmt.Errorf("no struct field for parameter: '%s'", p.name))
+		}
+
+		panicIfErr(p.SetValue(f.Interface()))
+	}
+}
+
+// BindStruct sets the values of the parameters of the Statement to the values
+// of the fields of the struct src, or the struct src points to.
+//
+// Parameters are matched to struct fields like columns are for ScanStructs,
+// using the name of a parameter without its leading @ or :, so that parameter
+// @user_id receives the value of field UserID or of the field tagged with
+// `pgsql:"user_id"`. Fields without a matching parameter are ignored, but
+// an error is returned, if a parameter has no matching field.
+func (stmt *Statement) BindStruct(src interface{}) (err error) {
+	err = stmt.conn.withRecover("*Statement.BindStruct", func() {
+		stmt.bindStruct(src)
+	})
+
+	return
+}
+
+func (rs *ResultSet) scanAll(dest interface{}) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.scanAll"))
+	}
+
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		panic(fmt.Sprintf("expected pointer to slice, have: %T", dest))
+	}
+
+	slice := v.Elem()
+	elemType := slice.Type().Elem()
+
+	rowType := elemType
+	if rowType.Kind() == reflect.Ptr {
+		rowType = rowType.Elem()
+	}
+
+	byField := isRowStruct(rowType)
+	if !byField && len(rs.fields) != 1 {
+		panic(fmt.Sprintf("rows have %d fields, expected exactly one for %s elements", len(rs.fields), elemType))
+	}
+
+	args := make([]interface{}, len(rs.fields))
+
+	for rs.fetchNext() {
+		if byField {
+			row := reflect.New(rowType)
+			for i, f := range rs.fields {
+				args[i] = nil
+				if sf, ok := structField(row.Elem(), f.name); ok {
+					args[i] = sf.Addr().Interface()
+				}
+			}
+			rs.scan(args...)
+
+			if elemType.Kind() == reflect.Ptr {
+				slice.Set(reflect.Append(slice, row))
+			} else {
+				slice.Set(reflect.Append(slice, row.Elem()))
+			}
+		} else {
+			elem := reflect.New(elemType)
+			rs.scan(elem.Interface())
+
+			slice.Set(reflect.Append(slice, elem.Elem()))
+		}
+	}
+}
+
+// ScanAll reads the remaining rows of the current result and appends them to
+// the slice dest points to.
+//
+// If the elements of the slice are structs, or pointers to structs, each row
+// is scanned into a new struct, matching columns to struct fields by name
+// like ScanStructs does, but regardless of the table a column was selected
+// from. Otherwise rows must have a single field, which is scanned into a new
+// element, e.g. for a *[]int64 dest. Struct types Scan supports as a whole,
+// like time.Time or Point, are treated like single field values.
+func (rs *ResultSet) ScanAll(dest interface{}) (err error) {
+	err = rs.conn.withRecover("*ResultSet.ScanAll", func() {
+		rs.scanAll(dest)
+	})
+
+	rs.setCompletedOnPgsqlError(err)
+
+	return
+}
+
+func (stmt *Statement) executeReturningAll(dest interface{}) {
+	if stmt.conn.LogLevel >= LogDebug {
+		defer stmt.conn.logExit(stmt.conn.logEnter("*Statement.executeReturningAll"))
+	}
+
+	rs := stmt.query()
+	defer rs.close()
+
+	rs.scanAll(dest)
+}
+
+// ExecuteReturningAll executes the Statement, e.g. an UPDATE with a RETURNING
+// clause, and appends all rows it returns to the slice dest points to, as
+// described for *ResultSet.ScanAll.
+func (stmt *Statement) ExecuteReturningAll(dest interface{}) (err error) {
+	err = stmt.conn.withRecover("*Statement.ExecuteReturningAll", func() {
+		stmt.executeReturningAll(dest)
+	})
+
+	return
+}
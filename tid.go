@@ -0,0 +1,93 @@
+// Copyright 2013 The go-pgsql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgsql
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TID represents a value of the PostgreSQL type tid, the physical location
+// of a row version within its table, as found in the system column ctid.
+type TID struct {
+	// Block is the number of the block that contains the row.
+	Block uint32
+
+	// Offset is the index of the row within its block, starting at 1.
+	Offset uint16
+}
+
+// String returns tid in the text format of PostgreSQL, e.g. (0,1).
+func (tid TID) String() string {
+	return fmt.Sprintf("(%d,%d)", tid.Block, tid.Offset)
+}
+
+// parseTID parses a tid value in the text format of PostgreSQL, e.g. (0,1).
+func parseTID(s string) (tid TID, err error) {
+	if !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+		return TID{}, fmt.Errorf("invalid tid: '%s'", s)
+	}
+
+	parts := strings.Split(s[1:len(s)-1], ",")
+	if len(parts) != 2 {
+		return TID{}, fmt.Errorf("invalid tid: '%s'", s)
+	}
+
+	block, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return TID{}, fmt.Errorf("invalid tid: '%s'", s)
+	}
+	offset, err := strconv.ParseUint(parts[1], 10, 16)
+	if err != nil {
+		return TID{}, fmt.Errorf("invalid tid: '%s'", s)
+	}
+
+	return TID{uint32(block), uint16(offset)}, nil
+}
+
+func (rs *ResultSet) tid(ord int) (value TID, isNull bool) {
+	if rs.conn.LogLevel >= LogVerbose {
+		defer rs.conn.logExit(rs.conn.logEnter("*ResultSet.tid"))
+	}
+
+	isNull = rs.isNull(ord)
+	if isNull {
+		return
+	}
+
+	f := rs.fields[ord]
+	val := rs.values[ord]
+
+	if f.typeOID != _TIDOID {
+		panic(fmt.Sprintf("field '%s' is not of type tid, OID: %d", f.name, f.typeOID))
+	}
+
+	switch f.format {
+	case textFormat:
+		var err error
+		value, err = parseTID(string(val))
+		panicIfErr(err)
+
+	case binaryFormat:
+		if len(val) != 6 {
+			panic(fmt.Sprintf("invalid binary tid length: %d", len(val)))
+		}
+		value = TID{binary.BigEndian.Uint32(val), binary.BigEndian.Uint16(val[4:])}
+	}
+
+	return
+}
+
+// TID returns the value of the tid field with the specified ordinal, e.g. of
+// the system column ctid.
+func (rs *ResultSet) TID(ord int) (value TID, isNull bool, err error) {
+	err = rs.conn.withRecover("*ResultSet.TID", func() {
+		value, isNull = rs.tid(ord)
+	})
+
+	return
+}
@@ -0,0 +1,114 @@
+// Copyright 2013 The go-pgsql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgsql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TimeOfDay represents a value of the PostgreSQL types time and timetz, which
+// unlike time.Time have no date.
+type TimeOfDay struct {
+	Hour        int
+	Minute      int
+	Second      int
+	Microsecond int
+
+	// HasZone is true for time with time zone values.
+	HasZone bool
+
+	// ZoneOffset is the offset of the time zone in seconds east of UTC,
+	// e.g. -8*3600 for UTC-8.
+	ZoneOffset int
+}
+
+// String returns t in the text format of PostgreSQL, e.g. 04:05:06.789-08.
+func (t TimeOfDay) String() string {
+	s := fmt.Sprintf("%02d:%02d:%02d", t.Hour, t.Minute, t.Second)
+
+	if t.Microsecond != 0 {
+		s += strings.TrimRight(fmt.Sprintf(".%06d", t.Microsecond), "0")
+	}
+
+	if t.HasZone {
+		offset := t.ZoneOffset
+		sign := '+'
+		if offset < 0 {
+			sign = '-'
+			offset = -offset
+		}
+
+		s += fmt.Sprintf("%c%02d", sign, offset/3600)
+		if m, sec := offset%3600/60, offset%60; m != 0 || sec != 0 {
+			s += fmt.Sprintf(":%02d", m)
+			if sec != 0 {
+				s += fmt.Sprintf(":%02d", sec)
+			}
+		}
+	}
+
+	return s
+}
+
+// parseTimeOfDay parses a time or timetz value in the text format of
+// PostgreSQL, e.g. 04:05:06, 04:05:06.789-08 or 04:05:06+05:30.
+func parseTimeOfDay(s string) (t TimeOfDay, err error) {
+	invalid := func() (TimeOfDay, error) {
+		return TimeOfDay{}, fmt.Errorf("invalid time of day: '%s'", s)
+	}
+
+	clock := s
+	if i := strings.IndexAny(s, "+-"); i != -1 {
+		clock = s[:i]
+
+		t.HasZone = true
+
+		var parts [3]int
+		zone := strings.Split(s[i+1:], ":")
+		if len(zone) > 3 {
+			return invalid()
+		}
+		for j, part := range zone {
+			if parts[j], err = strconv.Atoi(part); err != nil {
+				return invalid()
+			}
+		}
+
+		t.ZoneOffset = parts[0]*3600 + parts[1]*60 + parts[2]
+		if s[i] == '-' {
+			t.ZoneOffset = -t.ZoneOffset
+		}
+	}
+
+	if i := strings.IndexByte(clock, '.'); i != -1 {
+		frac := clock[i+1:]
+		clock = clock[:i]
+
+		if len(frac) == 0 || len(frac) > 6 {
+			return invalid()
+		}
+		if t.Microsecond, err = strconv.Atoi(frac + strings.Repeat("0", 6-len(frac))); err != nil {
+			return invalid()
+		}
+	}
+
+	fields := strings.Split(clock, ":")
+	if len(fields) != 3 {
+		return invalid()
+	}
+	if t.Hour, err = strconv.Atoi(fields[0]); err != nil {
+		return invalid()
+	}
+	if t.Minute, err = strconv.Atoi(fields[1]); err != nil {
+		return invalid()
+	}
+	if t.Second, err = strconv.Atoi(fields[2]); err != nil {
+		return invalid()
+	}
+
+	return
+}
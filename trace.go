@@ -0,0 +1,114 @@
+// Copyright 2013 The go-pgsql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgsql
+
+import (
+	"encoding/binary"
+)
+
+// Directions of the messages reported to a MessageTracer.
+const (
+	// TraceFrontend marks messages sent to the server.
+	TraceFrontend = 'F'
+
+	// TraceBackend marks messages received from the server.
+	TraceBackend = 'B'
+)
+
+// MessageTracer is called for each protocol message sent to or received from
+// the server, see *Conn.SetMessageTracer.
+//
+// direction is TraceFrontend or TraceBackend. msgType is the message type
+// byte, e.g. 'Q' for Query, or 0 for the startup message, which has none.
+// payload contains the message body without type and length. It is only
+// valid during the call.
+type MessageTracer func(direction byte, msgType byte, payload []byte)
+
+// messageSplitter splits a stream of protocol messages into single messages
+// and passes them to the tracer of conn. It keeps track of message boundaries
+// also while no tracer is set, so a tracer can be set at any time, but the
+// payload is only collected while a tracer is set.
+type messageSplitter struct {
+	conn      *Conn
+	direction byte
+	untyped   bool // The next message has no type byte.
+	header    [5]byte
+	headerLen int
+	inMessage bool
+	collect   bool
+	msgType   byte
+	remaining int
+	payload   []byte
+}
+
+func newMessageSplitter(conn *Conn, direction byte) *messageSplitter {
+	return &messageSplitter{
+		conn:      conn,
+		direction: direction,
+		untyped:   direction == TraceFrontend,
+	}
+}
+
+func (s *messageSplitter) feed(b []byte) {
+	for len(b) > 0 {
+		if !s.inMessage {
+			headerSize := 5
+			if s.untyped {
+				headerSize = 4
+			}
+
+			n := copy(s.header[s.headerLen:headerSize], b)
+			s.headerLen += n
+			b = b[n:]
+			if s.headerLen < headerSize {
+				return
+			}
+
+			if s.untyped {
+				s.msgType = 0
+				s.remaining = int(binary.BigEndian.Uint32(s.header[:4])) - 4
+				s.untyped = false
+			} else {
+				s.msgType = s.header[0]
+				s.remaining = int(binary.BigEndian.Uint32(s.header[1:5])) - 4
+			}
+
+			s.headerLen = 0
+			s.inMessage = true
+			s.collect = s.conn.tracer != nil
+			s.payload = s.payload[:0]
+		}
+
+		n := s.remaining
+		if n > len(b) {
+			n = len(b)
+		}
+		if s.collect {
+			s.payload = append(s.payload, b[:n]...)
+		}
+		s.remaining -= n
+		b = b[n:]
+
+		if s.remaining <= 0 {
+			s.inMessage = false
+
+			if s.collect && s.conn.tracer != nil {
+				s.conn.tracer(s.direction, s.msgType, s.payload)
+			}
+		}
+	}
+}
+
+// SetMessageTracer sets a function, which is called for each protocol message
+// sent to or received from the server, or removes it, if tracer is nil.
+//
+// Received messages are reported when they are read from the network, before
+// they are parsed, sent messages when they are written to the network. Since
+// messages are read ahead in chunks, messages already read when the tracer is
+// set are not reported. This is meant for protocol debugging, e.g. to dump a
+// full trace for a bug report.
+func (conn *Conn) SetMessageTracer(tracer MessageTracer) {
+	conn.tracer = tracer
+}
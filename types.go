@@ -20,6 +20,7 @@ const (
 	_XIDOID              = 28
 	_CIDOID              = 29
 	_OIDVECTOROID        = 30
+	_JSONOID             = 114
 	_XMLOID              = 142
 	_POINTOID            = 600
 	_LSEGOID             = 601
@@ -35,12 +36,30 @@ const (
 	_UNKNOWNOID          = 705
 	_CIRCLEOID           = 718
 	_CASHOID             = 790
+	_MACADDR8OID         = 774
 	_MACADDROID          = 829
 	_INETOID             = 869
 	_CIDROID             = 650
+	_BOOLARRAYOID        = 1000
+	_BYTEAARRAYOID       = 1001
+	_CHARARRAYOID        = 1002
+	_NAMEARRAYOID        = 1003
+	_INT2ARRAYOID        = 1005
 	_INT4ARRAYOID        = 1007
 	_TEXTARRAYOID        = 1009
+	_BPCHARARRAYOID      = 1014
+	_VARCHARARRAYOID     = 1015
+	_INT8ARRAYOID        = 1016
+	_BOXARRAYOID         = 1020
 	_FLOAT4ARRAYOID      = 1021
+	_FLOAT8ARRAYOID      = 1022
+	_OIDARRAYOID         = 1028
+	_TIMESTAMPARRAYOID   = 1115
+	_DATEARRAYOID        = 1182
+	_TIMEARRAYOID        = 1183
+	_TIMESTAMPTZARRAYOID = 1185
+	_NUMERICARRAYOID     = 1231
+	_TIMETZARRAYOID      = 1270
 	_ACLITEMOID          = 1033
 	_CSTRINGARRAYOID     = 1263
 	_BPCHAROID           = 1042
@@ -66,6 +85,17 @@ const (
 	_TSQUERYOID          = 3615
 	_REGCONFIGOID        = 3734
 	_REGDICTIONARYOID    = 3769
+	_UUIDOID             = 2950
+	_JSONBOID            = 3802
+	_JSONPATHOID         = 4072
+	_PG_LSNOID           = 3220
+	_INT4RANGEOID        = 3904
+	_NUMRANGEOID         = 3906
+	_TSRANGEOID          = 3908
+	_TSTZRANGEOID        = 3910
+	_DATERANGEOID        = 3912
+	_INT8RANGEOID        = 3926
+	_UUIDARRAYOID        = 2951
 	_RECORDOID           = 2249
 	_RECORDARRAYOID      = 2287
 	_CSTRINGOID          = 2275
@@ -81,20 +111,57 @@ const (
 	_ANYENUMOID          = 3500
 )
 
+// customTypeOIDs maps the names of some built-in types, as used for
+// NewCustomTypeParameter, to their OIDs, so they can be specified when
+// preparing statements.
+var customTypeOIDs = map[string]int32{
+	"bytea":       _BYTEAOID,
+	"daterange":   _DATERANGEOID,
+	"int4range":   _INT4RANGEOID,
+	"int8range":   _INT8RANGEOID,
+	"numrange":    _NUMRANGEOID,
+	"tsrange":     _TSRANGEOID,
+	"tstzrange":   _TSTZRANGEOID,
+	"cidr":        _CIDROID,
+	"inet":        _INETOID,
+	"int[]":       _INT4ARRAYOID,
+	"int4[]":      _INT4ARRAYOID,
+	"integer[]":   _INT4ARRAYOID,
+	"int8[]":      _INT8ARRAYOID,
+	"bigint[]":    _INT8ARRAYOID,
+	"json":        _JSONOID,
+	"jsonb":       _JSONBOID,
+	"jsonpath":    _JSONPATHOID,
+	"macaddr":     _MACADDROID,
+	"pg_lsn":      _PG_LSNOID,
+	"text[]":      _TEXTARRAYOID,
+	"tid":         _TIDOID,
+	"uuid":        _UUIDOID,
+	"varchar[]":   _VARCHARARRAYOID,
+	"xml":         _XMLOID,
+	"interval":    _INTERVALOID,
+	"timestamptz": _TIMESTAMPTZOID,
+}
+
 // Type represents the PostgreSQL data type of fields and parameters.
 type Type int32
 
 const (
 	Custom      Type = 0
 	Boolean     Type = _BOOLOID
+	Bytea       Type = _BYTEAOID
 	Char        Type = _CHAROID
 	Date        Type = _DATEOID
+	Name        Type = _NAMEOID
 	Real        Type = _FLOAT4OID
 	Double      Type = _FLOAT8OID
 	Smallint    Type = _INT2OID
 	Integer     Type = _INT4OID
 	Bigint      Type = _INT8OID
+	MacAddr     Type = _MACADDROID
+	MacAddr8    Type = _MACADDR8OID
 	Numeric     Type = _NUMERICOID
+	Oid         Type = _OIDOID
 	Text        Type = _TEXTOID
 	Time        Type = _TIMEOID
 	TimeTZ      Type = _TIMETZOID
@@ -103,11 +170,38 @@ const (
 	Varchar     Type = _VARCHAROID
 )
 
+// sqlTypeNames maps the Types to the names used for them in SQL.
+var sqlTypeNames = map[Type]string{
+	Boolean:     "boolean",
+	Bytea:       "bytea",
+	Char:        `"char"`,
+	Date:        "date",
+	Name:        "name",
+	Real:        "real",
+	Double:      "double precision",
+	Smallint:    "smallint",
+	Integer:     "integer",
+	Bigint:      "bigint",
+	MacAddr:     "macaddr",
+	MacAddr8:    "macaddr8",
+	Numeric:     "numeric",
+	Oid:         "oid",
+	Text:        "text",
+	Time:        "time",
+	TimeTZ:      "timetz",
+	Timestamp:   "timestamp",
+	TimestampTZ: "timestamptz",
+	Varchar:     "varchar",
+}
+
 func (t Type) String() string {
 	switch t {
 	case Boolean:
 		return "Boolean"
 
+	case Bytea:
+		return "Bytea"
+
 	case Char:
 		return "Char"
 
@@ -117,6 +211,12 @@ func (t Type) String() string {
 	case Date:
 		return "Date"
 
+	case Name:
+		return "Name"
+
+	case Oid:
+		return "Oid"
+
 	case Real:
 		return "Real"
 
@@ -132,6 +232,12 @@ func (t Type) String() string {
 	case Bigint:
 		return "Bigint"
 
+	case MacAddr:
+		return "MacAddr"
+
+	case MacAddr8:
+		return "MacAddr8"
+
 	case Numeric:
 		return "Numeric"
 
@@ -4,6 +4,29 @@
 
 package pgsql
 
+import (
+	"strings"
+)
+
+// quoteIdentifier returns name as a quoted SQL identifier, e.g. for names of
+// cursors that must not be folded to lower case.
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// quoteLiteral returns s as a quoted SQL string literal. If s contains
+// backslashes, an escape string literal is returned, e.g. E'a\\b', which
+// means the same regardless of standard_conforming_strings.
+func quoteLiteral(s string) string {
+	s = strings.Replace(s, `'`, `''`, -1)
+
+	if strings.IndexByte(s, '\\') == -1 {
+		return `'` + s + `'`
+	}
+
+	return `E'` + strings.Replace(s, `\`, `\\`, -1) + `'`
+}
+
 func panicIfErr(err error) {
 	if err != nil {
 		panic(err)